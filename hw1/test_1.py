@@ -30,7 +30,9 @@ def load_test(url, duration_seconds=30):
             
     return response_times
 
-# Replace with your EC2 public IP
+# Replace with your EC2 public IP. Start the service there with
+# `go run . -profile ec2` in web-service-gin; the default local profile
+# only listens on 127.0.0.1.
 EC2_URL = "http://44.252.110.48:8080/albums"
 
 
@@ -0,0 +1,159 @@
+// Package certs serves TLS certificates that are reloaded from disk when the
+// files change, so certificates can be rotated without restarting the server.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds the current server certificate and, for mutual TLS, the
+// pool of client CAs. Both are swapped atomically when the files change.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader loads the key pair (and client CA bundle, if given) once and
+// fails if any of them can't be parsed.
+func NewReloader(certFile, keyFile, clientCAFile string, clientAuth tls.ClientAuthType) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		clientAuth:   clientAuth,
+		modTimes:     make(map[string]time.Time),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads every file. On error the previously loaded material is kept.
+func (r *Reloader) Reload() error {
+	// Stat before reading, so a file replaced while it is being read looks
+	// changed on the next poll rather than already loaded.
+	modTimes := r.currentModTimes()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("reading client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA %s contains no PEM certificates", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.modTimes = modTimes
+	return nil
+}
+
+// TLSConfig returns a server config that always hands out the latest
+// certificate and client CA pool. It offers h2 over ALPN only when http2 is
+// set, since clients that negotiate h2 expect the server to speak it.
+func (r *Reloader) TLSConfig(http2 bool) *tls.Config {
+	nextProtos := []string{"http/1.1"}
+	if http2 {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    r.clientCA,
+				NextProtos:   nextProtos,
+			}, nil
+		},
+	}
+}
+
+// Watch polls the files every interval and reloads when any modification
+// time changes, until the returned stop function is called.
+func (r *Reloader) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					slog.Error("tls reload failed, keeping previous certificate", "err", err)
+					continue
+				}
+				slog.Info("tls certificate reloaded", "cert", r.certFile)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// --- Helpers ---
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) currentModTimes() map[string]time.Time {
+	out := make(map[string]time.Time)
+	for _, f := range r.files() {
+		if info, err := os.Stat(f); err == nil {
+			out[f] = info.ModTime()
+		}
+	}
+	return out
+}
+
+func (r *Reloader) changed() bool {
+	now := r.currentModTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		if !now[f].Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Cluster is this node's view of the membership and the ring built from it.
+// Membership changes carry a version so that a node ignores an older view
+// arriving after a newer one.
+type Cluster struct {
+	self   string
+	vnodes int
+
+	mu      sync.RWMutex
+	version uint64
+	members map[string]*url.URL
+	ring    *Ring
+}
+
+// New returns the initial view: version 1 with the given members.
+func New(self string, members map[string]*url.URL, vnodes int) *Cluster {
+	c := &Cluster{self: self, vnodes: vnodes}
+	c.set(1, members)
+	return c
+}
+
+// Self returns this node's ID.
+func (c *Cluster) Self() string { return c.self }
+
+// Owner returns the node that owns productID and its base URL.
+func (c *Cluster) Owner(productID int) (string, *url.URL) {
+	return c.OwnerOf(strconv.Itoa(productID))
+}
+
+// OwnerOf returns the node that owns an arbitrary key and its base URL.
+func (c *Cluster) OwnerOf(key string) (string, *url.URL) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node := c.ring.Owner(key)
+	return node, c.members[node]
+}
+
+// Members returns the current version and a copy of the membership.
+func (c *Cluster) Members() (uint64, map[string]*url.URL) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version, maps.Clone(c.members)
+}
+
+// Apply installs a membership view if it is newer than the current one
+// and reports whether it did.
+func (c *Cluster) Apply(version uint64, members map[string]*url.URL) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version <= c.version {
+		return false
+	}
+	c.setLocked(version, members)
+	return true
+}
+
+// Next installs members as the next version and returns that version.
+func (c *Cluster) Next(members map[string]*url.URL) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setLocked(c.version+1, members)
+	return c.version
+}
+
+// Status describes the ring for GET /cluster/ring.
+type Status struct {
+	Self         string             `json:"self"`
+	Version      uint64             `json:"version"`
+	VirtualNodes int                `json:"virtual_nodes"`
+	Members      map[string]string  `json:"members"`
+	Shares       map[string]float64 `json:"shares"`
+	Ranges       []Range            `json:"ranges,omitempty"`
+}
+
+// Status returns the membership and ownership. Ranges are included only
+// when withRanges is set since there are up to VirtualNodes per member.
+func (c *Cluster) Status(withRanges bool) Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	st := Status{
+		Self:         c.self,
+		Version:      c.version,
+		VirtualNodes: c.vnodes,
+		Members:      make(map[string]string, len(c.members)),
+		Shares:       c.ring.Shares(),
+	}
+	for id, u := range c.members {
+		st.Members[id] = u.String()
+	}
+	if withRanges {
+		st.Ranges = c.ring.Ranges()
+	}
+	return st
+}
+
+// --- Helpers ---
+
+func (c *Cluster) set(version uint64, members map[string]*url.URL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(version, members)
+}
+
+func (c *Cluster) setLocked(version uint64, members map[string]*url.URL) {
+	c.version = version
+	c.members = maps.Clone(members)
+	c.ring = NewRing(slices.Collect(maps.Keys(members)), c.vnodes)
+}
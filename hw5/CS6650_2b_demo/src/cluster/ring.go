@@ -0,0 +1,128 @@
+// Package cluster partitions products across nodes with a consistent-hash
+// ring and tracks the current membership.
+package cluster
+
+import (
+	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// point is one virtual node: a position on the ring owned by a member.
+type point struct {
+	hash uint64
+	node string
+}
+
+// Ring maps keys to members. Each member is placed at VirtualNodes
+// pseudo-random positions; a key belongs to the first position at or after
+// its own hash. Adding or removing a member only moves the keys in the arcs
+// next to that member's positions.
+type Ring struct {
+	vnodes int
+	nodes  []string
+	points []point
+}
+
+// NewRing builds a ring of the given members with vnodes positions each.
+func NewRing(members []string, vnodes int) *Ring {
+	r := &Ring{vnodes: vnodes, nodes: slices.Clone(members)}
+	slices.Sort(r.nodes)
+	r.nodes = slices.Compact(r.nodes)
+	for _, m := range r.nodes {
+		for i := range vnodes {
+			r.points = append(r.points, point{hash: hashKey(m + "#" + strconv.Itoa(i)), node: m})
+		}
+	}
+	// Ties are broken by name so every node builds an identical ring.
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash != r.points[j].hash {
+			return r.points[i].hash < r.points[j].hash
+		}
+		return r.points[i].node < r.points[j].node
+	})
+	return r
+}
+
+// Nodes returns the members in sorted order.
+func (r *Ring) Nodes() []string { return slices.Clone(r.nodes) }
+
+// Owner returns the member responsible for key, or "" if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// Range is an arc of the hash space, (Start, End], owned by Node. The arc
+// that wraps past the top of the space has Start > End.
+type Range struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	Node  string `json:"node"`
+}
+
+// Ranges returns every arc of the ring, with neighbouring arcs of the same
+// owner merged.
+func (r *Ring) Ranges() []Range {
+	var out []Range
+	for i, p := range r.points {
+		prev := r.points[(i+len(r.points)-1)%len(r.points)].hash
+		if n := len(out); n > 0 && out[n-1].Node == p.node {
+			out[n-1].End = p.hash
+			continue
+		}
+		out = append(out, Range{Start: prev, End: p.hash, Node: p.node})
+	}
+	// The first and last arcs meet at the wrap-around point.
+	if n := len(out); n > 1 && out[0].Node == out[n-1].Node {
+		out[0].Start = out[n-1].Start
+		out = out[:n-1]
+	}
+	return out
+}
+
+// Shares returns the fraction of the hash space each member owns.
+func (r *Ring) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(r.nodes))
+	for _, m := range r.nodes {
+		shares[m] = 0
+	}
+	if len(r.points) == 0 {
+		return shares
+	}
+	for i, p := range r.points {
+		prev := r.points[(i+len(r.points)-1)%len(r.points)].hash
+		// Unsigned subtraction wraps, which is exactly the arc length
+		// for the first point. A single point owns everything.
+		arc := p.hash - prev
+		if len(r.points) == 1 {
+			shares[p.node] = 1
+			break
+		}
+		shares[p.node] += float64(arc) / math.MaxUint64
+	}
+	return shares
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV alone clusters similar keys like "node-a#1", "node-a#2"; a
+	// final avalanche step spreads them evenly.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// owners maps keys 1..n to their owner on r.
+func owners(r *Ring, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = r.Owner(strconv.Itoa(i + 1))
+	}
+	return out
+}
+
+func TestRingMovesOnlyKeysOfTheChangedMember(t *testing.T) {
+	const keys = 20000
+	before := NewRing([]string{"a", "b", "c", "d"}, 128)
+	old := owners(before, keys)
+
+	t.Run("add", func(t *testing.T) {
+		after := owners(NewRing([]string{"a", "b", "c", "d", "e"}, 128), keys)
+		moved := 0
+		for i := range after {
+			if after[i] == old[i] {
+				continue
+			}
+			moved++
+			if after[i] != "e" {
+				t.Fatalf("key %d moved from %s to %s, not to the new member", i+1, old[i], after[i])
+			}
+		}
+		// e should take about a fifth of the keys.
+		if share := float64(moved) / keys; math.Abs(share-0.2) > 0.05 {
+			t.Errorf("%.1f%% of keys moved, want about 20%%", 100*share)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		after := owners(NewRing([]string{"a", "c", "d"}, 128), keys)
+		for i := range after {
+			if old[i] != "b" && after[i] != old[i] {
+				t.Fatalf("key %d moved from %s to %s, though b was removed", i+1, old[i], after[i])
+			}
+			if after[i] == "b" {
+				t.Fatalf("key %d still belongs to the removed member", i+1)
+			}
+		}
+	})
+}
+
+func TestRingIsTheSameOnEveryNode(t *testing.T) {
+	x := owners(NewRing([]string{"a", "b", "c"}, 64), 1000)
+	y := owners(NewRing([]string{"c", "a", "b", "a"}, 64), 1000)
+	for i := range x {
+		if x[i] != y[i] {
+			t.Fatalf("key %d: owner %s on one ring, %s on the other", i+1, x[i], y[i])
+		}
+	}
+}
+
+func TestRingShares(t *testing.T) {
+	r := NewRing([]string{"a", "b", "c", "d"}, 128)
+	total := 0.0
+	for m, share := range r.Shares() {
+		total += share
+		if math.Abs(share-0.25) > 0.08 {
+			t.Errorf("%s owns %.1f%% of the ring, want about 25%%", m, 100*share)
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("shares add up to %v, want 1", total)
+	}
+	if got := NewRing([]string{"a"}, 1).Shares()["a"]; got != 1 {
+		t.Errorf("a single point owns %v of the ring, want all of it", got)
+	}
+	if got := NewRing(nil, 128).Owner("1"); got != "" {
+		t.Errorf("empty ring: owner %q, want none", got)
+	}
+}
@@ -0,0 +1,130 @@
+// Command loadgen drives the product API with the locustfile.py task mix
+// (9 product reads per product write) and reports throughput and latency
+// percentiles.
+//
+//	go run ./cmd/loadgen -url http://localhost:8080 -mode closed -users 50 -duration 1m
+//	go run ./cmd/loadgen -url http://localhost:8080 -mode open -rps 500 -format csv -out run.csv
+//
+// With -listen it instead waits as a worker for a coordinator, which is
+// started with -workers and splits the load between them:
+//
+//	go run ./cmd/loadgen -listen :7001 &
+//	go run ./cmd/loadgen -listen :7002 &
+//	go run ./cmd/loadgen -workers http://localhost:7001,http://localhost:7002 -mode open -rps 5000
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"product-api/loadgen"
+)
+
+func main() {
+	target := flag.String("url", "http://localhost:8080", "base URL of the product API")
+	mode := flag.String("mode", "closed", "open (fixed request rate) or closed (fixed number of users)")
+	rps := flag.Float64("rps", 100, "requests per second in open-loop mode")
+	inFlight := flag.Int("max-in-flight", 1000, "open-loop requests outstanding at once; later starts wait for a free slot")
+	users := flag.Int("users", 10, "concurrent users in closed-loop mode")
+	think := flag.String("think", "1s-3s", "closed-loop time from one of a user's request starts to the next, as min-max or a single duration")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	seed := flag.Bool("seed", true, "create the 50 categories and 100 products the task mix reads before starting")
+	randSeed := flag.Uint64("rand-seed", 1, "seed for the task sequence")
+	format := flag.String("format", "text", "report format: text, csv or json")
+	out := flag.String("out", "", "write the report to this file instead of stdout")
+	listen := flag.String("listen", "", "run as a worker serving coordinators on this address")
+	workers := flag.String("workers", "", "comma-separated worker URLs to split the load between")
+	startDelay := flag.Duration("start-delay", 2*time.Second, "time workers are given to receive the plan before starting together")
+	flag.Parse()
+
+	if *listen != "" {
+		fmt.Printf("loadgen worker listening on %s\n", *listen)
+		log.Fatal(http.ListenAndServe(*listen, &loadgen.Worker{}))
+	}
+
+	thinkMin, thinkMax, err := parseThink(*think)
+	if err != nil {
+		log.Fatalf("-think: %v", err)
+	}
+	write, err := reportWriter(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := loadgen.Options{
+		BaseURL:     strings.TrimSuffix(*target, "/"),
+		Mode:        loadgen.Mode(*mode),
+		Duration:    *duration,
+		Timeout:     *timeout,
+		Seed:        *seed,
+		RandSeed:    *randSeed,
+		RPS:         *rps,
+		MaxInFlight: *inFlight,
+		Users:       *users,
+		ThinkMin:    thinkMin,
+		ThinkMax:    thinkMax,
+	}
+	var res *loadgen.Result
+	if *workers != "" {
+		res, err = loadgen.Coordinate(ctx, strings.Split(*workers, ","), opts, *startDelay)
+	} else {
+		res, err = loadgen.Run(ctx, opts)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(res.Report(), w); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func reportWriter(format string) (func(*loadgen.Report, io.Writer) error, error) {
+	switch format {
+	case "text":
+		return (*loadgen.Report).WriteText, nil
+	case "csv":
+		return (*loadgen.Report).WriteCSV, nil
+	case "json":
+		return (*loadgen.Report).WriteJSON, nil
+	}
+	return nil, fmt.Errorf("-format %q is not one of text, csv, json", format)
+}
+
+// parseThink accepts "2s" or "1s-3s".
+func parseThink(s string) (time.Duration, time.Duration, error) {
+	lo, hi, found := strings.Cut(s, "-")
+	thinkMin, err := time.ParseDuration(lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return thinkMin, thinkMin, nil
+	}
+	thinkMax, err := time.ParseDuration(hi)
+	if err != nil {
+		return 0, 0, err
+	}
+	return thinkMin, thinkMax, nil
+}
@@ -0,0 +1,53 @@
+// Command raftsim runs the deterministic Raft scenarios from package
+// raftsim. The same seed always replays the same schedule of elections,
+// message loss, partitions and crashes, so a failing seed can be rerun
+// and debugged.
+//
+//	go run ./cmd/raftsim -seed 42 -runs 100
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"product-api/raft/raftsim"
+)
+
+func main() {
+	seed := flag.Uint64("seed", 1, "first seed to run")
+	runs := flag.Int("runs", 1, "number of consecutive seeds to run each scenario with")
+	only := flag.String("scenario", "", "run only this scenario (default: all)")
+	flag.Parse()
+
+	failed := 0
+	found := false
+	for _, s := range raftsim.Scenarios {
+		if *only != "" && s.Name != *only {
+			continue
+		}
+		found = true
+		for i := range *runs {
+			sd := *seed + uint64(i)
+			if err := raftsim.RunScenario(s, sd); err != nil {
+				failed++
+				fmt.Printf("FAIL %-20s seed=%d: %v\n", s.Name, sd, err)
+				continue
+			}
+			if *runs == 1 {
+				fmt.Printf("PASS %-20s seed=%d\n", s.Name, sd)
+			}
+		}
+		if *runs > 1 {
+			fmt.Printf("DONE %-20s seeds=%d..%d\n", s.Name, *seed, *seed+uint64(*runs)-1)
+		}
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown scenario %q\n", *only)
+		os.Exit(2)
+	}
+	if failed > 0 {
+		fmt.Printf("%d run(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,589 @@
+// Package config loads the product API's settings from defaults, an optional
+// YAML or TOML file, PRODUCT_API_* environment variables and command-line
+// flags, in that order of increasing precedence.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// EnvPrefix is prepended to every environment variable name.
+const EnvPrefix = "PRODUCT_API_"
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	TLS         TLSConfig         `yaml:"tls" toml:"tls"`
+	Store       StoreConfig       `yaml:"store" toml:"store"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" toml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+	Replication ReplicationConfig `yaml:"replication" toml:"replication"`
+	Raft        RaftConfig        `yaml:"raft" toml:"raft"`
+	Cluster     ClusterConfig     `yaml:"cluster" toml:"cluster"`
+	Faults      FaultsConfig      `yaml:"faults" toml:"faults"`
+	Admission   AdmissionConfig   `yaml:"admission" toml:"admission"`
+}
+
+type ServerConfig struct {
+	Addr            string   `yaml:"addr" toml:"addr"`
+	ReadTimeout     Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout     Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	HTTP2           bool     `yaml:"http2" toml:"http2"`
+	H2C             bool     `yaml:"h2c" toml:"h2c"`
+}
+
+// TLSConfig enables HTTPS when both CertFile and KeyFile are set.
+type TLSConfig struct {
+	CertFile       string   `yaml:"cert_file" toml:"cert_file"`
+	KeyFile        string   `yaml:"key_file" toml:"key_file"`
+	ClientCAFile   string   `yaml:"client_ca_file" toml:"client_ca_file"`
+	ClientAuth     string   `yaml:"client_auth" toml:"client_auth"`
+	ReloadInterval Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// ClientAuthType maps ClientAuth ("none", "request", "verify-if-given",
+// "require") to the crypto/tls policy.
+func (t TLSConfig) ClientAuthType() (tls.ClientAuthType, error) {
+	switch t.ClientAuth {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return 0, fmt.Errorf("tls.client_auth %q is not one of none, request, verify-if-given, require", t.ClientAuth)
+}
+
+// StoreConfig selects where the catalog and inventory are kept. "memory",
+// the only backend, loses them on restart; raft.data_dir is the way to
+// keep the catalog across restarts.
+type StoreConfig struct {
+	Backend string `yaml:"backend" toml:"backend"`
+}
+
+type LogConfig struct {
+	Level    string `yaml:"level" toml:"level"`
+	Requests bool   `yaml:"requests" toml:"requests"`
+}
+
+// RateLimitConfig configures the global token bucket. A zero RPS disables it.
+type RateLimitConfig struct {
+	RPS   float64 `yaml:"rps" toml:"rps"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+type IdempotencyConfig struct {
+	TTL Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// TracingConfig selects where finished spans go: "none", "file" (JSON lines
+// appended to File) or "memory" (kept in-process and served at /debug/traces).
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	File     string `yaml:"file" toml:"file"`
+}
+
+// ReplicationConfig sets this instance's role. A leader serves its change log
+// at /replication/log; a follower streams it from LeaderURL and sends writes
+// to the leader by 307 redirect or by proxying (FollowerWrites "forward").
+type ReplicationConfig struct {
+	Role           string `yaml:"role" toml:"role"`
+	LeaderURL      string `yaml:"leader_url" toml:"leader_url"`
+	FollowerWrites string `yaml:"follower_writes" toml:"follower_writes"`
+}
+
+// RaftConfig replicates the catalog with Raft when ID is non-zero. Peers
+// lists every member, this one included, as "id=url" pairs separated by
+// commas. Members authenticate their messages to each other with Secret.
+// An empty DataDir keeps Raft state in memory only.
+type RaftConfig struct {
+	ID                int      `yaml:"id" toml:"id"`
+	Peers             string   `yaml:"peers" toml:"peers"`
+	Secret            string   `yaml:"secret" toml:"secret"`
+	DataDir           string   `yaml:"data_dir" toml:"data_dir"`
+	Tick              Duration `yaml:"tick" toml:"tick"`
+	ElectionTicks     int      `yaml:"election_ticks" toml:"election_ticks"`
+	SnapshotThreshold int      `yaml:"snapshot_threshold" toml:"snapshot_threshold"`
+}
+
+// Enabled reports whether this instance is a Raft member.
+func (r RaftConfig) Enabled() bool { return r.ID != 0 }
+
+// PeerURLs parses Peers into a map from node ID to base URL.
+func (r RaftConfig) PeerURLs() (map[uint64]*url.URL, error) {
+	pairs, err := parseURLPairs("raft.peers", r.Peers)
+	if err != nil {
+		return nil, err
+	}
+	peers := make(map[uint64]*url.URL, len(pairs))
+	for idText, u := range pairs {
+		id, err := strconv.ParseUint(idText, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("raft.peers entry %q: id must be an integer >= 1", idText)
+		}
+		peers[id] = u
+	}
+	return peers, nil
+}
+
+// ClusterConfig partitions products across Members by consistent hashing
+// when NodeID is set. Members uses the same "id=url,..." form as raft.peers.
+// Members forward requests to each other and operators change the
+// membership with Secret as a bearer token.
+type ClusterConfig struct {
+	NodeID       string `yaml:"node_id" toml:"node_id"`
+	Members      string `yaml:"members" toml:"members"`
+	VirtualNodes int    `yaml:"virtual_nodes" toml:"virtual_nodes"`
+	Secret       string `yaml:"secret" toml:"secret"`
+}
+
+// Enabled reports whether this instance is part of a partitioned cluster.
+func (c ClusterConfig) Enabled() bool { return c.NodeID != "" }
+
+// MemberURLs parses Members into a map from node ID to base URL.
+func (c ClusterConfig) MemberURLs() (map[string]*url.URL, error) {
+	return parseURLPairs("cluster.members", c.Members)
+}
+
+// FaultsConfig mounts the fault-injection middleware and its /admin/faults
+// endpoint. Anyone who can reach the server can then make it fail, so it is
+// off by default and meant for test environments.
+type FaultsConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+}
+
+// AdmissionConfig enables the adaptive concurrency limiter. The limit starts
+// at InitialLimit and moves between MinLimit and MaxLimit with latency;
+// writes may only use WriteShare of it, so reads are shed last.
+type AdmissionConfig struct {
+	Enabled      bool    `yaml:"enabled" toml:"enabled"`
+	InitialLimit int     `yaml:"initial_limit" toml:"initial_limit"`
+	MinLimit     int     `yaml:"min_limit" toml:"min_limit"`
+	MaxLimit     int     `yaml:"max_limit" toml:"max_limit"`
+	WriteShare   float64 `yaml:"write_share" toml:"write_share"`
+}
+
+// Default returns the settings the server used before it was configurable.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     Duration(10 * time.Second),
+			WriteTimeout:    Duration(10 * time.Second),
+			IdleTimeout:     Duration(60 * time.Second),
+			ShutdownTimeout: Duration(10 * time.Second),
+			HTTP2:           true,
+		},
+		TLS:         TLSConfig{ClientAuth: "none", ReloadInterval: Duration(30 * time.Second)},
+		Store:       StoreConfig{Backend: "memory"},
+		Log:         LogConfig{Level: "info", Requests: true},
+		RateLimit:   RateLimitConfig{RPS: 0, Burst: 100},
+		Idempotency: IdempotencyConfig{TTL: Duration(24 * time.Hour)},
+		Tracing:     TracingConfig{Exporter: "none", File: "spans.jsonl"},
+		Replication: ReplicationConfig{Role: "none", FollowerWrites: "redirect"},
+		Raft:        RaftConfig{Tick: Duration(50 * time.Millisecond), ElectionTicks: 10, SnapshotThreshold: 1000},
+		Cluster:     ClusterConfig{VirtualNodes: 128},
+		Admission:   AdmissionConfig{InitialLimit: 20, MinLimit: 4, MaxLimit: 500, WriteShare: 0.8},
+	}
+}
+
+// Options are the command-line switches that control loading rather than
+// the server itself.
+type Options struct {
+	ConfigPath  string
+	PrintConfig bool
+}
+
+// Load builds a Config from args (normally os.Args[1:]) and the environment.
+func Load(args []string) (*Config, Options, error) {
+	var opts Options
+	cfg := Default()
+	binds := bindings(cfg)
+
+	fs := flag.NewFlagSet("product-api", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigPath, "config", os.Getenv(EnvPrefix+"CONFIG"), "path to a .yaml, .yml or .toml config file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration and exit")
+
+	// Flags are recorded during parsing and applied last so they win over
+	// the file and environment regardless of parse order.
+	raw := make(map[string]string)
+	for _, b := range binds {
+		name := b.flag
+		if bv, ok := b.value.(*boolValue); ok {
+			fs.BoolFunc(name, b.usage+" (default "+bv.String()+")", func(s string) error {
+				raw[name] = s
+				return nil
+			})
+			continue
+		}
+		fs.Func(name, b.usage+" (default "+b.value.String()+")", func(s string) error {
+			raw[name] = s
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+	if fs.NArg() > 0 {
+		return nil, opts, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if opts.ConfigPath != "" {
+		if err := decodeFile(opts.ConfigPath, cfg); err != nil {
+			return nil, opts, err
+		}
+	}
+	for _, b := range binds {
+		if v, ok := os.LookupEnv(b.env); ok {
+			if err := b.value.Set(v); err != nil {
+				return nil, opts, fmt.Errorf("%s: %w", b.env, err)
+			}
+		}
+	}
+	for _, b := range binds {
+		if v, ok := raw[b.flag]; ok {
+			if err := b.value.Set(v); err != nil {
+				return nil, opts, fmt.Errorf("-%s: %w", b.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, opts, err
+	}
+	return cfg, opts, nil
+}
+
+// Validate reports the first setting that the server can't run with.
+func (c *Config) Validate() error {
+	if c.Server.Addr == "" {
+		return fmt.Errorf("server.addr is required")
+	}
+	for name, d := range map[string]Duration{
+		"server.read_timeout":     c.Server.ReadTimeout,
+		"server.write_timeout":    c.Server.WriteTimeout,
+		"server.idle_timeout":     c.Server.IdleTimeout,
+		"server.shutdown_timeout": c.Server.ShutdownTimeout,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must be >= 0", name)
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	clientAuth, err := c.TLS.ClientAuthType()
+	if err != nil {
+		return err
+	}
+	if !c.TLS.Enabled() && (c.TLS.ClientCAFile != "" || clientAuth != tls.NoClientCert) {
+		return fmt.Errorf("tls.client_ca_file and tls.client_auth require tls.cert_file and tls.key_file")
+	}
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("tls.client_auth %q requires tls.client_ca_file", c.TLS.ClientAuth)
+	}
+	if c.TLS.Enabled() && c.TLS.ReloadInterval <= 0 {
+		return fmt.Errorf("tls.reload_interval must be > 0")
+	}
+	if c.Store.Backend != "memory" {
+		return fmt.Errorf("store.backend %q is not supported; memory is the only backend", c.Store.Backend)
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		return err
+	}
+	if c.RateLimit.RPS < 0 {
+		return fmt.Errorf("rate_limit.rps must be >= 0")
+	}
+	if c.RateLimit.RPS > 0 && c.RateLimit.Burst < 1 {
+		return fmt.Errorf("rate_limit.burst must be >= 1 when rate_limit.rps is set")
+	}
+	if c.Idempotency.TTL <= 0 {
+		return fmt.Errorf("idempotency.ttl must be > 0")
+	}
+	switch c.Replication.Role {
+	case "none", "leader":
+	case "follower":
+		u, err := url.Parse(c.Replication.LeaderURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("replication.leader_url must be an http(s) URL when replication.role is follower")
+		}
+	default:
+		return fmt.Errorf("replication.role %q is not one of none, leader, follower", c.Replication.Role)
+	}
+	switch c.Replication.FollowerWrites {
+	case "redirect", "forward":
+	default:
+		return fmt.Errorf("replication.follower_writes %q is not one of redirect, forward", c.Replication.FollowerWrites)
+	}
+	if c.Raft.Enabled() {
+		if c.Raft.ID < 0 {
+			return fmt.Errorf("raft.id must be >= 1")
+		}
+		if c.Replication.Role != "none" {
+			return fmt.Errorf("raft.id and replication.role are mutually exclusive")
+		}
+		peers, err := c.Raft.PeerURLs()
+		if err != nil {
+			return err
+		}
+		if _, ok := peers[uint64(c.Raft.ID)]; !ok {
+			return fmt.Errorf("raft.peers must include this node's id %d", c.Raft.ID)
+		}
+		if c.Raft.Secret == "" {
+			return fmt.Errorf("raft.secret is required, so that only members can send Raft messages")
+		}
+		if c.Raft.Tick <= 0 {
+			return fmt.Errorf("raft.tick must be > 0")
+		}
+		if c.Raft.ElectionTicks < 2 {
+			return fmt.Errorf("raft.election_ticks must be >= 2")
+		}
+		if c.Raft.SnapshotThreshold < 0 {
+			return fmt.Errorf("raft.snapshot_threshold must be >= 0")
+		}
+	}
+	if c.Cluster.Enabled() {
+		if c.Replication.Role != "none" || c.Raft.Enabled() {
+			return fmt.Errorf("cluster.node_id can't be combined with replication.role or raft.id")
+		}
+		members, err := c.Cluster.MemberURLs()
+		if err != nil {
+			return err
+		}
+		if _, ok := members[c.Cluster.NodeID]; !ok {
+			return fmt.Errorf("cluster.members must include this node's id %q", c.Cluster.NodeID)
+		}
+		if c.Cluster.VirtualNodes < 1 {
+			return fmt.Errorf("cluster.virtual_nodes must be >= 1")
+		}
+		if c.Cluster.Secret == "" {
+			return fmt.Errorf("cluster.secret is required, so that only members can change the membership or hand off products")
+		}
+	}
+	switch c.Tracing.Exporter {
+	case "none", "memory":
+	case "file":
+		if c.Tracing.File == "" {
+			return fmt.Errorf("tracing.file is required when tracing.exporter is file")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter %q is not one of none, file, memory", c.Tracing.Exporter)
+	}
+	if c.Admission.Enabled {
+		a := c.Admission
+		if a.MinLimit < 1 || a.InitialLimit < a.MinLimit || a.MaxLimit < a.InitialLimit {
+			return fmt.Errorf("admission limits must satisfy 1 <= min_limit <= initial_limit <= max_limit")
+		}
+		if a.WriteShare <= 0 || a.WriteShare > 1 {
+			return fmt.Errorf("admission.write_share must be in (0, 1]")
+		}
+	}
+	return nil
+}
+
+// SlogLevel converts Level ("debug", "info", "warn", "error") to a slog.Level.
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return 0, fmt.Errorf("log.level %q is not one of debug, info, warn, error", l.Level)
+	}
+	return level, nil
+}
+
+// Print writes the configuration as YAML.
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	if redacted.Raft.Secret != "" {
+		redacted.Raft.Secret = "REDACTED"
+	}
+	if redacted.Cluster.Secret != "" {
+		redacted.Cluster.Secret = "REDACTED"
+	}
+	out, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// --- Helpers ---
+
+// parseURLPairs parses "id=url,id=url" into a map, naming setting in errors.
+func parseURLPairs(setting, s string) (map[string]*url.URL, error) {
+	out := make(map[string]*url.URL)
+	for _, pair := range strings.Split(s, ",") {
+		id, rawURL, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%s entry %q is not id=url", setting, pair)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%s entry %q: url must be an http(s) URL", setting, pair)
+		}
+		if _, dup := out[id]; dup {
+			return nil, fmt.Errorf("%s lists id %s twice", setting, id)
+		}
+		out[id] = u
+	}
+	return out, nil
+}
+
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(data, cfg, yaml.Strict())
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (want .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// binding ties one setting to its flag name and environment variable.
+type binding struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func bindings(c *Config) []binding {
+	b := func(name, usage string, v flag.Value) binding {
+		env := EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		return binding{flag: name, env: env, usage: usage, value: v}
+	}
+	return []binding{
+		b("addr", "listen address", (*stringValue)(&c.Server.Addr)),
+		b("read-timeout", "maximum duration for reading a request", &c.Server.ReadTimeout),
+		b("write-timeout", "maximum duration for writing a response", &c.Server.WriteTimeout),
+		b("idle-timeout", "keep-alive idle timeout", &c.Server.IdleTimeout),
+		b("shutdown-timeout", "grace period for in-flight requests on shutdown", &c.Server.ShutdownTimeout),
+		b("http2", "serve HTTP/2 over TLS", (*boolValue)(&c.Server.HTTP2)),
+		b("h2c", "serve cleartext HTTP/2 (prior knowledge) on the plaintext listener", (*boolValue)(&c.Server.H2C)),
+		b("tls-cert-file", "PEM certificate; enables TLS together with -tls-key-file", (*stringValue)(&c.TLS.CertFile)),
+		b("tls-key-file", "PEM private key", (*stringValue)(&c.TLS.KeyFile)),
+		b("tls-client-ca-file", "PEM bundle of CAs trusted for client certificates", (*stringValue)(&c.TLS.ClientCAFile)),
+		b("tls-client-auth", "client certificate policy (none, request, verify-if-given, require)", (*stringValue)(&c.TLS.ClientAuth)),
+		b("tls-reload-interval", "how often to check certificate files for changes", &c.TLS.ReloadInterval),
+		b("store-backend", "where the catalog and inventory are kept (memory is the only backend)", (*stringValue)(&c.Store.Backend)),
+		b("log-level", "log level (debug, info, warn, error)", (*stringValue)(&c.Log.Level)),
+		b("log-requests", "log every request", (*boolValue)(&c.Log.Requests)),
+		b("rate-limit-rps", "global request rate limit, 0 disables", (*floatValue)(&c.RateLimit.RPS)),
+		b("rate-limit-burst", "token bucket burst size", (*intValue)(&c.RateLimit.Burst)),
+		b("idempotency-ttl", "how long Idempotency-Key responses are kept", &c.Idempotency.TTL),
+		b("tracing-exporter", "span exporter (none, file, memory)", (*stringValue)(&c.Tracing.Exporter)),
+		b("tracing-file", "JSON-lines file for the file exporter", (*stringValue)(&c.Tracing.File)),
+		b("replication-role", "replication role (none, leader, follower)", (*stringValue)(&c.Replication.Role)),
+		b("replication-leader-url", "leader base URL, e.g. http://10.0.1.5:8080 (followers only)", (*stringValue)(&c.Replication.LeaderURL)),
+		b("replication-follower-writes", "how followers handle writes (redirect, forward)", (*stringValue)(&c.Replication.FollowerWrites)),
+		b("raft-id", "this node's Raft ID, 0 disables Raft", (*intValue)(&c.Raft.ID)),
+		b("raft-peers", "every Raft member as id=url pairs, e.g. 1=http://10.0.1.5:8080,2=http://10.0.1.6:8080", (*stringValue)(&c.Raft.Peers)),
+		b("raft-secret", "shared secret Raft members authenticate their messages with", (*stringValue)(&c.Raft.Secret)),
+		b("raft-data-dir", "directory for Raft state, empty keeps it in memory", (*stringValue)(&c.Raft.DataDir)),
+		b("raft-tick", "Raft clock interval", &c.Raft.Tick),
+		b("raft-election-ticks", "minimum election timeout in ticks", (*intValue)(&c.Raft.ElectionTicks)),
+		b("raft-snapshot-threshold", "applied entries between log compactions, 0 disables snapshots", (*intValue)(&c.Raft.SnapshotThreshold)),
+		b("cluster-node-id", "this node's ID in a partitioned cluster, empty disables partitioning", (*stringValue)(&c.Cluster.NodeID)),
+		b("cluster-members", "initial members as id=url pairs, e.g. a=http://10.0.1.5:8080,b=http://10.0.1.6:8080", (*stringValue)(&c.Cluster.Members)),
+		b("cluster-virtual-nodes", "ring positions per member", (*intValue)(&c.Cluster.VirtualNodes)),
+		b("cluster-secret", "shared secret members and operators authenticate cluster requests with", (*stringValue)(&c.Cluster.Secret)),
+		b("faults-enabled", "serve /admin/faults and inject the faults configured there", (*boolValue)(&c.Faults.Enabled)),
+		b("admission-enabled", "shed requests beyond an adaptive concurrency limit", (*boolValue)(&c.Admission.Enabled)),
+		b("admission-initial-limit", "concurrency limit before any latency is observed", (*intValue)(&c.Admission.InitialLimit)),
+		b("admission-min-limit", "lowest the concurrency limit can fall", (*intValue)(&c.Admission.MinLimit)),
+		b("admission-max-limit", "highest the concurrency limit can rise", (*intValue)(&c.Admission.MaxLimit)),
+		b("admission-write-share", "fraction of the concurrency limit writes may use", (*floatValue)(&c.Admission.WriteShare)),
+	}
+}
+
+// Duration is a time.Duration that reads and writes as "10s" in config files.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error)  { return []byte(d.String()), nil }
+func (d *Duration) UnmarshalText(b []byte) error { return d.Set(string(b)) }
+
+type stringValue string
+
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+
+type boolValue bool
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(n)
+	return nil
+}
+
+type floatValue float64
+
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v = floatValue(f)
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with the given name and returns its path.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testYAML = `
+server:
+  addr: ":9000"
+  read_timeout: 3s
+log:
+  level: debug
+rate_limit:
+  rps: 50
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeConfig(t, "config.yaml", testYAML)
+	tomlFile := writeConfig(t, "config.toml", "[server]\naddr = \":9100\"\n[log]\nrequests = false\n")
+
+	type settings struct {
+		addr        string
+		readTimeout time.Duration
+		level       string
+		rps         float64
+		requests    bool
+	}
+	defaults := settings{":8080", 10 * time.Second, "info", 0, true}
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want settings
+	}{
+		{"defaults", nil, nil, defaults},
+		{"file over defaults", nil, []string{"-config", yamlFile},
+			settings{":9000", 3 * time.Second, "debug", 50, true}},
+		{"TOML file", nil, []string{"-config", tomlFile},
+			settings{":9100", 10 * time.Second, "info", 0, false}},
+		{"file named in the environment", map[string]string{"PRODUCT_API_CONFIG": yamlFile}, nil,
+			settings{":9000", 3 * time.Second, "debug", 50, true}},
+		{"environment over file", map[string]string{"PRODUCT_API_ADDR": ":9001", "PRODUCT_API_LOG_REQUESTS": "false"},
+			[]string{"-config", yamlFile},
+			settings{":9001", 3 * time.Second, "debug", 50, false}},
+		{"flags over environment", map[string]string{"PRODUCT_API_ADDR": ":9001", "PRODUCT_API_RATE_LIMIT_RPS": "7"},
+			[]string{"-config", yamlFile, "-addr", ":9002", "-read-timeout=1s", "-log-requests=false"},
+			settings{":9002", time.Second, "debug", 7, false}},
+		{"flags before the config flag still win", nil, []string{"-log-level", "warn", "-config", yamlFile},
+			settings{":9000", 3 * time.Second, "warn", 50, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, _, err := Load(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := settings{cfg.Server.Addr, time.Duration(cfg.Server.ReadTimeout), cfg.Log.Level, cfg.RateLimit.RPS, cfg.Log.Requests}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // written as config.yaml if set
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unknown flag", "", nil, []string{"-no-such-flag"}, "no-such-flag"},
+		{"extra argument", "", nil, []string{"serve"}, "unexpected arguments: serve"},
+		{"unknown file key", "server:\n  adress: \":9000\"\n", nil, nil, "adress"},
+		{"bad environment value", "", map[string]string{"PRODUCT_API_READ_TIMEOUT": "soon"}, nil, "PRODUCT_API_READ_TIMEOUT"},
+		{"bad flag value", "", nil, []string{"-rate-limit-burst", "many"}, "-rate-limit-burst"},
+		{"empty address", "", nil, []string{"-addr", ""}, "server.addr is required"},
+		{"other store backends", "", nil, []string{"-store-backend", "bolt"}, `store.backend "bolt" is not supported`},
+		{"unknown log level", "", map[string]string{"PRODUCT_API_LOG_LEVEL": "loud"}, nil, `log.level "loud"`},
+		{"certificate without a key", "", nil, []string{"-tls-cert-file", "cert.pem"}, "must be set together"},
+		{"burst with a rate limit", "", nil, []string{"-rate-limit-rps", "10", "-rate-limit-burst", "0"}, "rate_limit.burst"},
+		{"follower without a leader", "", nil, []string{"-replication-role", "follower"}, "replication.leader_url"},
+		{"raft without a secret", "", nil, []string{"-raft-id", "1", "-raft-peers", "1=http://a:8080"}, "raft.secret is required"},
+		{"raft peers without this node", "", nil,
+			[]string{"-raft-id", "2", "-raft-peers", "1=http://a:8080", "-raft-secret", "s"}, "must include this node's id 2"},
+		{"cluster without a secret", "", nil,
+			[]string{"-cluster-node-id", "a", "-cluster-members", "a=http://a:8080"}, "cluster.secret is required"},
+		{"cluster with raft", "", nil,
+			[]string{"-cluster-node-id", "a", "-cluster-members", "a=http://a:8080", "-cluster-secret", "s",
+				"-raft-id", "1", "-raft-peers", "1=http://a:8080", "-raft-secret", "s"}, "can't be combined"},
+		{"file exporter without a file", "", nil, []string{"-tracing-exporter", "file", "-tracing-file", ""}, "tracing.file is required"},
+		{"admission limits out of order", "", nil,
+			[]string{"-admission-enabled", "-admission-min-limit", "50", "-admission-initial-limit", "20"}, "admission limits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, "config.yaml", tt.file)}, args...)
+			}
+			_, _, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load(%q) = %v, want an error mentioning %q", args, err, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Load([]string{"-config", writeConfig(t, "config.json", "{}")}); err == nil || !strings.Contains(err.Error(), "unsupported extension") {
+		t.Errorf("a .json config file: %v, want unsupported extension", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg, _, err := Load([]string{"-cluster-node-id", "a", "-cluster-members", "a=http://a:8080", "-cluster-secret", "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), "REDACTED") {
+		t.Errorf("printed config doesn't hide the cluster secret:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "backend: memory") {
+		t.Errorf("printed config doesn't show the store backend:\n%s", out.String())
+	}
+}
@@ -2,4 +2,8 @@ module product-api
 
 go 1.24
 
-require github.com/go-chi/chi/v5 v5.1.0
+require (
+	github.com/go-chi/chi/v5 v5.1.0
+	github.com/goccy/go-yaml v1.18.0
+	github.com/pelletier/go-toml/v2 v2.2.4
+)
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"product-api/metrics"
+)
+
+// AdmissionLimits bound the adaptive concurrency limit.
+type AdmissionLimits struct {
+	Initial, Min, Max int
+	// WriteShare is the fraction of the limit that writes may use. Reads
+	// can use all of it, so under overload writes are shed first.
+	WriteShare float64
+}
+
+// Admission sheds requests with 503 and Retry-After once the number in
+// flight reaches an adaptive limit. The limit follows a latency gradient,
+// like Netflix's Gradient2: every sample window it is scaled by the ratio
+// of the long-run average latency to the window's latency, so it shrinks
+// as soon as requests start queueing and grows back by about sqrt(limit)
+// per window while latency stays flat.
+func Admission(limits AdmissionLimits, registry *metrics.Registry) func(http.Handler) http.Handler {
+	l := &concurrencyLimiter{
+		limit:       float64(limits.Initial),
+		min:         float64(limits.Min),
+		max:         float64(limits.Max),
+		writeShare:  limits.WriteShare,
+		windowStart: time.Now(),
+	}
+	shedReads := registry.Counter(`admission_shed_total{class="read"}`, "Requests rejected by the adaptive concurrency limiter.")
+	shedWrites := registry.Counter(`admission_shed_total{class="write"}`, "Requests rejected by the adaptive concurrency limiter.")
+	registry.GaugeFunc("admission_limit", "Current adaptive concurrency limit.", l.currentLimit)
+	registry.GaugeFunc("admission_in_flight", "Requests holding an admission slot.", l.currentInFlight)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isControlPlane(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			write := isMutating(r.Method)
+			if !l.acquire(write) {
+				if write {
+					shedWrites.Inc()
+				} else {
+					shedReads.Inc()
+				}
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, "OVERLOADED", "server is at its concurrency limit, retry later")
+				return
+			}
+			start := time.Now()
+			defer func() { l.release(time.Since(start)) }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const (
+	admissionWindow     = 100 * time.Millisecond
+	admissionMinSamples = 10
+	// Latency may grow this much over the long-run average before the
+	// limit starts to shrink.
+	admissionTolerance = 1.5
+	// Weights of the newest window in the long-run average and of the
+	// newly computed limit, so a single slow window moves neither far.
+	admissionLongSmoothing  = 0.05
+	admissionLimitSmoothing = 0.2
+)
+
+type concurrencyLimiter struct {
+	mu         sync.Mutex
+	limit      float64
+	min, max   float64
+	writeShare float64
+	inFlight   int
+
+	windowStart       time.Time
+	windowSum         time.Duration
+	windowSamples     int
+	windowMaxInFlight int
+	longRTT           float64 // seconds
+}
+
+// acquire takes a slot, or reports that the request must be shed.
+func (l *concurrencyLimiter) acquire(write bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit
+	if write {
+		limit *= l.writeShare
+	}
+	if l.inFlight >= max(int(limit), 1) {
+		return false
+	}
+	l.inFlight++
+	l.windowMaxInFlight = max(l.windowMaxInFlight, l.inFlight)
+	return true
+}
+
+// release frees a slot and feeds the request's latency to the limit.
+func (l *concurrencyLimiter) release(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.windowSum += rtt
+	l.windowSamples++
+	now := time.Now()
+	if now.Sub(l.windowStart) < admissionWindow || l.windowSamples < admissionMinSamples {
+		return
+	}
+
+	short := (l.windowSum / time.Duration(l.windowSamples)).Seconds()
+	switch {
+	case l.longRTT == 0 || short < l.longRTT:
+		// Faster windows are the better estimate of unloaded latency.
+		l.longRTT = short
+	default:
+		l.longRTT += (short - l.longRTT) * admissionLongSmoothing
+	}
+	gradient := max(0.5, min(1, admissionTolerance*l.longRTT/short))
+	next := l.limit * gradient
+	// Only probe upwards when the limit is what's holding traffic back.
+	if gradient == 1 && float64(l.windowMaxInFlight) >= l.limit/2 {
+		next += math.Sqrt(l.limit)
+	}
+	l.limit = max(l.min, min(l.max, l.limit+(next-l.limit)*admissionLimitSmoothing))
+
+	l.windowStart = now
+	l.windowSum = 0
+	l.windowSamples = 0
+	l.windowMaxInFlight = l.inFlight
+}
+
+func (l *concurrencyLimiter) currentLimit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *concurrencyLimiter) currentInFlight() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return float64(l.inFlight)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"product-api/models"
+	"product-api/store"
+	"product-api/tracing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type CategoryHandler struct {
+	Store    *store.CategoryStore
+	Products *store.ProductStore
+}
+
+func NewCategoryHandler(s *store.CategoryStore, products *store.ProductStore) *CategoryHandler {
+	return &CategoryHandler{Store: s, Products: products}
+}
+
+// ListCategories handles GET /categories
+// Responses: 200 (success)
+func (h *CategoryHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	_, span := tracing.Start(r.Context(), "store.ListCategories")
+	categories := h.Store.ListCategories()
+	span.End()
+
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// CreateCategory handles POST /categories
+// Responses: 201 (created), 400 (bad input)
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	category, ok := decodeCategory(w, r)
+	if !ok {
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.CreateCategory")
+	err := h.Store.CreateCategory(category)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/categories/%d", category.CategoryID))
+	writeJSON(w, http.StatusCreated, category)
+}
+
+// GetCategory handles GET /categories/{categoryId}
+// Responses: 200 (found), 400 (bad input), 404 (not found)
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := parseCategoryID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.GetCategory")
+	category, err := h.Store.GetCategory(categoryID)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, category)
+}
+
+// UpsertCategory handles PUT /categories/{categoryId}
+// Responses: 204 (success), 400 (bad input or cyclic parent)
+func (h *CategoryHandler) UpsertCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := parseCategoryID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	category, ok := decodeCategory(w, r)
+	if !ok {
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.UpsertCategory")
+	err = h.Store.UpsertCategory(categoryID, category)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteCategory handles DELETE /categories/{categoryId}
+// Responses: 204 (deleted), 400 (bad input), 404 (not found), 409 (still referenced)
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := parseCategoryID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.DeleteUnusedCategory")
+	err = h.Store.DeleteUnusedCategory(categoryID, h.Products)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListCategoryProducts handles GET /categories/{categoryId}/products?recursive=true
+// Responses: 200 (success), 400 (bad input), 404 (category not found)
+func (h *CategoryHandler) ListCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := parseCategoryID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	recursive := false
+	if v := r.URL.Query().Get("recursive"); v != "" {
+		recursive, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "recursive must be a boolean")
+			return
+		}
+	}
+
+	ids := []int{categoryID}
+	var span *tracing.Span
+	if recursive {
+		_, span = tracing.Start(r.Context(), "store.Subtree")
+		ids, err = h.Store.Subtree(categoryID)
+	} else {
+		_, span = tracing.Start(r.Context(), "store.GetCategory")
+		_, err = h.Store.GetCategory(categoryID)
+	}
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	_, span = tracing.Start(r.Context(), "store.ListProductsByCategory")
+	products := h.Products.ListProductsByCategory(ids)
+	span.End()
+
+	writeJSON(w, http.StatusOK, products)
+}
+
+// --- Helpers ---
+
+func parseCategoryID(r *http.Request) (int, error) {
+	idStr := chi.URLParam(r, "categoryId")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, fmt.Errorf("categoryId must be an integer")
+	}
+	if id < 1 {
+		return 0, fmt.Errorf("categoryId must be >= 1")
+	}
+	return id, nil
+}
+
+func decodeCategory(w http.ResponseWriter, r *http.Request) (*models.Category, bool) {
+	var category models.Category
+	_, span := tracing.Start(r.Context(), "decode")
+	err := json.NewDecoder(r.Body).Decode(&category)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return nil, false
+	}
+
+	_, span = tracing.Start(r.Context(), "validate")
+	err = validateCategory(&category)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return nil, false
+	}
+	return &category, true
+}
+
+func validateCategory(c *models.Category) error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(c.Name) > 200 {
+		return fmt.Errorf("name must be at most 200 characters")
+	}
+	if c.ParentID != nil && *c.ParentID < 1 {
+		return fmt.Errorf("parent_id must be >= 1")
+	}
+	return nil
+}
+
+// writeStoreError maps the store's sentinel errors onto HTTP responses.
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, store.ErrConflict):
+		writeError(w, http.StatusConflict, "CONFLICT", err.Error())
+	case errors.Is(err, store.ErrInvalid):
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
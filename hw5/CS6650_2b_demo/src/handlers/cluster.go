@@ -0,0 +1,611 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"product-api/cluster"
+	"product-api/metrics"
+	"product-api/models"
+	"product-api/store"
+	"product-api/tracing"
+)
+
+const (
+	// clusterForwardedHeader marks a request sent by another member, which
+	// must also carry the cluster secret; it is always served locally so a
+	// disagreement about ownership can't loop.
+	clusterForwardedHeader = "X-Cluster-Forwarded"
+	// clusterNodeHeader names the member that served the response.
+	clusterNodeHeader = "X-Cluster-Node"
+	// categoryCoordinatorKey is hashed to pick the member that serializes
+	// category writes and fans them out to everyone else.
+	categoryCoordinatorKey = "categories"
+	// handoffBatch caps the products sent in one POST /cluster/handoff.
+	handoffBatch = 500
+)
+
+type ClusterHandler struct {
+	Cluster    *cluster.Cluster
+	Secret     string
+	Products   *store.ProductStore
+	Categories *store.CategoryStore
+	Inventory  *store.InventoryStore
+
+	client    *http.Client
+	proxy     *httputil.ReverseProxy
+	rebalance sync.Mutex
+	// moving is held for reading while a product or reservation request
+	// is served locally and for writing while a batch of products is
+	// copied to its new owner and deleted here, so that no write lands in
+	// between and is lost.
+	moving sync.RWMutex
+
+	proxied   *metrics.Counter
+	handedOff *metrics.Counter
+}
+
+type proxyTargetKey struct{}
+
+// NewClusterHandler numbers inventory's reservations by product, so that
+// reservation requests can be sent to the product's owner. Members send
+// each other secret as a bearer token.
+func NewClusterHandler(c *cluster.Cluster, secret string, products *store.ProductStore, categories *store.CategoryStore, inventory *store.InventoryStore, registry *metrics.Registry) *ClusterHandler {
+	inventory.NumberReservationsByProduct()
+	h := &ClusterHandler{
+		Cluster:    c,
+		Secret:     secret,
+		Products:   products,
+		Categories: categories,
+		Inventory:  inventory,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		proxied:    registry.Counter("cluster_proxied_requests_total", "Requests forwarded to the member that owns them."),
+		handedOff:  registry.Counter("cluster_handoff_products_total", "Products moved to a new owner after a membership change."),
+	}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(pr.In.Context().Value(proxyTargetKey{}).(*url.URL))
+			pr.Out.Header.Set(clusterForwardedHeader, c.Self())
+			pr.Out.Header.Set("Authorization", "Bearer "+h.Secret)
+			if span := tracing.SpanFromContext(pr.In.Context()); span != nil {
+				pr.Out.Header.Set("traceparent", span.SpanContext().Traceparent())
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, http.StatusBadGateway, "OWNER_UNAVAILABLE", "could not reach the owning node: "+err.Error())
+		},
+	}
+	registry.GaugeFunc("cluster_members", "Members in the current ring.", func() float64 {
+		_, members := c.Members()
+		return float64(len(members))
+	})
+	return h
+}
+
+// ClusterRouting sends each request to the member responsible for it.
+// Product and reservation routes go to the product's owner on the ring,
+// since its inventory lives with it; category writes go
+// to the category coordinator, which applies them and copies them to every
+// member; category product listings are gathered from all members.
+// Requests forwarded by another member are served locally, once they show
+// the cluster secret.
+func ClusterRouting(h *ClusterHandler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(clusterNodeHeader, h.Cluster.Self())
+			forwarded := r.Header.Get(clusterForwardedHeader) != ""
+			if forwarded && !hasBearer(r, h.Secret) {
+				writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "forwarded requests must carry the cluster secret")
+				return
+			}
+
+			productID, ok := productIDFromPath(r.URL.Path)
+			if !ok {
+				productID, ok = productIDFromReservationPath(r.URL.Path)
+			}
+			if ok {
+				h.serveProduct(w, r, next, productID, forwarded)
+				return
+			}
+			if forwarded {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Path == "/categories" || strings.HasPrefix(r.URL.Path, "/categories/") {
+				switch {
+				case isMutating(r.Method):
+					coordinator, u := h.Cluster.OwnerOf(categoryCoordinatorKey)
+					if coordinator != "" && coordinator != h.Cluster.Self() {
+						h.forward(w, r, u)
+						return
+					}
+					h.categoryWrite(w, r, next)
+					return
+				case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/products"):
+					h.gatherCategoryProducts(w, r, next)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetRing handles GET /cluster/ring?ranges=true&product_id=
+// Returns membership, each member's share of the hash space and, on
+// request, the ring's ranges and the owner of one product.
+// Responses: 200, 400 (bad input)
+func (h *ClusterHandler) GetRing(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	withRanges := false
+	if v := q.Get("ranges"); v != "" {
+		var err error
+		withRanges, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "ranges must be a boolean")
+			return
+		}
+	}
+
+	resp := struct {
+		cluster.Status
+		ProductID *int   `json:"product_id,omitempty"`
+		Owner     string `json:"owner,omitempty"`
+	}{Status: h.Cluster.Status(withRanges)}
+	if v := q.Get("product_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "product_id must be an integer >= 1")
+			return
+		}
+		resp.ProductID = &id
+		resp.Owner, _ = h.Cluster.Owner(id)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// membershipRequest is the body of PUT /cluster/members. Operators send only
+// Members; the receiving node adds Version and the category tree when it
+// passes the change on to the other members.
+type membershipRequest struct {
+	Version        uint64            `json:"version,omitempty"`
+	Members        map[string]string `json:"members"`
+	Categories     []models.Category `json:"categories,omitempty"`
+	NextCategoryID int               `json:"next_category_id,omitempty"`
+}
+
+// PutMembers handles PUT /cluster/members
+// Replaces the membership. The node that receives the change gives it the
+// next version and sends it to every old and new member; each member then
+// hands off the products it no longer owns.
+// Members and operators must send the cluster secret as a bearer token.
+// Responses: 200 (applied), 400 (bad input), 401 (wrong or missing secret), 409 (stale version)
+func (h *ClusterHandler) PutMembers(w http.ResponseWriter, r *http.Request) {
+	if !hasBearer(r, h.Secret) {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "membership changes must carry the cluster secret")
+		return
+	}
+	var req membershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return
+	}
+	members, err := parseMembers(req.Members)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	if r.Header.Get(clusterForwardedHeader) != "" {
+		if !h.Cluster.Apply(req.Version, members) {
+			writeError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("membership version %d is not newer than the current one", req.Version))
+			return
+		}
+		// A node joining with an empty category tree adopts the sender's.
+		if len(h.Categories.ListCategories()) == 0 && len(req.Categories) > 0 {
+			h.Categories.Restore(req.Categories, req.NextCategoryID)
+		}
+	} else {
+		_, old := h.Cluster.Members()
+		req.Version = h.Cluster.Next(members)
+		req.Categories, req.NextCategoryID = h.Categories.Snapshot()
+		for id, u := range members {
+			old[id] = u
+		}
+		delete(old, h.Cluster.Self())
+		h.broadcastMembers(r.Context(), req, old)
+	}
+
+	go h.Rebalance()
+	writeJSON(w, http.StatusOK, h.Cluster.Status(false))
+}
+
+// handoffRequest is the body of POST /cluster/handoff: products together
+// with their stock and outstanding reservations.
+type handoffRequest struct {
+	Products     []models.Product     `json:"products"`
+	Inventory    []models.Inventory   `json:"inventory,omitempty"`
+	Reservations []models.Reservation `json:"reservations,omitempty"`
+}
+
+// Handoff handles POST /cluster/handoff
+// Accepts products, with their inventory, from a member that no longer
+// owns them. They were validated when first written, so they are stored
+// as-is. The sender must send the cluster secret as a bearer token.
+// Responses: 204, 400 (bad input), 401 (wrong or missing secret)
+func (h *ClusterHandler) Handoff(w http.ResponseWriter, r *http.Request) {
+	if !hasBearer(r, h.Secret) {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "handoffs must carry the cluster secret")
+		return
+	}
+	var body handoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return
+	}
+	for i := range body.Products {
+		p := body.Products[i]
+		h.Products.UpsertProduct(p.ProductID, &p)
+	}
+	reservations := make(map[int][]models.Reservation)
+	for _, res := range body.Reservations {
+		reservations[res.ProductID] = append(reservations[res.ProductID], res)
+	}
+	for _, inv := range body.Inventory {
+		h.Inventory.ImportProduct(inv, reservations[inv.ProductID])
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Rebalance sends every local product this node no longer owns, with its
+// inventory, to its owner and deletes the local copy once the owner has
+// it.
+func (h *ClusterHandler) Rebalance() {
+	h.rebalance.Lock()
+	defer h.rebalance.Unlock()
+
+	byOwner := make(map[string][]int)
+	for _, p := range h.Products.Snapshot() {
+		if owner, _ := h.Cluster.Owner(p.ProductID); owner != "" && owner != h.Cluster.Self() {
+			byOwner[owner] = append(byOwner[owner], p.ProductID)
+		}
+	}
+
+	_, members := h.Cluster.Members()
+	for owner, ids := range byOwner {
+		for start := 0; start < len(ids); start += handoffBatch {
+			batch := ids[start:min(start+handoffBatch, len(ids))]
+			n, err := h.handoff(owner, members[owner], batch)
+			if err != nil {
+				slog.Warn("cluster handoff failed", "to", owner, "products", len(batch), "err", err)
+				break
+			}
+			h.handedOff.Add(uint64(n))
+		}
+	}
+}
+
+// StartRebalance re-runs Rebalance every interval, picking up writes that
+// reached a node just before it learned about a membership change.
+func (h *ClusterHandler) StartRebalance(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				h.Rebalance()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// --- Helpers ---
+
+// serveProduct sends a product or reservation request to the product's
+// owner, or serves it here if this node owns the product or another member
+// forwarded the request. Ownership is decided under the moving lock, so a
+// request that waited for a handoff goes to the product's new owner.
+func (h *ClusterHandler) serveProduct(w http.ResponseWriter, r *http.Request, next http.Handler, productID int, forwarded bool) {
+	h.moving.RLock()
+	if !forwarded {
+		if owner, u := h.Cluster.Owner(productID); owner != "" && owner != h.Cluster.Self() {
+			h.moving.RUnlock()
+			h.forward(w, r, u)
+			return
+		}
+	}
+	defer h.moving.RUnlock()
+	next.ServeHTTP(w, r)
+}
+
+func (h *ClusterHandler) forward(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	h.proxied.Inc()
+	// The owner names itself in the response.
+	w.Header().Del(clusterNodeHeader)
+	h.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyTargetKey{}, target)))
+}
+
+// categoryWrite applies a category write on the coordinator and, if it
+// succeeded, repeats it on every other member. Creates are repeated as a
+// PUT of the assigned ID so every member stores the same category.
+func (h *ClusterHandler) categoryWrite(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "could not read request body: "+err.Error())
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Products live on many members, so a delete must check all of them.
+	if r.Method == http.MethodDelete {
+		n, err := h.countRemoteProducts(r.Context(), r.URL.Path+"/products")
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "OWNER_UNAVAILABLE", err.Error())
+			return
+		}
+		if n > 0 {
+			writeError(w, http.StatusConflict, "CONFLICT", fmt.Sprintf("category is referenced by %d product(s) on other nodes", n))
+			return
+		}
+	}
+
+	rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(rw, r)
+	if rw.status < 200 || rw.status > 299 {
+		return
+	}
+
+	method, path := r.Method, r.URL.Path
+	if r.Method == http.MethodPost {
+		method, path, body = http.MethodPut, w.Header().Get("Location"), rw.body.Bytes()
+	}
+	_, members := h.Cluster.Members()
+	delete(members, h.Cluster.Self())
+	h.fanOut(r.Context(), members, func(id string, u *url.URL) error {
+		resp, err := h.send(r.Context(), method, u.JoinPath(path).String(), body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s returned %s", id, resp.Status)
+		}
+		return nil
+	})
+}
+
+// gatherCategoryProducts answers GET /categories/{id}/products by merging
+// the local result with every other member's.
+func (h *ClusterHandler) gatherCategoryProducts(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	local := newBufferedResponse()
+	next.ServeHTTP(local, r)
+	if local.status != http.StatusOK {
+		local.copyTo(w)
+		return
+	}
+	var products []models.Product
+	if err := json.Unmarshal(local.body.Bytes(), &products); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	remote, err := h.remoteProducts(r.Context(), r.URL.RequestURI())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "OWNER_UNAVAILABLE", err.Error())
+		return
+	}
+	products = append(products, remote...)
+	sort.Slice(products, func(i, j int) bool { return products[i].ProductID < products[j].ProductID })
+	writeJSON(w, http.StatusOK, products)
+}
+
+func (h *ClusterHandler) countRemoteProducts(ctx context.Context, uri string) (int, error) {
+	products, err := h.remoteProducts(ctx, uri)
+	return len(products), err
+}
+
+// remoteProducts GETs uri, which must return a product list, from every
+// other member and concatenates the results.
+func (h *ClusterHandler) remoteProducts(ctx context.Context, uri string) ([]models.Product, error) {
+	_, members := h.Cluster.Members()
+	delete(members, h.Cluster.Self())
+
+	var mu sync.Mutex
+	var out []models.Product
+	err := h.fanOut(ctx, members, func(id string, u *url.URL) error {
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return err
+		}
+		resp, err := h.send(ctx, http.MethodGet, u.ResolveReference(ref).String(), nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			// The category hasn't reached this member yet, so neither have its products.
+			return nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s", id, resp.Status)
+		}
+		var products []models.Product
+		if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		mu.Lock()
+		out = append(out, products...)
+		mu.Unlock()
+		return nil
+	})
+	return out, err
+}
+
+func (h *ClusterHandler) broadcastMembers(ctx context.Context, req membershipRequest, to map[string]*url.URL) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		slog.Error("encoding membership", "err", err)
+		return
+	}
+	h.fanOut(ctx, to, func(id string, u *url.URL) error {
+		resp, err := h.send(ctx, http.MethodPut, u.JoinPath("/cluster/members").String(), body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s", id, resp.Status)
+		}
+		return nil
+	})
+}
+
+// handoff copies the products in ids that owner still owns, as they are
+// now and with their inventory, to owner at target, then deletes them
+// here. Product requests wait while it runs. It returns how many products
+// moved.
+func (h *ClusterHandler) handoff(owner string, target *url.URL, ids []int) (int, error) {
+	if target == nil {
+		return 0, fmt.Errorf("owner has no URL")
+	}
+	h.moving.Lock()
+	defer h.moving.Unlock()
+
+	var req handoffRequest
+	for _, id := range ids {
+		if o, _ := h.Cluster.Owner(id); o != owner {
+			continue // the membership changed again; the next run sends it
+		}
+		p, err := h.Products.GetProduct(id)
+		if err != nil {
+			continue // deleted since the snapshot
+		}
+		req.Products = append(req.Products, *p)
+		if inv, reservations := h.Inventory.ExportProduct(id); inv != nil {
+			req.Inventory = append(req.Inventory, *inv)
+			req.Reservations = append(req.Reservations, reservations...)
+		}
+	}
+	if len(req.Products) == 0 {
+		return 0, nil
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := h.send(context.Background(), http.MethodPost, target.JoinPath("/cluster/handoff").String(), body)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, fmt.Errorf("handoff returned %s", resp.Status)
+	}
+	for _, p := range req.Products {
+		h.Products.DeleteProduct(p.ProductID)
+		h.Inventory.RemoveProduct(p.ProductID)
+	}
+	return len(req.Products), nil
+}
+
+// fanOut runs fn for every member concurrently, logs each failure and
+// returns the first one.
+func (h *ClusterHandler) fanOut(ctx context.Context, members map[string]*url.URL, fn func(id string, u *url.URL) error) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(members))
+	for id, u := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(id, u); err != nil {
+				slog.Warn("cluster request failed", "member", id, "err", err)
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func (h *ClusterHandler) send(ctx context.Context, method, target string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(clusterForwardedHeader, h.Cluster.Self())
+	req.Header.Set("Authorization", "Bearer "+h.Secret)
+	if span := tracing.SpanFromContext(ctx); span != nil {
+		req.Header.Set("traceparent", span.SpanContext().Traceparent())
+	}
+	return h.client.Do(req)
+}
+
+// productIDFromPath extracts the ID from /products/{productId}[/...].
+func productIDFromPath(path string) (int, bool) {
+	rest, ok := strings.CutPrefix(path, "/products/")
+	if !ok {
+		return 0, false
+	}
+	segment, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(segment)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+	return id, true
+}
+
+// productIDFromReservationPath extracts the product from
+// /reservations/{reservationId}[/...], for reservations numbered by product.
+func productIDFromReservationPath(path string) (int, bool) {
+	rest, ok := strings.CutPrefix(path, "/reservations/")
+	if !ok {
+		return 0, false
+	}
+	segment, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(segment)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+	productID := store.ReservationProduct(id)
+	return productID, productID >= 1
+}
+
+func parseMembers(in map[string]string) (map[string]*url.URL, error) {
+	if len(in) == 0 {
+		return nil, fmt.Errorf("members must list at least one node")
+	}
+	out := make(map[string]*url.URL, len(in))
+	for id, raw := range in {
+		if id == "" {
+			return nil, fmt.Errorf("member IDs must not be empty")
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("member %q: url must be an http(s) URL", id)
+		}
+		out[id] = u
+	}
+	return out, nil
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"product-api/cluster"
+	"product-api/metrics"
+	"product-api/models"
+	"product-api/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const testClusterSecret = "s3cret"
+
+// clusterNode is one member of a test cluster, served by httptest.
+type clusterNode struct {
+	*ClusterHandler
+	srv *httptest.Server
+}
+
+// startClusterNodes starts a node for every ID, routed as main.go does.
+// members returns each node's initial membership from the nodes' URLs.
+func startClusterNodes(t *testing.T, ids []string, members func(urls map[string]*url.URL, id string) map[string]*url.URL) map[string]*clusterNode {
+	t.Helper()
+	routers := make(map[string]*chi.Mux)
+	urls := make(map[string]*url.URL)
+	nodes := make(map[string]*clusterNode)
+	for _, id := range ids {
+		routers[id] = chi.NewRouter()
+		router := routers[id]
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { router.ServeHTTP(w, r) }))
+		t.Cleanup(srv.Close)
+		urls[id], _ = url.Parse(srv.URL)
+		nodes[id] = &clusterNode{srv: srv}
+	}
+	for _, id := range ids {
+		products := store.NewProductStore()
+		categories := store.NewCategoryStore()
+		inventory := store.NewInventoryStore()
+		h := NewClusterHandler(cluster.New(id, members(urls, id), 64), testClusterSecret, products, categories, inventory, metrics.NewRegistry())
+		inventoryHandler := NewInventoryHandler(inventory, products)
+
+		r := routers[id]
+		r.Use(ClusterRouting(h))
+		r.Put("/cluster/members", h.PutMembers)
+		r.Post("/cluster/handoff", h.Handoff)
+		r.Get("/products/{productId}", NewProductHandler(products, categories).GetProduct)
+		r.Get("/products/{productId}/inventory", inventoryHandler.GetInventory)
+		r.Post("/products/{productId}/reservations", inventoryHandler.Reserve)
+		nodes[id].ClusterHandler = h
+	}
+	return nodes
+}
+
+func clusterRequest(t *testing.T, method, target, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestClusterRequestsNeedTheSecret(t *testing.T) {
+	nodes := startClusterNodes(t, []string{"a"}, func(urls map[string]*url.URL, _ string) map[string]*url.URL { return urls })
+	a := nodes["a"]
+	a.Products.UpsertProduct(1, &models.Product{ProductID: 1, SKU: "s", Manufacturer: "m", CategoryID: 1, SomeOtherID: 1})
+
+	bearer := func(token string) map[string]string { return map[string]string{"Authorization": "Bearer " + token} }
+	forwarded := func(token string) map[string]string {
+		return map[string]string{clusterForwardedHeader: "b", "Authorization": "Bearer " + token}
+	}
+	members := `{"members":{"a":"` + a.srv.URL + `"}}`
+	tests := []struct {
+		name, method, path, body string
+		header                   map[string]string
+		status                   int
+	}{
+		{"membership without a token", "PUT", "/cluster/members", members, nil, http.StatusUnauthorized},
+		{"membership with the wrong token", "PUT", "/cluster/members", members, bearer("guess"), http.StatusUnauthorized},
+		{"membership with the secret", "PUT", "/cluster/members", members, bearer(testClusterSecret), http.StatusOK},
+		{"handoff without a token", "POST", "/cluster/handoff", `{"products":[]}`, nil, http.StatusUnauthorized},
+		{"handoff with the secret", "POST", "/cluster/handoff", `{"products":[]}`, bearer(testClusterSecret), http.StatusNoContent},
+		{"forwarded without a token", "GET", "/products/1", "", map[string]string{clusterForwardedHeader: "b"}, http.StatusUnauthorized},
+		{"forwarded with the wrong token", "GET", "/categories", "", forwarded("guess"), http.StatusUnauthorized},
+		{"forwarded with the secret", "GET", "/products/1", "", forwarded(testClusterSecret), http.StatusOK},
+		{"client request", "GET", "/products/1", "", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp := clusterRequest(t, tt.method, a.srv.URL+tt.path, tt.body, tt.header); resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+// TestRebalanceKeepsConcurrentReservations reserves stock through the old
+// owner, some of it forwarded by a member with an outdated ring, while
+// about half its products move to a new member. Every reservation that
+// succeeded must still be held by the product's new owner.
+func TestRebalanceKeepsConcurrentReservations(t *testing.T) {
+	const products = 200
+	nodes := startClusterNodes(t, []string{"a", "b"}, func(urls map[string]*url.URL, id string) map[string]*url.URL {
+		if id == "a" {
+			return map[string]*url.URL{"a": urls["a"]}
+		}
+		return urls
+	})
+	a, b := nodes["a"], nodes["b"]
+	for id := 1; id <= products; id++ {
+		a.Products.UpsertProduct(id, &models.Product{ProductID: id, SKU: "s", Manufacturer: "m", CategoryID: 1, SomeOtherID: 1})
+		if _, err := a.Inventory.SetStock(id, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reserved atomic.Int64
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range products {
+				id := 1 + (i+worker*25)%products
+				req, _ := http.NewRequest("POST", a.srv.URL+"/products/"+strconv.Itoa(id)+"/reservations", strings.NewReader(`{"quantity":1}`))
+				if i%2 == 1 {
+					// Sent by a member that hasn't heard of b yet, so a
+					// serves it whoever owns the product now.
+					req.Header.Set(clusterForwardedHeader, "c")
+					req.Header.Set("Authorization", "Bearer "+testClusterSecret)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusCreated {
+					reserved.Add(1)
+				}
+			}
+		}()
+	}
+	members := `{"members":{"a":"` + a.srv.URL + `","b":"` + b.srv.URL + `"}}`
+	if resp := clusterRequest(t, "PUT", a.srv.URL+"/cluster/members", members, map[string]string{"Authorization": "Bearer " + testClusterSecret}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /cluster/members: status %d", resp.StatusCode)
+	}
+	wg.Wait()
+	// Finish the rebalance PUT started and pick up anything it missed.
+	a.Rebalance()
+
+	var held int64
+	moved := 0
+	for id := 1; id <= products; id++ {
+		owner, _ := a.Cluster.Owner(id)
+		if owner == "b" {
+			moved++
+		}
+		for _, n := range nodes {
+			_, err := n.Products.GetProduct(id)
+			if has := err == nil; has != (n.Cluster.Self() == owner) {
+				t.Errorf("product %d: on %s is %v, owner is %s", id, n.Cluster.Self(), has, owner)
+			}
+		}
+		resp, err := http.Get(a.srv.URL + "/products/" + strconv.Itoa(id) + "/inventory")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var inv models.Inventory
+		err = json.NewDecoder(resp.Body).Decode(&inv)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("product %d: %v", id, err)
+		}
+		if inv.OnHand != 10 || inv.Available != inv.OnHand-inv.Reserved {
+			t.Errorf("product %d: inventory %+v", id, inv)
+		}
+		held += int64(inv.Reserved)
+	}
+	if moved == 0 || moved == products {
+		t.Fatalf("%d of %d products moved to b; the test needs some to stay", moved, products)
+	}
+	if held != reserved.Load() {
+		t.Errorf("owners hold %d reserved units, but %d reservations succeeded", held, reserved.Load())
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import "strings"
+
+// controlPlanePrefixes are the paths that carry operator and cluster
+// traffic or are too cheap to matter. Rate limiting, admission control and
+// fault injection all let them through: shedding a Raft heartbeat would
+// make overload worse, not better, and a bad fault rule must stay
+// removable.
+var controlPlanePrefixes = []string{"/metrics", "/admin/", "/debug/", "/raft/", "/replication/", "/cluster/"}
+
+// isControlPlane reports whether path is under one of controlPlanePrefixes.
+func isControlPlane(path string) bool {
+	return hasPathPrefix(path, controlPlanePrefixes)
+}
+
+// hasPathPrefix reports whether path starts with any of prefixes.
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
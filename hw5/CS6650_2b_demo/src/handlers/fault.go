@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"product-api/models"
+	"product-api/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type FaultHandler struct {
+	Store *store.FaultStore
+}
+
+func NewFaultHandler(s *store.FaultStore) *FaultHandler {
+	return &FaultHandler{Store: s}
+}
+
+type faultRulesBody struct {
+	Rules []models.FaultRule `json:"rules"`
+}
+
+// ListFaults handles GET /admin/faults
+// Responses: 200 (rules in the order they are tried, with counters)
+func (h *FaultHandler) ListFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, faultRulesBody{Rules: h.Store.ListRules()})
+}
+
+// AddFault handles POST /admin/faults
+// Responses: 201 (added after the existing rules), 400 (bad input)
+func (h *FaultHandler) AddFault(w http.ResponseWriter, r *http.Request) {
+	var rule models.FaultRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return
+	}
+
+	added, err := h.Store.AddRule(rule)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/admin/faults/%d", added.ID))
+	writeJSON(w, http.StatusCreated, added)
+}
+
+// ReplaceFaults handles PUT /admin/faults
+// Responses: 200 (every rule replaced), 400 (bad input; nothing changed)
+func (h *FaultHandler) ReplaceFaults(w http.ResponseWriter, r *http.Request) {
+	var body faultRulesBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return
+	}
+
+	rules, err := h.Store.ReplaceRules(body.Rules)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, faultRulesBody{Rules: rules})
+}
+
+// ClearFaults handles DELETE /admin/faults
+// Responses: 204 (every rule removed)
+func (h *FaultHandler) ClearFaults(w http.ResponseWriter, r *http.Request) {
+	h.Store.ReplaceRules(nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteFault handles DELETE /admin/faults/{faultId}
+// Responses: 204 (removed), 400 (bad input), 404 (no such rule)
+func (h *FaultHandler) DeleteFault(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "faultId"))
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "faultId must be a positive integer")
+		return
+	}
+
+	if err := h.Store.DeleteRule(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Faults injects the first matching rule's latency and fault into the
+// requested percentage of requests. Control-plane requests, /admin/faults
+// among them, are exempt.
+func Faults(s *store.FaultStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isControlPlane(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rule, ok := s.Pick(func(rule *models.FaultRule) bool { return faultMatches(rule, r) }, rand.Float64()*100)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if rule.LatencyMs > 0 {
+				select {
+				case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			switch rule.Fault {
+			case models.FaultError:
+				writeError(w, rule.Status, "FAULT_INJECTED", fmt.Sprintf("fault injected by rule %d", rule.ID))
+			case models.FaultReset:
+				resetConnection(w)
+			case models.FaultTruncate:
+				res := newBufferedResponse()
+				next.ServeHTTP(res, r)
+				for k, v := range res.header {
+					w.Header()[k] = v
+				}
+				body := res.body.Bytes()
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.WriteHeader(res.status)
+				w.Write(body[:len(body)/2])
+				http.NewResponseController(w).Flush()
+				// Abort before the promised Content-Length is reached, so the
+				// client sees an unexpected EOF rather than a short body.
+				panic(http.ErrAbortHandler)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// --- Helpers ---
+
+func faultMatches(rule *models.FaultRule, r *http.Request) bool {
+	if rule.Method != "" && rule.Method != r.Method {
+		return false
+	}
+	if rule.Header != "" {
+		values, ok := r.Header[rule.Header]
+		if !ok || (rule.HeaderValue != "" && !slices.Contains(values, rule.HeaderValue)) {
+			return false
+		}
+	}
+	return rule.Route == "" || routeMatches(rule.Route, r.URL.Path)
+}
+
+// routeMatches compares a chi-style pattern with a path segment by segment.
+// {name} matches any one segment and a final * matches the rest.
+func routeMatches(pattern, path string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range ps {
+		if p == "*" && i == len(ps)-1 {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if !(strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}")) && p != segs[i] {
+			return false
+		}
+	}
+	return len(ps) == len(segs)
+}
+
+// resetConnection drops the client's connection with a TCP RST when the
+// connection can be taken over, and otherwise aborts the response (e.g. an
+// HTTP/2 stream).
+func resetConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"product-api/store"
+)
+
+// maxIdempotentBody caps how much of a request body is buffered for fingerprinting.
+const maxIdempotentBody = 1 << 20
+
+// Idempotency replays the stored response for mutating requests that repeat
+// an Idempotency-Key. Requests without the header, and GET/HEAD/OPTIONS,
+// pass straight through.
+func Idempotency(s *store.IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "INVALID_INPUT", "could not read request body: "+err.Error())
+				return
+			}
+			if len(body) > maxIdempotentBody {
+				writeError(w, http.StatusRequestEntityTooLarge, "INVALID_INPUT", "request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			rec, err := s.Begin(key, fingerprint(r, body))
+			switch {
+			case errors.Is(err, store.ErrInvalid):
+				writeError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", err.Error())
+				return
+			case errors.Is(err, store.ErrConflict):
+				writeError(w, http.StatusConflict, "CONFLICT", err.Error())
+				return
+			case err != nil:
+				writeStoreError(w, err)
+				return
+			case rec != nil:
+				replay(w, rec)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				// Server errors and panics are not cached so the client can
+				// retry. Nor are redirects to the leader: the write hasn't
+				// happened, and a retry should go wherever the leader is then.
+				if p := recover(); p != nil {
+					s.Abandon(key)
+					panic(p)
+				}
+				if rw.status >= 500 || rw.status >= 300 && rw.status < 400 {
+					s.Abandon(key)
+					return
+				}
+				s.Complete(key, rw.status, w.Header().Clone(), rw.body.Bytes())
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// --- Helpers ---
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.RequestURI())
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec *store.IdempotencyRecord) {
+	for k, v := range rec.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recordingWriter passes the response through while keeping a copy for replay.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = status
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
+// bufferedResponse captures a response in memory so it can be looked at,
+// or kept, before anything is sent: a Raft command's result, a local
+// result to merge with other members', a body to truncate.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (br *bufferedResponse) Header() http.Header         { return br.header }
+func (br *bufferedResponse) WriteHeader(status int)      { br.status = status }
+func (br *bufferedResponse) Write(b []byte) (int, error) { return br.body.Write(b) }
+
+// copyTo sends the captured response to w.
+func (br *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for k, v := range br.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(br.status)
+	w.Write(br.body.Bytes())
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"product-api/store"
+	"product-api/tracing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type InventoryHandler struct {
+	Store    *store.InventoryStore
+	Products *store.ProductStore
+}
+
+func NewInventoryHandler(s *store.InventoryStore, products *store.ProductStore) *InventoryHandler {
+	return &InventoryHandler{Store: s, Products: products}
+}
+
+type stockRequest struct {
+	OnHand int `json:"on_hand"`
+}
+
+type reserveRequest struct {
+	Quantity   int `json:"quantity"`
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// GetInventory handles GET /products/{productId}/inventory
+// Responses: 200 (found), 400 (bad input), 404 (no inventory)
+func (h *InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.GetInventory")
+	inv, err := h.Store.GetInventory(productID)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// SetStock handles PUT /products/{productId}/inventory
+// Responses: 200 (updated), 400 (bad input), 404 (product not found), 409 (below reserved)
+func (h *InventoryHandler) SetStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	var req stockRequest
+	_, span := tracing.Start(r.Context(), "decode")
+	err = json.NewDecoder(r.Body).Decode(&req)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.OnHand < 0 {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "on_hand must be >= 0")
+		return
+	}
+
+	_, span = tracing.Start(r.Context(), "store.GetProduct")
+	_, err = h.Products.GetProduct(productID)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	_, span = tracing.Start(r.Context(), "store.SetStock")
+	inv, err := h.Store.SetStock(productID, req.OnHand)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// Reserve handles POST /products/{productId}/reservations
+// Responses: 201 (reserved), 400 (bad input), 404 (no inventory), 409 (insufficient stock)
+func (h *InventoryHandler) Reserve(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	var req reserveRequest
+	_, span := tracing.Start(r.Context(), "decode")
+	err = json.NewDecoder(r.Body).Decode(&req)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Quantity < 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "quantity must be >= 1")
+		return
+	}
+	if req.TTLSeconds < 0 {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "ttl_seconds must be >= 0")
+		return
+	}
+
+	_, span = tracing.Start(r.Context(), "store.Reserve")
+	res, err := h.Store.Reserve(productID, req.Quantity, time.Duration(req.TTLSeconds)*time.Second)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/reservations/%d", res.ReservationID))
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// CommitReservation handles POST /reservations/{reservationId}/commit
+// Responses: 204 (committed), 400 (bad input), 404 (not found or expired)
+func (h *InventoryHandler) CommitReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := parseReservationID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.Commit")
+	err = h.Store.Commit(reservationID)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReleaseReservation handles POST /reservations/{reservationId}/release
+// Responses: 204 (released), 400 (bad input), 404 (not found or expired)
+func (h *InventoryHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := parseReservationID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	_, span := tracing.Start(r.Context(), "store.Release")
+	err = h.Store.Release(reservationID)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Helpers ---
+
+func parseReservationID(r *http.Request) (int, error) {
+	idStr := chi.URLParam(r, "reservationId")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, fmt.Errorf("reservationId must be an integer")
+	}
+	if id < 1 {
+		return 0, fmt.Errorf("reservationId must be >= 1")
+	}
+	return id, nil
+}
@@ -8,16 +8,18 @@ import (
 
 	"product-api/models"
 	"product-api/store"
+	"product-api/tracing"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type ProductHandler struct {
-	Store *store.ProductStore
+	Store      *store.ProductStore
+	Categories *store.CategoryStore
 }
 
-func NewProductHandler(s *store.ProductStore) *ProductHandler {
-	return &ProductHandler{Store: s}
+func NewProductHandler(s *store.ProductStore, categories *store.CategoryStore) *ProductHandler {
+	return &ProductHandler{Store: s, Categories: categories}
 }
 
 // GetProduct handles GET /products/{productId}
@@ -29,7 +31,10 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, span := tracing.Start(r.Context(), "store.GetProduct")
 	product, err := h.Store.GetProduct(productID)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
@@ -48,18 +53,30 @@ func (h *ProductHandler) AddProductDetails(w http.ResponseWriter, r *http.Reques
 	}
 
 	var product models.Product
-	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+	_, span := tracing.Start(r.Context(), "decode")
+	err = json.NewDecoder(r.Body).Decode(&product)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
 		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON: "+err.Error())
 		return
 	}
 
-	if err := validateProduct(&product); err != nil {
+	_, span = tracing.Start(r.Context(), "validate")
+	err = validateProduct(&product)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
 		writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
 		return
 	}
 
-	if err := h.Store.UpsertProduct(productID, &product); err != nil {
-		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	_, span = tracing.Start(r.Context(), "store.UpsertProductInCategory")
+	err = h.Store.UpsertProductInCategory(productID, &product, h.Categories)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"product-api/models"
+	"product-api/raft"
+	"product-api/store"
+	"product-api/tracing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxRaftBody caps the size of a catalog write that is put in the Raft log.
+	maxRaftBody = 1 << 20
+	// raftCommitTimeout bounds how long a write waits to commit, e.g. on a
+	// leader that has been partitioned away and doesn't know it yet.
+	raftCommitTimeout = 5 * time.Second
+)
+
+type RaftHandler struct {
+	Node   *raft.Node
+	Secret string
+}
+
+func NewRaftHandler(n *raft.Node, secret string) *RaftHandler {
+	return &RaftHandler{Node: n, Secret: secret}
+}
+
+// Message handles POST /raft/message
+// Delivers one message from a peer, which must send the shared secret as a
+// bearer token, to the local node.
+// Responses: 204, 400 (bad input), 401 (wrong or missing secret)
+func (h *RaftHandler) Message(w http.ResponseWriter, r *http.Request) {
+	if !hasBearer(r, h.Secret) {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Raft messages must carry the cluster secret")
+		return
+	}
+
+	var m raft.Message
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<20)).Decode(&m); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "invalid Raft message: "+err.Error())
+		return
+	}
+	h.Node.Step(m)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStatus handles GET /raft/status
+// Responses: 200
+func (h *RaftHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.Node.Status())
+}
+
+// RaftWrites sends catalog writes through the Raft log. On the leader the
+// request is proposed and answered with the response produced when it was
+// applied; other nodes redirect to the leader with a 307, or return 503
+// while no leader is known. Everything else passes straight through.
+func RaftWrites(node *raft.Node, fsm *CatalogFSM, peers map[uint64]*url.URL) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !fsm.Handles(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxRaftBody+1))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "INVALID_INPUT", "could not read request body: "+err.Error())
+				return
+			}
+			if len(body) > maxRaftBody {
+				writeError(w, http.StatusRequestEntityTooLarge, "INVALID_INPUT", "request body too large")
+				return
+			}
+			data, err := json.Marshal(RaftCommand{
+				Method:      r.Method,
+				URI:         r.URL.RequestURI(),
+				ContentType: r.Header.Get("Content-Type"),
+				Body:        body,
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), raftCommitTimeout)
+			defer cancel()
+			_, span := tracing.Start(ctx, "raft.Propose")
+			result, err := node.ProposeWait(ctx, data)
+			span.RecordError(err)
+			span.End()
+
+			switch {
+			case errors.Is(err, raft.ErrNotLeader):
+				redirectToLeader(w, r, node.Status().Leader, peers)
+			case errors.Is(err, raft.ErrDropped), errors.Is(err, raft.ErrStopped):
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, "NOT_COMMITTED", "the write may not have been applied: "+err.Error())
+			case err != nil:
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, "NOT_COMMITTED", "gave up waiting for the write to commit; it may still be applied")
+			default:
+				result.(*bufferedResponse).copyTo(w)
+			}
+		})
+	}
+}
+
+// RaftCommand is one catalog write as stored in the Raft log. Each node
+// replays it through the same handlers once it commits.
+type RaftCommand struct {
+	Method      string `json:"method"`
+	URI         string `json:"uri"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// CatalogFSM is the Raft state machine for the product catalog. Applying a
+// command runs the normal product and category handlers against the local
+// stores, so validation happens at apply time and every node reaches the
+// same result.
+type CatalogFSM struct {
+	Products   *store.ProductStore
+	Categories *store.CategoryStore
+	routes     *chi.Mux
+}
+
+func NewCatalogFSM(products *store.ProductStore, categories *store.CategoryStore) *CatalogFSM {
+	productHandler := NewProductHandler(products, categories)
+	categoryHandler := NewCategoryHandler(categories, products)
+
+	r := chi.NewRouter()
+	r.Post("/products/{productId}/details", productHandler.AddProductDetails)
+	r.Post("/categories", categoryHandler.CreateCategory)
+	r.Put("/categories/{categoryId}", categoryHandler.UpsertCategory)
+	r.Delete("/categories/{categoryId}", categoryHandler.DeleteCategory)
+
+	return &CatalogFSM{Products: products, Categories: categories, routes: r}
+}
+
+// Handles reports whether r is a catalog write that must go through Raft.
+func (f *CatalogFSM) Handles(r *http.Request) bool {
+	return isMutating(r.Method) && f.routes.Match(chi.NewRouteContext(), r.Method, r.URL.Path)
+}
+
+func (f *CatalogFSM) Apply(index uint64, data []byte) any {
+	// The response the command produced is what ProposeWait returns.
+	res := newBufferedResponse()
+
+	var cmd RaftCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		writeError(res, http.StatusInternalServerError, "INTERNAL_ERROR", "corrupt log entry: "+err.Error())
+		return res
+	}
+	req, err := http.NewRequestWithContext(context.Background(), cmd.Method, cmd.URI, bytes.NewReader(cmd.Body))
+	if err != nil {
+		writeError(res, http.StatusInternalServerError, "INTERNAL_ERROR", "corrupt log entry: "+err.Error())
+		return res
+	}
+	if cmd.ContentType != "" {
+		req.Header.Set("Content-Type", cmd.ContentType)
+	}
+	f.routes.ServeHTTP(res, req)
+	return res
+}
+
+// catalogSnapshot is the serialized form of both catalog stores.
+type catalogSnapshot struct {
+	Products       []models.Product  `json:"products"`
+	Categories     []models.Category `json:"categories"`
+	NextCategoryID int               `json:"next_category_id"`
+}
+
+func (f *CatalogFSM) Snapshot() ([]byte, error) {
+	categories, nextID := f.Categories.Snapshot()
+	return json.Marshal(catalogSnapshot{
+		Products:       f.Products.Snapshot(),
+		Categories:     categories,
+		NextCategoryID: nextID,
+	})
+}
+
+func (f *CatalogFSM) Restore(data []byte) error {
+	var snap catalogSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	f.Products.Restore(snap.Products)
+	f.Categories.Restore(snap.Categories, snap.NextCategoryID)
+	return nil
+}
+
+// --- Helpers ---
+
+// hasBearer reports whether r carries secret, which must not be empty, as
+// its bearer token.
+func hasBearer(r *http.Request, secret string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+func redirectToLeader(w http.ResponseWriter, r *http.Request, leader uint64, peers map[uint64]*url.URL) {
+	leaderURL, ok := peers[leader]
+	if !ok {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "NO_LEADER", "no Raft leader is known yet")
+		return
+	}
+	w.Header().Set("Location", leaderURL.ResolveReference(&url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery}).String())
+	writeError(w, http.StatusTemporaryRedirect, "NOT_LEADER", "writes must be sent to the leader at "+leaderURL.String())
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"product-api/raft"
+	"product-api/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestIdempotencyReplaysRaftWrites retries a category creation with the
+// same Idempotency-Key on a single-node Raft cluster, with the middleware
+// in the order main.go uses, and checks that only one category is created.
+func TestIdempotencyReplaysRaftWrites(t *testing.T) {
+	products := store.NewProductStore()
+	categories := store.NewCategoryStore()
+	fsm := NewCatalogFSM(products, categories)
+	node, err := raft.NewNode(raft.Config{
+		ID:             1,
+		Peers:          []uint64{1},
+		ElectionTicks:  2,
+		HeartbeatTicks: 1,
+		Storage:        raft.NewMemoryStorage(),
+		StateMachine:   fsm,
+		Send:           func(raft.Message) {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Stop()
+	for range 10 {
+		node.Tick()
+	}
+	if node.Status().State != raft.Leader {
+		t.Fatalf("single node is %v after 10 ticks, want leader", node.Status().State)
+	}
+
+	r := chi.NewRouter()
+	r.Use(Idempotency(store.NewIdempotencyStore(time.Hour)))
+	r.Use(RaftWrites(node, fsm, map[uint64]*url.URL{}))
+	r.Post("/categories", NewCategoryHandler(categories, products).CreateCategory)
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/categories", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("k1", `{"name":"Tools"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first POST: status %d: %s", first.Code, first.Body)
+	}
+	retry := post("k1", `{"name":"Tools"}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() ||
+		retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: status %d, replayed %q, body %s; want the first response replayed",
+			retry.Code, retry.Header().Get("Idempotent-Replayed"), retry.Body)
+	}
+	if got := len(categories.ListCategories()); got != 1 {
+		t.Errorf("%d categories after a retried POST, want 1", got)
+	}
+	if st := node.Status(); st.CommitIndex != 2 {
+		t.Errorf("commit index %d, want 2: the no-op and one write", st.CommitIndex)
+	}
+
+	if w := post("k1", `{"name":"Other"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reusing the key for another body: status %d, want 422", w.Code)
+	}
+	if w := post("k2", `{"name":"Tools"}`); w.Code != http.StatusCreated {
+		t.Errorf("a new key: status %d, want 201", w.Code)
+	}
+	if got := len(categories.ListCategories()); got != 2 {
+		t.Errorf("%d categories after a POST with a new key, want 2", got)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit rejects requests with 429 once the global token bucket
+// (refilled at rps tokens per second, holding at most burst) is empty.
+// Control-plane requests neither need nor take a token.
+func RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
+	b := &tokenBucket{rate: rps, capacity: float64(burst), tokens: float64(burst), last: time.Now()}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isControlPlane(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if wait, ok := b.take(); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "request rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// take consumes one token, or reports how long until one is available.
+func (b *tokenBucket) take() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"product-api/replication"
+)
+
+// maxReplicationWait bounds how long a follower's long-poll may be held open.
+const maxReplicationWait = 30 * time.Second
+
+type ReplicationHandler struct {
+	Log *replication.Log
+}
+
+func NewReplicationHandler(l *replication.Log) *ReplicationHandler {
+	return &ReplicationHandler{Log: l}
+}
+
+// GetLog handles GET /replication/log?after=&limit=&wait=
+// Returns entries with index > after, long-polling up to wait when there are none,
+// and a snapshot first if some of those entries have been compacted.
+// Responses: 200 (batch, possibly empty), 400 (bad input)
+func (h *ReplicationHandler) GetLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	after, err := strconv.ParseUint(q.Get("after"), 10, 64)
+	if q.Get("after") == "" {
+		after, err = 0, nil
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "after must be a non-negative integer")
+		return
+	}
+
+	limit := 1000
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "limit must be >= 1")
+			return
+		}
+	}
+
+	var wait time.Duration
+	if v := q.Get("wait"); v != "" {
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "wait must be a non-negative duration")
+			return
+		}
+	}
+	wait = min(wait, maxReplicationWait)
+	// The server-wide write timeout may be shorter than the long-poll.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	snap, entries := h.Log.Since(ctx, after, limit)
+	if entries == nil {
+		entries = []replication.Entry{}
+	}
+
+	writeJSON(w, http.StatusOK, replication.Batch{
+		Epoch:     h.Log.Epoch(),
+		LastIndex: h.Log.LastIndex(),
+		Snapshot:  snap,
+		Entries:   entries,
+	})
+}
+
+// GetStatus handles GET /replication/status on the leader.
+// Responses: 200
+func (h *ReplicationHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	last := h.Log.LastIndex()
+	writeJSON(w, http.StatusOK, replication.Status{
+		Role:         "leader",
+		Epoch:        h.Log.Epoch(),
+		AppliedIndex: last,
+		LeaderIndex:  last,
+	})
+}
+
+// FollowerStatus handles GET /replication/status on a follower.
+// Responses: 200
+func FollowerStatus(f *replication.Follower) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, f.Status())
+	}
+}
+
+// leaderWritePrefixes are the routes whose writes a follower sends to the
+// leader: the catalog it replicates, and inventory, which only the leader
+// keeps. Everything else, such as /admin/faults, belongs to the follower.
+var leaderWritePrefixes = []string{"/products/", "/categories", "/reservations/"}
+
+// servedByLeader reports whether a follower must send r to the leader:
+// catalog and inventory writes, and inventory reads, since the follower's
+// own inventory is always empty.
+func servedByLeader(r *http.Request) bool {
+	if isMutating(r.Method) {
+		return hasPathPrefix(r.URL.Path, leaderWritePrefixes)
+	}
+	return strings.HasPrefix(r.URL.Path, "/products/") && strings.HasSuffix(r.URL.Path, "/inventory")
+}
+
+// FollowerWrites sends catalog and inventory writes, and inventory reads,
+// on a follower to the leader, either by proxying them (forward) or with a
+// 307 redirect that preserves the method and body (redirect).
+func FollowerWrites(mode string, leaderURL *url.URL) func(http.Handler) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(leaderURL)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !servedByLeader(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if mode == "forward" {
+				proxy.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Location", leaderURL.ResolveReference(&url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery}).String())
+			writeError(w, http.StatusTemporaryRedirect, "NOT_LEADER", "this request must be sent to the leader at "+leaderURL.String())
+		})
+	}
+}
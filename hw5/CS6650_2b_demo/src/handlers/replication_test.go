@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFollowerSendsInventoryToTheLeader(t *testing.T) {
+	leaderURL, _ := url.Parse("http://leader:8080")
+	handler := FollowerWrites("redirect", leaderURL)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method, path string
+		leader       bool
+	}{
+		{"GET", "/products/1", false},
+		{"GET", "/categories", false},
+		{"GET", "/products/1/inventory", true},
+		{"HEAD", "/products/1/inventory", true},
+		{"PUT", "/products/1/inventory", true},
+		{"POST", "/products/1/details", true},
+		{"POST", "/products/1/reservations", true},
+		{"POST", "/reservations/abc/commit", true},
+		{"DELETE", "/categories/2", true},
+		{"POST", "/admin/faults", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path+"?x=1", nil))
+		if got := w.Code == http.StatusTemporaryRedirect; got != tt.leader {
+			t.Errorf("%s %s: status %d, sent to the leader %v, want %v", tt.method, tt.path, w.Code, got, tt.leader)
+			continue
+		}
+		if want := "http://leader:8080" + tt.path + "?x=1"; tt.leader && w.Header().Get("Location") != want {
+			t.Errorf("%s %s: Location %q, want %q", tt.method, tt.path, w.Header().Get("Location"), want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"product-api/store"
+	"product-api/tracing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestHandlerSpansAreChildrenOfTheServerSpan sends category and inventory
+// requests through the tracing middleware and checks that each handler's
+// spans hang off the request's server span, which continues the caller's
+// trace.
+func TestHandlerSpansAreChildrenOfTheServerSpan(t *testing.T) {
+	products := store.NewProductStore()
+	categories := store.NewCategoryStore()
+	inventory := store.NewInventoryStore()
+	categoryHandler := NewCategoryHandler(categories, products)
+	inventoryHandler := NewInventoryHandler(inventory, products)
+	productHandler := NewProductHandler(products, categories)
+
+	collector := tracing.NewCollector(0)
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware(tracing.NewTracer(collector)))
+	r.Post("/categories", categoryHandler.CreateCategory)
+	r.Delete("/categories/{categoryId}", categoryHandler.DeleteCategory)
+	r.Get("/categories/{categoryId}/products", categoryHandler.ListCategoryProducts)
+	r.Post("/products/{productId}/details", productHandler.AddProductDetails)
+	r.Put("/products/{productId}/inventory", inventoryHandler.SetStock)
+	r.Post("/products/{productId}/reservations", inventoryHandler.Reserve)
+	r.Post("/reservations/{reservationId}/commit", inventoryHandler.CommitReservation)
+
+	const caller = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		method, path, body string
+		status             int
+		server             string   // name of the server span
+		children           []string // names of its child spans, in order
+	}{
+		{"POST", "/categories", `{"name":"Tools"}`, http.StatusCreated,
+			"POST /categories", []string{"decode", "validate", "store.CreateCategory"}},
+		{"POST", "/products/1/details", `{"sku":"a","manufacturer":"m","category_id":1,"weight":1,"some_other_id":1}`, http.StatusNoContent,
+			"POST /products/{productId}/details", []string{"decode", "validate", "store.UpsertProductInCategory"}},
+		{"GET", "/categories/1/products?recursive=true", "", http.StatusOK,
+			"GET /categories/{categoryId}/products", []string{"store.Subtree", "store.ListProductsByCategory"}},
+		{"DELETE", "/categories/1", "", http.StatusConflict,
+			"DELETE /categories/{categoryId}", []string{"store.DeleteUnusedCategory"}},
+		{"PUT", "/products/1/inventory", `{"on_hand":5}`, http.StatusOK,
+			"PUT /products/{productId}/inventory", []string{"decode", "store.GetProduct", "store.SetStock"}},
+		{"POST", "/products/1/reservations", `{"quantity":2}`, http.StatusCreated,
+			"POST /products/{productId}/reservations", []string{"decode", "store.Reserve"}},
+		{"POST", "/reservations/1/commit", "", http.StatusNoContent,
+			"POST /reservations/{reservationId}/commit", []string{"store.Commit"}},
+	}
+	for _, tt := range tests {
+		collector.Reset()
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("traceparent", caller)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Fatalf("%s %s: status %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body)
+		}
+
+		spans := collector.Trace("4bf92f3577b34da6a3ce929d0e0e4736")
+		i := slices.IndexFunc(spans, func(s tracing.SpanData) bool { return s.Name == tt.server })
+		if i < 0 {
+			t.Fatalf("%s %s: no %q span in %+v", tt.method, tt.path, tt.server, spans)
+		}
+		server := spans[i]
+		if server.ParentSpanID != "00f067aa0ba902b7" {
+			t.Errorf("%s: parent %q, want the caller's span", server.Name, server.ParentSpanID)
+		}
+		var children []string
+		for _, s := range spans {
+			if s.ParentSpanID == server.SpanID {
+				children = append(children, s.Name)
+			}
+		}
+		if !slices.Equal(children, tt.children) {
+			t.Errorf("%s: children %v, want %v", server.Name, children, tt.children)
+		}
+		if len(spans) != len(tt.children)+1 {
+			t.Errorf("%s: %d spans in the trace, want %d", server.Name, len(spans), len(tt.children)+1)
+		}
+	}
+}
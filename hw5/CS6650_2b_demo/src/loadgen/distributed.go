@@ -0,0 +1,168 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Worker serves POST /run: it runs the Options in the request body and
+// responds with the Result, histograms included, once the run is over. A
+// coordinator disconnecting cancels the run.
+type Worker struct {
+	mu      sync.Mutex
+	running bool
+}
+
+// ServeHTTP implements http.Handler.
+func (wk *Worker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/run" {
+		writeWorkerError(w, http.StatusNotFound, "only POST /run is served")
+		return
+	}
+	var opts Options
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeWorkerError(w, http.StatusBadRequest, "invalid options: "+err.Error())
+		return
+	}
+
+	wk.mu.Lock()
+	if wk.running {
+		wk.mu.Unlock()
+		writeWorkerError(w, http.StatusConflict, "a run is already in progress")
+		return
+	}
+	wk.running = true
+	wk.mu.Unlock()
+	defer func() {
+		wk.mu.Lock()
+		wk.running = false
+		wk.mu.Unlock()
+	}()
+
+	res, err := Run(r.Context(), opts)
+	if err != nil {
+		writeWorkerError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Coordinate splits opts across the workers at the given base URLs, starts
+// them together startDelay from now and merges what they measured.
+//
+// The coordinator seeds the target itself, once. Open-loop RPS and
+// MaxInFlight and closed-loop Users are divided between the workers, and
+// each worker numbers its new products in its own shard. Histograms are
+// merged bucket by bucket, so the percentiles of the merged result are
+// those of every request sent, not an average of per-worker percentiles.
+// Worker clocks are assumed to be in sync, as they are on one host or with
+// NTP.
+func Coordinate(ctx context.Context, workers []string, opts Options, startDelay time.Duration) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("no workers")
+	}
+	if opts.Mode == ClosedLoop && opts.Users < len(workers) {
+		workers = workers[:opts.Users]
+	}
+	if opts.Seed {
+		client := &http.Client{Timeout: opts.Timeout}
+		defer client.CloseIdleConnections()
+		if err := NewWorkload(opts.BaseURL, client).Seed(ctx, rand.New(rand.NewPCG(opts.RandSeed, 0))); err != nil {
+			return nil, err
+		}
+	}
+
+	n := len(workers)
+	start := time.Now().Add(startDelay)
+	results := make([]*Result, n)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var wg sync.WaitGroup
+	for i, worker := range workers {
+		plan := opts
+		plan.Seed = false
+		plan.StartAt = start
+		plan.Shard, plan.Shards = i, n
+		plan.RandSeed = opts.RandSeed + uint64(i)
+		plan.RPS = opts.RPS / float64(n)
+		plan.MaxInFlight = max(1, opts.MaxInFlight/n)
+		plan.Users = opts.Users / n
+		if i < opts.Users%n {
+			plan.Users++
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := runWorker(ctx, worker, plan)
+			if err != nil {
+				// One missing share makes the whole run meaningless. Only
+				// the first cause is kept.
+				cancel(fmt.Errorf("worker %s: %w", worker, err))
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+
+	res := &Result{Options: opts, Started: start, Ops: make(map[string]*OpStats), Workers: n}
+	for _, r := range results {
+		res.Elapsed = max(res.Elapsed, r.Elapsed)
+		res.add(r.Ops)
+	}
+	return res, nil
+}
+
+// --- Helpers ---
+
+func runWorker(ctx context.Context, worker string, plan Options) (*Result, error) {
+	body, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(worker, "/")+"/run", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(data))
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, e.Error)
+	}
+	var res Result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decoding result: %w", err)
+	}
+	return &res, nil
+}
+
+func writeWorkerError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,187 @@
+// Package loadgen drives the product API with the same task mix as
+// locustfile.py and records latencies in HDR-style histograms.
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Histogram counts values (microseconds here) in log-linear buckets so any
+// recorded value is reproduced to three significant digits, whatever its
+// magnitude, in a fixed amount of memory. Histograms with the same range can
+// be merged exactly, unlike percentiles.
+//
+// The layout follows HdrHistogram: bucket 0 covers [0, 2048) with a step of
+// 1, and each further bucket doubles both its range and its step while
+// keeping 1024 sub-buckets.
+type Histogram struct {
+	highest int64
+	counts  []uint64
+	total   uint64
+	min     int64
+	max     int64
+	sum     float64
+}
+
+const (
+	subBucketHalfCountMagnitude = 10 // 3 significant digits
+	subBucketHalfCount          = 1 << subBucketHalfCountMagnitude
+	subBucketCount              = 2 * subBucketHalfCount
+	subBucketMask               = subBucketCount - 1
+
+	// DefaultHighest is one hour in microseconds; larger values are clamped.
+	DefaultHighest = int64(3600 * 1e6)
+)
+
+// NewHistogram tracks values from 0 to highest.
+func NewHistogram(highest int64) *Histogram {
+	buckets := 1
+	for smallest := int64(subBucketCount); smallest <= highest; smallest <<= 1 {
+		buckets++
+	}
+	return &Histogram{
+		highest: highest,
+		counts:  make([]uint64, (buckets+1)*subBucketHalfCount),
+		min:     math.MaxInt64,
+	}
+}
+
+// Record adds one value, clamping it to [0, highest].
+func (h *Histogram) Record(v int64) {
+	h.RecordN(v, 1)
+}
+
+// RecordN adds n occurrences of v.
+func (h *Histogram) RecordN(v int64, n uint64) {
+	if n == 0 {
+		return
+	}
+	v = max(0, min(v, h.highest))
+	h.counts[countsIndex(v)] += n
+	h.total += n
+	h.sum += float64(v) * float64(n)
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+// Merge adds every value recorded in other. Both must have the same range.
+func (h *Histogram) Merge(other *Histogram) error {
+	if len(other.counts) != len(h.counts) {
+		return fmt.Errorf("loadgen: merging histograms with different ranges")
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	if other.total > 0 {
+		h.total += other.total
+		h.sum += other.sum
+		h.min = min(h.min, other.min)
+		h.max = max(h.max, other.max)
+	}
+	return nil
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 { return h.total }
+
+// Min returns the smallest recorded value, or 0 if there are none.
+func (h *Histogram) Min() int64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.min
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() int64 { return h.max }
+
+// Mean returns the average of the recorded values.
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// ValueAtQuantile returns the value below which a fraction q (0..1) of the
+// recorded values fall, rounded up to the top of its bucket like
+// HdrHistogram does, and never above the true maximum.
+func (h *Histogram) ValueAtQuantile(q float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	q = max(0, min(q, 1))
+	want := max(uint64(math.Ceil(q*float64(h.total))), 1)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= want {
+			return min(highestEquivalent(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// histogramJSON is the wire form of a Histogram. Only non-empty buckets are
+// sent, as [index, count] pairs, so a typical histogram is a few KB.
+type histogramJSON struct {
+	Highest int64       `json:"highest"`
+	Min     int64       `json:"min"`
+	Max     int64       `json:"max"`
+	Sum     float64     `json:"sum"`
+	Counts  [][2]uint64 `json:"counts"`
+}
+
+// MarshalJSON encodes every recorded value so the receiver can Merge it
+// exactly.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	out := histogramJSON{Highest: h.highest, Min: h.min, Max: h.max, Sum: h.sum, Counts: [][2]uint64{}}
+	for i, c := range h.counts {
+		if c > 0 {
+			out.Counts = append(out.Counts, [2]uint64{uint64(i), c})
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON restores a histogram written by MarshalJSON.
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var in histogramJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*h = *NewHistogram(in.Highest)
+	for _, ic := range in.Counts {
+		if ic[0] >= uint64(len(h.counts)) {
+			return fmt.Errorf("loadgen: histogram bucket %d out of range", ic[0])
+		}
+		h.counts[ic[0]] += ic[1]
+		h.total += ic[1]
+	}
+	if h.total > 0 {
+		h.min, h.max, h.sum = in.Min, in.Max, in.Sum
+	}
+	return nil
+}
+
+// --- Helpers ---
+
+func countsIndex(v int64) int {
+	bucket := 64 - bits.LeadingZeros64(uint64(v)|subBucketMask) - (subBucketHalfCountMagnitude + 1)
+	sub := int(v >> bucket)
+	return (bucket+1)<<subBucketHalfCountMagnitude + (sub - subBucketHalfCount)
+}
+
+// highestEquivalent returns the largest value that lands in counts[i].
+func highestEquivalent(i int) int64 {
+	bucket := i>>subBucketHalfCountMagnitude - 1
+	sub := int64(i&(subBucketHalfCount-1)) + subBucketHalfCount
+	if bucket < 0 {
+		sub -= subBucketHalfCount
+		bucket = 0
+	}
+	return (sub << bucket) + (1 << bucket) - 1
+}
@@ -0,0 +1,168 @@
+package loadgen
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// TotalRow names the row that aggregates every operation.
+const TotalRow = "Aggregated"
+
+// Latency summarizes one latency histogram in milliseconds.
+type Latency struct {
+	MeanMs float64 `json:"mean_ms"`
+	MinMs  float64 `json:"min_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// Row is the summary of one operation.
+type Row struct {
+	Name      string  `json:"name"`
+	Requests  uint64  `json:"requests"` // sent
+	Failures  uint64  `json:"failures"`
+	Unsent    uint64  `json:"unsent"`            // due before the run ended, but never sent
+	RPS       float64 `json:"rps"`               // requests sent per second
+	Latency   Latency `json:"latency"`           // from the actual send
+	Corrected Latency `json:"corrected_latency"` // from the intended start
+}
+
+// Report is the summary written at the end of a run.
+type Report struct {
+	Mode     Mode    `json:"mode"`
+	Target   string  `json:"target"`
+	Duration float64 `json:"duration_seconds"`
+	Workers  int     `json:"workers,omitempty"`
+	Rows     []Row   `json:"rows"` // by name, then the aggregate
+}
+
+// Report summarizes the result, one row per operation plus TotalRow.
+func (r *Result) Report() *Report {
+	rep := &Report{
+		Mode:     r.Options.Mode,
+		Target:   r.Options.BaseURL,
+		Duration: r.Elapsed.Seconds(),
+		Workers:  r.Workers,
+	}
+	total := newOpStats()
+	names := make([]string, 0, len(r.Ops))
+	for name := range r.Ops {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		s := r.Ops[name]
+		rep.Rows = append(rep.Rows, summarize(name, s, r.Elapsed))
+		total.merge(s)
+	}
+	rep.Rows = append(rep.Rows, summarize(TotalRow, total, r.Elapsed))
+	return rep
+}
+
+// WriteText writes the report as an aligned table. Each latency column is
+// followed by its corrected counterpart, marked with a *.
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%s loop against %s for %s", rep.Mode, rep.Target,
+		time.Duration(rep.Duration*float64(time.Second)).Round(time.Millisecond))
+	if rep.Workers > 0 {
+		fmt.Fprintf(w, " from %d workers", rep.Workers)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Name\tReqs\tFails\tUnsent\tReq/s\tMean\tMean*\tp50\tp50*\tp95\tp95*\tp99\tp99*\tp99.9\tp99.9*\tMax\tMax*\t")
+	for _, row := range rep.Rows {
+		u, c := row.Latency, row.Corrected
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t\n",
+			row.Name, row.Requests, row.Failures, row.Unsent, row.RPS,
+			u.MeanMs, c.MeanMs, u.P50Ms, c.P50Ms, u.P95Ms, c.P95Ms,
+			u.P99Ms, c.P99Ms, u.P999Ms, c.P999Ms, u.MaxMs, c.MaxMs)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w, "Latencies in ms. * = corrected for coordinated omission: measured from the intended start, not the actual send.")
+	return err
+}
+
+// WriteCSV writes one header line and one line per row.
+func (rep *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	latencyColumns := []string{"mean_ms", "min_ms", "p50_ms", "p95_ms", "p99_ms", "p999_ms", "max_ms"}
+	header := []string{"name", "requests", "failures", "unsent", "rps"}
+	header = append(header, latencyColumns...)
+	for _, col := range latencyColumns {
+		header = append(header, "corrected_"+col)
+	}
+	cw.Write(header)
+	for _, row := range rep.Rows {
+		record := []string{
+			row.Name,
+			strconv.FormatUint(row.Requests, 10),
+			strconv.FormatUint(row.Failures, 10),
+			strconv.FormatUint(row.Unsent, 10),
+			formatFloat(row.RPS),
+		}
+		record = append(record, row.Latency.fields()...)
+		record = append(record, row.Corrected.fields()...)
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the report as one indented JSON object.
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// --- Helpers ---
+
+func summarize(name string, s *OpStats, elapsed time.Duration) Row {
+	row := Row{
+		Name:      name,
+		Requests:  s.Latency.Count(),
+		Failures:  s.Errors,
+		Unsent:    s.Unsent,
+		Latency:   latencyOf(s.Latency),
+		Corrected: latencyOf(s.Corrected),
+	}
+	if elapsed > 0 {
+		row.RPS = float64(row.Requests) / elapsed.Seconds()
+	}
+	return row
+}
+
+func latencyOf(h *Histogram) Latency {
+	return Latency{
+		MeanMs: h.Mean() / 1000,
+		MinMs:  ms(h.Min()),
+		P50Ms:  ms(h.ValueAtQuantile(0.50)),
+		P95Ms:  ms(h.ValueAtQuantile(0.95)),
+		P99Ms:  ms(h.ValueAtQuantile(0.99)),
+		P999Ms: ms(h.ValueAtQuantile(0.999)),
+		MaxMs:  ms(h.Max()),
+	}
+}
+
+// fields returns the CSV cells in the order of the WriteCSV header.
+func (l Latency) fields() []string {
+	return []string{
+		formatFloat(l.MeanMs), formatFloat(l.MinMs), formatFloat(l.P50Ms), formatFloat(l.P95Ms),
+		formatFloat(l.P99Ms), formatFloat(l.P999Ms), formatFloat(l.MaxMs),
+	}
+}
+
+func ms(us int64) float64 { return float64(us) / 1000 }
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'f', 3, 64) }
@@ -0,0 +1,352 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Mode selects how requests are paced.
+type Mode string
+
+// Both modes put every request on an intended-start timeline. A request
+// that can't go out on time, because the server is stalled and every
+// connection or user is still waiting, is sent late but its corrected
+// latency is still measured from when it should have started. Measuring
+// only from the actual send (the uncorrected latency) hides the stall:
+// the requests that would have waited are simply never sent, which is
+// known as coordinated omission.
+//
+// When the run ends, requests still waiting for a response and starts that
+// were due but never sent count as timeouts at their corrected latency, so
+// a stall at the very end isn't dropped from the results either.
+const (
+	// OpenLoop starts requests at a fixed rate whether or not earlier ones
+	// have finished, like independent clients arriving.
+	OpenLoop Mode = "open"
+	// ClosedLoop runs a fixed number of users that each wait for a
+	// response before sending their next request, like locust. Each user
+	// intends to start a request every think time, measured start to start.
+	ClosedLoop Mode = "closed"
+)
+
+// Options describe one load test.
+type Options struct {
+	BaseURL  string        `json:"base_url"`
+	Mode     Mode          `json:"mode"`
+	Duration time.Duration `json:"duration"`
+	Timeout  time.Duration `json:"timeout"`   // per request
+	Seed     bool          `json:"seed"`      // seed categories and products first
+	RandSeed uint64        `json:"rand_seed"` // makes the task sequence reproducible
+
+	// Open loop
+	RPS         float64 `json:"rps,omitempty"`
+	MaxInFlight int     `json:"max_in_flight,omitempty"` // requests outstanding at once; later starts wait for a free slot
+
+	// Closed loop
+	Users    int           `json:"users,omitempty"`
+	ThinkMin time.Duration `json:"think_min,omitempty"`
+	ThinkMax time.Duration `json:"think_max,omitempty"`
+
+	// Distributed runs; see Coordinate.
+	StartAt time.Time `json:"start_at,omitzero"` // wait until then after seeding
+	Shard   int       `json:"shard,omitempty"`   // this generator's index
+	Shards  int       `json:"shards,omitempty"`  // generators running the test together
+}
+
+// Validate reports the first option that can't be used.
+func (o Options) Validate() error {
+	if o.BaseURL == "" {
+		return fmt.Errorf("a target URL is required")
+	}
+	if o.Duration <= 0 {
+		return fmt.Errorf("duration must be > 0")
+	}
+	switch o.Mode {
+	case OpenLoop:
+		if o.RPS <= 0 {
+			return fmt.Errorf("rps must be > 0 in open-loop mode")
+		}
+		if o.MaxInFlight < 1 {
+			return fmt.Errorf("max in-flight must be >= 1")
+		}
+	case ClosedLoop:
+		if o.Users < 1 {
+			return fmt.Errorf("users must be >= 1 in closed-loop mode")
+		}
+		if o.ThinkMin < 0 || o.ThinkMax < o.ThinkMin {
+			return fmt.Errorf("think time must satisfy 0 <= min <= max")
+		}
+	default:
+		return fmt.Errorf("mode %q is not one of open, closed", o.Mode)
+	}
+	if o.Shards > 0 && (o.Shard < 0 || o.Shard >= o.Shards) {
+		return fmt.Errorf("shard must be in [0, %d)", o.Shards)
+	}
+	return nil
+}
+
+// OpStats aggregates the results of one operation. Latencies are in
+// microseconds.
+type OpStats struct {
+	Latency   *Histogram     `json:"latency"`   // from the actual send, for every request sent
+	Corrected *Histogram     `json:"corrected"` // from the intended start, including unsent starts
+	Errors    uint64         `json:"errors"`    // transport failures, timeouts and 4xx/5xx responses
+	Statuses  map[int]uint64 `json:"statuses"`  // by HTTP status; 0 is a transport failure or timeout
+	Unsent    uint64         `json:"unsent"`    // starts that were due but never sent before the run ended
+}
+
+// errRunEnded is recorded for requests the end of the run cut off.
+var errRunEnded = errors.New("timed out: the run ended before a response arrived")
+
+func newOpStats() *OpStats {
+	return &OpStats{
+		Latency:   NewHistogram(DefaultHighest),
+		Corrected: NewHistogram(DefaultHighest),
+		Statuses:  make(map[int]uint64),
+	}
+}
+
+func (s *OpStats) merge(other *OpStats) {
+	s.Latency.Merge(other.Latency)
+	s.Corrected.Merge(other.Corrected)
+	s.Errors += other.Errors
+	s.Unsent += other.Unsent
+	for code, n := range other.Statuses {
+		s.Statuses[code] += n
+	}
+}
+
+// Result is everything measured during a run.
+type Result struct {
+	Options Options             `json:"options"`
+	Started time.Time           `json:"started"`
+	Elapsed time.Duration       `json:"elapsed"`
+	Ops     map[string]*OpStats `json:"ops"`
+	Workers int                 `json:"workers,omitempty"` // generators merged into this result
+}
+
+// add merges one generator's per-operation stats into r.
+func (r *Result) add(ops map[string]*OpStats) {
+	for op, s := range ops {
+		if _, ok := r.Ops[op]; !ok {
+			r.Ops[op] = newOpStats()
+		}
+		r.Ops[op].merge(s)
+	}
+}
+
+// recorder is one goroutine's private stats; they are merged at the end so
+// recording never contends on a lock.
+type recorder map[string]*OpStats
+
+func (r recorder) record(op string, status int, err error, intended, sent, done time.Time) {
+	s, ok := r[op]
+	if !ok {
+		s = newOpStats()
+		r[op] = s
+	}
+	s.Latency.Record(done.Sub(sent).Microseconds())
+	s.Corrected.Record(done.Sub(intended).Microseconds())
+	s.Statuses[status]++
+	if err != nil {
+		s.Errors++
+	}
+}
+
+// recordUnsent records a start that was due at intended but never sent
+// before the run ended at end. It only has a corrected latency, and isn't
+// counted as a request.
+func (r recorder) recordUnsent(op string, intended, end time.Time) {
+	s, ok := r[op]
+	if !ok {
+		s = newOpStats()
+		r[op] = s
+	}
+	s.Corrected.Record(end.Sub(intended).Microseconds())
+	s.Unsent++
+}
+
+// Run seeds the target if asked, then generates load until Duration has
+// passed or ctx is cancelled.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	conns := opts.MaxInFlight
+	if opts.Mode == ClosedLoop {
+		conns = opts.Users
+	}
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        conns,
+			MaxIdleConnsPerHost: conns,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	w := NewWorkload(opts.BaseURL, client)
+	if opts.Shards > 0 {
+		w.Partition(opts.Shard, opts.Shards)
+	}
+	if opts.Seed {
+		if err := w.Seed(ctx, rand.New(rand.NewPCG(opts.RandSeed, 0))); err != nil {
+			return nil, err
+		}
+	}
+	if wait := time.Until(opts.StartAt); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	res := &Result{Options: opts, Started: time.Now(), Ops: make(map[string]*OpStats)}
+	var recorders []recorder
+	switch opts.Mode {
+	case OpenLoop:
+		recorders = runOpen(ctx, w, opts)
+	case ClosedLoop:
+		recorders = runClosed(ctx, w, opts)
+	}
+	res.Elapsed = time.Since(res.Started)
+
+	for _, rec := range recorders {
+		res.add(rec)
+	}
+	return res, nil
+}
+
+// runOpen hands an intended start time every 1/RPS to a pool of
+// MaxInFlight workers. While every worker is busy the starts queue up;
+// the schedule itself never slips.
+func runOpen(ctx context.Context, w *Workload, opts Options) []recorder {
+	starts := make(chan time.Time)
+	recorders := make([]recorder, opts.MaxInFlight, opts.MaxInFlight+1)
+	var wg sync.WaitGroup
+	for i := range recorders {
+		rec := make(recorder)
+		recorders[i] = rec
+		rng := rand.New(rand.NewPCG(opts.RandSeed, uint64(i)+1))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for intended := range starts {
+				sent := time.Now()
+				op, status, err := w.Next(ctx, rng)
+				if ctx.Err() != nil {
+					status, err = 0, errRunEnded
+				}
+				rec.record(op, status, err, intended, sent, time.Now())
+			}
+		}()
+	}
+
+	interval := time.Duration(float64(time.Second) / opts.RPS)
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-timer.C:
+		}
+		// Release every start that is due, so a late wakeup or a backlog
+		// doesn't lower the rate.
+		for !next.After(time.Now()) {
+			select {
+			case starts <- next:
+			case <-ctx.Done():
+				break loop
+			}
+			next = next.Add(interval)
+		}
+		timer.Reset(time.Until(next))
+	}
+	close(starts)
+
+	// Starts that were due while every worker was busy were never sent.
+	end := time.Now()
+	unsent := make(recorder)
+	rng := rand.New(rand.NewPCG(opts.RandSeed, 0))
+	for ; !next.After(end); next = next.Add(interval) {
+		unsent.recordUnsent(nextOp(rng), next, end)
+	}
+	wg.Wait()
+	return append(recorders, unsent)
+}
+
+// runClosed runs Users loops that each start a request at the intended
+// time, or as soon as the previous response arrives if that is later, and
+// then schedule the next start a think time after this one. Without think
+// time there is no schedule and requests go back to back.
+func runClosed(ctx context.Context, w *Workload, opts Options) []recorder {
+	recorders := make([]recorder, opts.Users)
+	var wg sync.WaitGroup
+	for i := range recorders {
+		rec := make(recorder)
+		recorders[i] = rec
+		rng := rand.New(rand.NewPCG(opts.RandSeed, uint64(i)+1))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			intended := time.Now()
+			for {
+				if wait := time.Until(intended); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return
+					}
+				}
+				sent := time.Now()
+				op, status, err := w.Next(ctx, rng)
+				done := time.Now()
+				if ctx.Err() != nil {
+					// The run ended while this user was waiting, so neither
+					// this request nor the starts due since then got a
+					// response.
+					rec.record(op, 0, errRunEnded, intended, sent, done)
+					for opts.ThinkMax > 0 {
+						intended = intended.Add(thinkTime(opts, rng))
+						if intended.After(done) {
+							break
+						}
+						rec.recordUnsent(nextOp(rng), intended, done)
+					}
+					return
+				}
+				rec.record(op, status, err, intended, sent, done)
+
+				if opts.ThinkMax == 0 {
+					intended = done
+					continue
+				}
+				intended = intended.Add(thinkTime(opts, rng))
+			}
+		}()
+	}
+	wg.Wait()
+	return recorders
+}
+
+// thinkTime draws a user's time from one start to the next.
+func thinkTime(opts Options, rng *rand.Rand) time.Duration {
+	think := opts.ThinkMin
+	if span := opts.ThinkMax - opts.ThinkMin; span > 0 {
+		think += time.Duration(rng.Int64N(int64(span) + 1))
+	}
+	return think
+}
@@ -0,0 +1,122 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+// Operation names match the request names locustfile.py reports.
+const (
+	OpGetProduct = "GET /products/[id]"
+	OpAddProduct = "POST /products/[id]/details"
+)
+
+const (
+	seedCategories = 50
+	seedProducts   = 100
+)
+
+// Workload is the locustfile task mix: 9 product reads for every product
+// write, over a catalog seeded with 50 categories and 100 products.
+type Workload struct {
+	BaseURL string
+	Client  *http.Client
+
+	created       atomic.Int64 // products added by Next
+	shard, shards int
+}
+
+// NewWorkload returns a workload against baseURL. New products are numbered
+// from 101, after the seeded ones.
+func NewWorkload(baseURL string, client *http.Client) *Workload {
+	return &Workload{BaseURL: baseURL, Client: client, shards: 1}
+}
+
+// Partition makes this workload one of shards that run against the same
+// server at once: it only numbers new products 101+shard, 101+shard+shards,
+// and so on, so no two shards write the same product.
+func (w *Workload) Partition(shard, shards int) {
+	w.shard, w.shards = shard, shards
+}
+
+// Seed creates the categories and products the task mix reads. It is safe
+// to run against an already seeded server.
+func (w *Workload) Seed(ctx context.Context, rng *rand.Rand) error {
+	for i := 1; i <= seedCategories; i++ {
+		body := fmt.Sprintf(`{"name":"Category-%d"}`, i)
+		if _, err := w.do(ctx, http.MethodPut, fmt.Sprintf("/categories/%d", i), []byte(body)); err != nil {
+			return fmt.Errorf("seeding category %d: %w", i, err)
+		}
+	}
+	for i := 1; i <= seedProducts; i++ {
+		if _, err := w.do(ctx, http.MethodPost, fmt.Sprintf("/products/%d/details", i), productBody(i, rng)); err != nil {
+			return fmt.Errorf("seeding product %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Next picks the next task by the 9:1 weights and runs it, returning the
+// operation name and HTTP status. A transport failure returns status 0.
+func (w *Workload) Next(ctx context.Context, rng *rand.Rand) (string, int, error) {
+	op := nextOp(rng)
+	if op == OpGetProduct {
+		id := 1 + rng.IntN(seedProducts)
+		status, err := w.do(ctx, http.MethodGet, fmt.Sprintf("/products/%d", id), nil)
+		return op, status, err
+	}
+	id := seedProducts + 1 + w.shard + w.shards*int(w.created.Add(1)-1)
+	status, err := w.do(ctx, http.MethodPost, fmt.Sprintf("/products/%d/details", id), productBody(id, rng))
+	return op, status, err
+}
+
+// nextOp picks an operation by the 9:1 weights without running it.
+func nextOp(rng *rand.Rand) string {
+	if rng.IntN(10) < 9 {
+		return OpGetProduct
+	}
+	return OpAddProduct
+}
+
+func (w *Workload) do(ctx context.Context, method, path string, body []byte) (int, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, w.BaseURL+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain so the connection goes back to the pool.
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func productBody(id int, rng *rand.Rand) []byte {
+	body, _ := json.Marshal(map[string]any{
+		"product_id":    id,
+		"sku":           fmt.Sprintf("SKU-%04d", id),
+		"manufacturer":  fmt.Sprintf("Manufacturer-%d", id),
+		"category_id":   1 + rng.IntN(seedCategories),
+		"weight":        100 + rng.IntN(4901),
+		"some_other_id": 1 + rng.IntN(1000),
+	})
+	return body
+}
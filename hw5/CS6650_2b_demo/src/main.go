@@ -1,29 +1,305 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
+	"product-api/certs"
+	"product-api/cluster"
+	"product-api/config"
 	"product-api/handlers"
+	"product-api/metrics"
+	"product-api/raft"
+	"product-api/replication"
 	"product-api/store"
+	"product-api/tracing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 func main() {
+	cfg, opts, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	level, _ := cfg.Log.SlogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	productStore := store.NewProductStore()
-	productHandler := handlers.NewProductHandler(productStore)
+	categoryStore := store.NewCategoryStore()
+	inventoryStore := store.NewInventoryStore()
+	inventoryStore.StartExpiry(time.Second)
+	idempotencyStore := store.NewIdempotencyStore(time.Duration(cfg.Idempotency.TTL))
+	idempotencyStore.StartExpiry(time.Minute)
+
+	var exporter tracing.Exporter = tracing.NoopExporter{}
+	var collector *tracing.Collector
+	switch cfg.Tracing.Exporter {
+	case "file":
+		exporter, err = tracing.NewFileExporter(cfg.Tracing.File)
+		if err != nil {
+			log.Fatalf("tracing: %v", err)
+		}
+	case "memory":
+		collector = tracing.NewCollector(10000)
+		exporter = collector
+	}
+	tracer := tracing.NewTracer(exporter)
+
+	registry := metrics.NewRegistry()
+	var replicationLog *replication.Log
+	var follower *replication.Follower
+	switch cfg.Replication.Role {
+	case "leader":
+		replicationLog = replication.NewLog()
+		productStore.SetChangeHook(replicationLog.Append)
+		categoryStore.SetChangeHook(replicationLog.Append)
+		registry.GaugeFunc("replication_log_last_index", "Index of the newest change-log entry.",
+			func() float64 { return float64(replicationLog.LastIndex()) })
+	case "follower":
+		follower = replication.NewFollower(cfg.Replication.LeaderURL,
+			replication.StoreApplier(productStore, categoryStore),
+			replication.StoreRestorer(productStore, categoryStore))
+		go follower.Run(ctx)
+		registry.GaugeFunc("replication_follower_lag_entries", "Change-log entries the follower has not applied yet.",
+			func() float64 { return float64(follower.Status().LagEntries) })
+		registry.GaugeFunc("replication_follower_lag_seconds", "Seconds since the follower was last caught up with the leader.",
+			func() float64 { return follower.Status().LagSeconds })
+		registry.GaugeFunc("replication_follower_applied_index", "Index of the last change-log entry applied.",
+			func() float64 { return float64(follower.Status().AppliedIndex) })
+	}
+
+	var raftNode *raft.Node
+	var raftPeers map[uint64]*url.URL
+	var catalogFSM *handlers.CatalogFSM
+	if cfg.Raft.Enabled() {
+		raftPeers, _ = cfg.Raft.PeerURLs()
+		var storage raft.Storage = raft.NewMemoryStorage()
+		if cfg.Raft.DataDir != "" {
+			storage, err = raft.NewFileStorage(cfg.Raft.DataDir)
+			if err != nil {
+				log.Fatalf("raft: %v", err)
+			}
+		}
+
+		ids := make([]uint64, 0, len(raftPeers))
+		others := make(map[uint64]string)
+		for id, u := range raftPeers {
+			ids = append(ids, id)
+			if id != uint64(cfg.Raft.ID) {
+				others[id] = u.String()
+			}
+		}
+		slices.Sort(ids)
+		transport := raft.NewHTTPTransport(others, cfg.Raft.Secret)
+		transport.Start(ctx)
+
+		catalogFSM = handlers.NewCatalogFSM(productStore, categoryStore)
+		raftNode, err = raft.NewNode(raft.Config{
+			ID:                uint64(cfg.Raft.ID),
+			Peers:             ids,
+			ElectionTicks:     cfg.Raft.ElectionTicks,
+			HeartbeatTicks:    1,
+			SnapshotThreshold: uint64(cfg.Raft.SnapshotThreshold),
+			Storage:           storage,
+			StateMachine:      catalogFSM,
+			Send:              transport.Send,
+		})
+		if err != nil {
+			log.Fatalf("raft: %v", err)
+		}
+		go raftNode.Run(ctx, time.Duration(cfg.Raft.Tick))
+
+		registry.GaugeFunc("raft_term", "Current Raft term.",
+			func() float64 { return float64(raftNode.Status().Term) })
+		registry.GaugeFunc("raft_is_leader", "1 if this node is the Raft leader, else 0.",
+			func() float64 {
+				if raftNode.Status().State == raft.Leader {
+					return 1
+				}
+				return 0
+			})
+		registry.GaugeFunc("raft_commit_index", "Index of the newest committed Raft log entry.",
+			func() float64 { return float64(raftNode.Status().CommitIndex) })
+		registry.GaugeFunc("raft_applied_index", "Index of the newest Raft log entry applied to the catalog.",
+			func() float64 { return float64(raftNode.Status().AppliedIndex) })
+		registry.GaugeFunc("raft_snapshot_index", "Index covered by the latest Raft snapshot.",
+			func() float64 { return float64(raftNode.Status().SnapshotIndex) })
+	}
+
+	var clusterHandler *handlers.ClusterHandler
+	if cfg.Cluster.Enabled() {
+		members, _ := cfg.Cluster.MemberURLs()
+		ring := cluster.New(cfg.Cluster.NodeID, members, cfg.Cluster.VirtualNodes)
+		clusterHandler = handlers.NewClusterHandler(ring, cfg.Cluster.Secret, productStore, categoryStore, inventoryStore, registry)
+		clusterHandler.StartRebalance(30 * time.Second)
+	}
+
+	productHandler := handlers.NewProductHandler(productStore, categoryStore)
+	categoryHandler := handlers.NewCategoryHandler(categoryStore, productStore)
+	inventoryHandler := handlers.NewInventoryHandler(inventoryStore, productStore)
 
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	if cfg.Log.Requests {
+		r.Use(handlers.LogRequests(slog.Default()))
+	}
+	r.Use(tracing.Middleware(tracer))
 	r.Use(middleware.Recoverer)
+	if cfg.RateLimit.RPS > 0 {
+		r.Use(handlers.RateLimit(cfg.RateLimit.RPS, cfg.RateLimit.Burst))
+	}
+	if cfg.Admission.Enabled {
+		r.Use(handlers.Admission(handlers.AdmissionLimits{
+			Initial:    cfg.Admission.InitialLimit,
+			Min:        cfg.Admission.MinLimit,
+			Max:        cfg.Admission.MaxLimit,
+			WriteShare: cfg.Admission.WriteShare,
+		}, registry))
+	}
+	var faultStore *store.FaultStore
+	if cfg.Faults.Enabled {
+		faultStore = store.NewFaultStore()
+		r.Use(handlers.Faults(faultStore))
+	}
+	// Idempotency goes before the middleware that answers writes itself
+	// (by redirecting, proposing them to Raft or forwarding them to their
+	// owner), so retries of those writes are replayed too.
+	r.Use(handlers.Idempotency(idempotencyStore))
+	if follower != nil {
+		leaderURL, _ := url.Parse(cfg.Replication.LeaderURL)
+		r.Use(handlers.FollowerWrites(cfg.Replication.FollowerWrites, leaderURL))
+	}
+	if raftNode != nil {
+		r.Use(handlers.RaftWrites(raftNode, catalogFSM, raftPeers))
+	}
+	if clusterHandler != nil {
+		r.Use(handlers.ClusterRouting(clusterHandler))
+	}
+
+	r.Get("/metrics", registry.ServeHTTP)
+	if collector != nil {
+		r.Get("/debug/traces", collector.ServeHTTP)
+	}
+	if replicationLog != nil {
+		replicationHandler := handlers.NewReplicationHandler(replicationLog)
+		r.Get("/replication/log", replicationHandler.GetLog)
+		r.Get("/replication/status", replicationHandler.GetStatus)
+	}
+	if follower != nil {
+		r.Get("/replication/status", handlers.FollowerStatus(follower))
+	}
+	if raftNode != nil {
+		raftHandler := handlers.NewRaftHandler(raftNode, cfg.Raft.Secret)
+		r.Post("/raft/message", raftHandler.Message)
+		r.Get("/raft/status", raftHandler.GetStatus)
+	}
+	if faultStore != nil {
+		faultHandler := handlers.NewFaultHandler(faultStore)
+		r.Get("/admin/faults", faultHandler.ListFaults)
+		r.Post("/admin/faults", faultHandler.AddFault)
+		r.Put("/admin/faults", faultHandler.ReplaceFaults)
+		r.Delete("/admin/faults", faultHandler.ClearFaults)
+		r.Delete("/admin/faults/{faultId}", faultHandler.DeleteFault)
+	}
+	if clusterHandler != nil {
+		r.Get("/cluster/ring", clusterHandler.GetRing)
+		r.Put("/cluster/members", clusterHandler.PutMembers)
+		r.Post("/cluster/handoff", clusterHandler.Handoff)
+	}
 
 	r.Get("/products/{productId}", productHandler.GetProduct)
 	r.Post("/products/{productId}/details", productHandler.AddProductDetails)
 
-	port := 8080
-	fmt.Printf("Product API server starting on :%d\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), r))
+	r.Get("/products/{productId}/inventory", inventoryHandler.GetInventory)
+	r.Put("/products/{productId}/inventory", inventoryHandler.SetStock)
+	r.Post("/products/{productId}/reservations", inventoryHandler.Reserve)
+	r.Post("/reservations/{reservationId}/commit", inventoryHandler.CommitReservation)
+	r.Post("/reservations/{reservationId}/release", inventoryHandler.ReleaseReservation)
+
+	r.Get("/categories", categoryHandler.ListCategories)
+	r.Post("/categories", categoryHandler.CreateCategory)
+	r.Get("/categories/{categoryId}", categoryHandler.GetCategory)
+	r.Put("/categories/{categoryId}", categoryHandler.UpsertCategory)
+	r.Delete("/categories/{categoryId}", categoryHandler.DeleteCategory)
+	r.Get("/categories/{categoryId}/products", categoryHandler.ListCategoryProducts)
+
+	srv := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+		Protocols:    new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	if cfg.TLS.Enabled() {
+		clientAuth, _ := cfg.TLS.ClientAuthType()
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, clientAuth)
+		if err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+		reloader.Watch(time.Duration(cfg.TLS.ReloadInterval))
+		srv.TLSConfig = reloader.TLSConfig(cfg.Server.HTTP2)
+		srv.Protocols.SetHTTP2(cfg.Server.HTTP2)
+	} else {
+		srv.Protocols.SetUnencryptedHTTP2(cfg.Server.H2C)
+	}
+
+	if replicationLog != nil {
+		srv.RegisterOnShutdown(replicationLog.Close)
+	}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown", "err", err)
+		}
+	}()
+
+	if cfg.TLS.Enabled() {
+		fmt.Printf("Product API server starting on %s (TLS)\n", cfg.Server.Addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		fmt.Printf("Product API server starting on %s\n", cfg.Server.Addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+	if raftNode != nil {
+		raftNode.Stop()
+	}
+	if err := exporter.Close(); err != nil {
+		slog.Error("closing span exporter", "err", err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,104 @@
+// Package metrics is a minimal counter/gauge registry that serves the
+// Prometheus text exposition format at /metrics.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds named metrics. Names may carry a label set, e.g.
+// `shed_total{method="GET"}`; HELP and TYPE lines are emitted once per base name.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric struct {
+	kind  string
+	help  string
+	value func() float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct{ n atomic.Uint64 }
+
+func (c *Counter) Inc()          { c.n.Add(1) }
+func (c *Counter) Add(n uint64)  { c.n.Add(n) }
+func (c *Counter) Value() uint64 { return c.n.Load() }
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ bits atomic.Uint64 }
+
+func (g *Gauge) Set(v float64)  { g.bits.Store(math.Float64bits(v)) }
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+// Counter registers a counter called name.
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, "counter", help, func() float64 { return float64(c.Value()) })
+	return c
+}
+
+// Gauge registers a gauge called name.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, "gauge", help, g.Value)
+	return g
+}
+
+// GaugeFunc registers a gauge whose value is computed by fn at scrape time.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, "gauge", help, fn)
+}
+
+// ServeHTTP writes every metric in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snapshot := make([]metric, len(names))
+	for i, name := range names {
+		snapshot[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	lastBase := ""
+	for i, name := range names {
+		m := snapshot[i]
+		if base := baseName(name); base != lastBase {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", base, m.help, base, m.kind)
+			lastBase = base
+		}
+		fmt.Fprintf(w, "%s %g\n", name, m.value())
+	}
+}
+
+func (r *Registry) register(name, kind, help string, value func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic("metrics: duplicate registration of " + name)
+	}
+	r.metrics[name] = metric{kind: kind, help: help, value: value}
+}
+
+func baseName(name string) string {
+	if i := strings.IndexByte(name, '{'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,9 @@
+package models
+
+// Category is a node in the product category hierarchy.
+// A nil ParentID marks a root category.
+type Category struct {
+	CategoryID int    `json:"category_id"`
+	Name       string `json:"name"`
+	ParentID   *int   `json:"parent_id,omitempty"`
+}
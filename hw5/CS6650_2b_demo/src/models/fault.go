@@ -0,0 +1,27 @@
+package models
+
+// Fault kinds a FaultRule can inject after its latency.
+const (
+	FaultNone     = ""         // only add latency
+	FaultError    = "error"    // respond with Status instead of running the handler
+	FaultReset    = "reset"    // drop the connection without responding
+	FaultTruncate = "truncate" // send the real headers and half of the body, then drop the connection
+)
+
+// FaultRule injects a fault into Percent of the requests it matches. Empty
+// match fields match every request.
+type FaultRule struct {
+	ID          int     `json:"id"`
+	Route       string  `json:"route,omitempty"`        // e.g. /products/{productId}; a trailing /* matches any rest of the path
+	Method      string  `json:"method,omitempty"`
+	Header      string  `json:"header,omitempty"`       // request header that must be present
+	HeaderValue string  `json:"header_value,omitempty"` // and, if set, equal this
+	Percent     float64 `json:"percent"`                // of matching requests, 0-100
+	LatencyMs   int     `json:"latency_ms,omitempty"`
+	Fault       string  `json:"fault,omitempty"`
+	Status      int     `json:"status,omitempty"` // for "error", default 503
+
+	// Read-only counters.
+	Matched  uint64 `json:"matched"`
+	Injected uint64 `json:"injected"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Inventory is the stock level for a single product.
+// Available is always OnHand - Reserved and never negative.
+type Inventory struct {
+	ProductID int `json:"product_id"`
+	OnHand    int `json:"on_hand"`
+	Reserved  int `json:"reserved"`
+	Available int `json:"available"`
+}
+
+// Reservation holds stock for a product until it is committed, released,
+// or expires.
+type Reservation struct {
+	ReservationID int       `json:"reservation_id"`
+	ProductID     int       `json:"product_id"`
+	Quantity      int       `json:"quantity"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
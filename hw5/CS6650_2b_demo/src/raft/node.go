@@ -0,0 +1,649 @@
+// Package raft is a small Raft implementation: leader election, log
+// replication and snapshotting over a fixed set of peers.
+//
+// A Node never starts goroutines or timers of its own. Time advances only
+// through Tick and messages arrive only through Step, and outgoing messages
+// are handed to Config.Send. That keeps the protocol deterministic, so the
+// raftsim package can drive whole clusters on a virtual clock; Run and
+// HTTPTransport adapt a Node to real time and a real network.
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxAppendEntries bounds how many entries one MsgAppend carries.
+const maxAppendEntries = 256
+
+type Config struct {
+	ID    uint64
+	Peers []uint64 // every member, including ID
+
+	// ElectionTicks is the minimum election timeout; each follower waits a
+	// random number of ticks in [ElectionTicks, 2*ElectionTicks).
+	ElectionTicks  int
+	HeartbeatTicks int
+	// SnapshotThreshold compacts the log once this many entries have been
+	// applied since the last snapshot. Zero disables snapshots.
+	SnapshotThreshold uint64
+
+	Storage      Storage
+	StateMachine StateMachine
+	// Send delivers a message to another node. It is never called with the
+	// node's lock held, and may drop messages.
+	Send func(Message)
+	// Rand seeds election timeouts. Nil uses a random seed.
+	Rand *rand.Rand
+}
+
+type applyResult struct {
+	value any
+	err   error
+}
+
+type waiter struct {
+	term uint64
+	ch   chan applyResult
+}
+
+type Node struct {
+	mu  sync.Mutex
+	cfg Config
+	rng *rand.Rand
+
+	state  State
+	term   uint64
+	vote   uint64
+	leader uint64
+
+	// log[0] is a sentinel holding the snapshot's index and term;
+	// real entries follow it.
+	log         []Entry
+	snapshot    Snapshot
+	commitIndex uint64
+	applied     uint64
+
+	electionElapsed  int
+	heartbeatElapsed int
+	electionTimeout  int
+
+	votes      map[uint64]bool
+	nextIndex  map[uint64]uint64
+	matchIndex map[uint64]uint64
+	// active records which peers responded during the current election
+	// timeout, so a leader cut off from a quorum steps down.
+	active map[uint64]bool
+
+	waiters map[uint64]waiter
+	outbox  []Message
+	stopped bool
+}
+
+// NewNode restores a node from cfg.Storage, replaying its snapshot into the
+// state machine. Committed entries after the snapshot are re-applied once
+// the node learns the commit index from a leader.
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.ElectionTicks <= 0 {
+		cfg.ElectionTicks = 10
+	}
+	if cfg.HeartbeatTicks <= 0 {
+		cfg.HeartbeatTicks = 1
+	}
+	if cfg.HeartbeatTicks >= cfg.ElectionTicks {
+		return nil, fmt.Errorf("raft: heartbeat ticks (%d) must be below election ticks (%d)", cfg.HeartbeatTicks, cfg.ElectionTicks)
+	}
+	if !slices.Contains(cfg.Peers, cfg.ID) {
+		return nil, fmt.Errorf("raft: peers %v must include node %d", cfg.Peers, cfg.ID)
+	}
+	cfg.Peers = slices.Clone(cfg.Peers)
+	slices.Sort(cfg.Peers)
+
+	rng := cfg.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), cfg.ID))
+	}
+
+	p, err := cfg.Storage.Load()
+	if err != nil {
+		return nil, fmt.Errorf("raft: loading state: %w", err)
+	}
+
+	n := &Node{
+		cfg:      cfg,
+		rng:      rng,
+		state:    Follower,
+		term:     p.HardState.Term,
+		vote:     p.HardState.Vote,
+		snapshot: p.Snapshot,
+		waiters:  make(map[uint64]waiter),
+	}
+	n.log = append([]Entry{{Index: p.Snapshot.Index, Term: p.Snapshot.Term}}, p.Entries...)
+	if p.Snapshot.Index > 0 {
+		if err := cfg.StateMachine.Restore(p.Snapshot.Data); err != nil {
+			return nil, fmt.Errorf("raft: restoring snapshot: %w", err)
+		}
+	}
+	n.commitIndex = p.Snapshot.Index
+	n.applied = p.Snapshot.Index
+	n.resetElectionTimeout()
+	return n, nil
+}
+
+// Tick advances the node's logical clock by one unit.
+func (n *Node) Tick() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
+	}
+	if n.state == Leader {
+		n.tickLeader()
+	} else {
+		n.electionElapsed++
+		if n.electionElapsed >= n.electionTimeout {
+			n.campaign()
+		}
+	}
+	n.flush()
+}
+
+// Step processes a message from another node.
+func (n *Node) Step(m Message) {
+	n.mu.Lock()
+	if n.stopped || m.To != n.cfg.ID {
+		n.mu.Unlock()
+		return
+	}
+	n.step(m)
+	n.flush()
+}
+
+// Propose appends data to the log if this node is the leader and returns the
+// entry's index and term. It does not wait for the entry to commit.
+func (n *Node) Propose(data []byte) (uint64, uint64, error) {
+	n.mu.Lock()
+	index, term, err := n.propose(data, nil)
+	n.flush()
+	return index, term, err
+}
+
+// ProposeWait proposes data and waits until it has been applied on this
+// node, returning the state machine's result.
+func (n *Node) ProposeWait(ctx context.Context, data []byte) (any, error) {
+	ch := make(chan applyResult, 1)
+
+	n.mu.Lock()
+	index, _, err := n.propose(data, ch)
+	n.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res.value, res.err
+	case <-ctx.Done():
+		n.mu.Lock()
+		delete(n.waiters, index)
+		n.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Status returns the node's current view of the cluster.
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:            n.cfg.ID,
+		State:         n.state,
+		Term:          n.term,
+		Leader:        n.leader,
+		CommitIndex:   n.commitIndex,
+		AppliedIndex:  n.applied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshot.Index,
+	}
+}
+
+// Stop makes the node ignore further ticks and messages and fails pending
+// proposals. It models a crash: persisted state stays in Storage.
+func (n *Node) Stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stopped = true
+	for index, w := range n.waiters {
+		w.ch <- applyResult{err: ErrStopped}
+		delete(n.waiters, index)
+	}
+	n.outbox = nil
+}
+
+// Run calls Tick every interval until ctx is done.
+func (n *Node) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.Tick()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// --- State transitions (caller holds n.mu) ---
+
+func (n *Node) becomeFollower(term, leader uint64) {
+	if term != n.term {
+		n.term = term
+		n.vote = 0
+		n.persist()
+	}
+	n.state = Follower
+	n.leader = leader
+	n.electionElapsed = 0
+	n.resetElectionTimeout()
+}
+
+func (n *Node) campaign() {
+	n.state = Candidate
+	n.term++
+	n.vote = n.cfg.ID
+	n.leader = 0
+	n.persist()
+	n.electionElapsed = 0
+	n.resetElectionTimeout()
+
+	n.votes = map[uint64]bool{n.cfg.ID: true}
+	if n.quorum() == 1 {
+		n.becomeLeader()
+		return
+	}
+	for _, p := range n.cfg.Peers {
+		if p == n.cfg.ID {
+			continue
+		}
+		n.send(Message{
+			Type:         MsgVote,
+			To:           p,
+			LastLogIndex: n.lastIndex(),
+			LastLogTerm:  n.lastTerm(),
+		})
+	}
+}
+
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leader = n.cfg.ID
+	n.heartbeatElapsed = 0
+	n.electionElapsed = 0
+	n.nextIndex = make(map[uint64]uint64)
+	n.matchIndex = make(map[uint64]uint64)
+	n.active = make(map[uint64]bool)
+	for _, p := range n.cfg.Peers {
+		n.nextIndex[p] = n.lastIndex() + 1
+		n.matchIndex[p] = 0
+	}
+	// A no-op entry in the new term lets the leader commit everything before it.
+	n.appendLocal(nil)
+	n.maybeCommit()
+	n.broadcastAppend()
+}
+
+func (n *Node) tickLeader() {
+	n.heartbeatElapsed++
+	n.electionElapsed++
+	if n.electionElapsed >= n.cfg.ElectionTicks {
+		n.electionElapsed = 0
+		// Check quorum: a leader that hasn't heard from a majority during an
+		// election timeout is probably partitioned away, so it steps down
+		// instead of accepting proposals it can never commit.
+		n.active[n.cfg.ID] = true
+		if len(n.active) < n.quorum() {
+			n.becomeFollower(n.term, 0)
+			return
+		}
+		n.active = make(map[uint64]bool)
+	}
+	if n.heartbeatElapsed >= n.cfg.HeartbeatTicks {
+		n.heartbeatElapsed = 0
+		n.broadcastAppend()
+	}
+}
+
+// propose appends data to the log. A non-nil ch is registered to receive the
+// apply result before anything can commit.
+func (n *Node) propose(data []byte, ch chan applyResult) (uint64, uint64, error) {
+	if n.stopped {
+		return 0, 0, ErrStopped
+	}
+	if len(data) == 0 {
+		return 0, 0, errors.New("raft: empty proposal")
+	}
+	if n.state != Leader {
+		return 0, 0, ErrNotLeader
+	}
+	e := n.appendLocal(data)
+	if ch != nil {
+		n.waiters[e.Index] = waiter{term: e.Term, ch: ch}
+	}
+	n.maybeCommit()
+	n.broadcastAppend()
+	return e.Index, e.Term, nil
+}
+
+// --- Message handling (caller holds n.mu) ---
+
+func (n *Node) step(m Message) {
+	switch {
+	case m.Term > n.term:
+		var leader uint64
+		if m.Type == MsgAppend || m.Type == MsgSnapshot {
+			leader = m.From
+		}
+		n.becomeFollower(m.Term, leader)
+	case m.Term < n.term:
+		// Tell a stale leader or candidate about the newer term.
+		switch m.Type {
+		case MsgAppend, MsgSnapshot:
+			n.send(Message{Type: MsgAppendResp, To: m.From, HintIndex: n.lastIndex()})
+		case MsgVote:
+			n.send(Message{Type: MsgVoteResp, To: m.From})
+		}
+		return
+	}
+
+	switch m.Type {
+	case MsgVote:
+		n.handleVote(m)
+	case MsgVoteResp:
+		n.handleVoteResp(m)
+	case MsgAppend:
+		n.handleAppend(m)
+	case MsgAppendResp:
+		n.handleAppendResp(m)
+	case MsgSnapshot:
+		n.handleSnapshot(m)
+	}
+}
+
+func (n *Node) handleVote(m Message) {
+	upToDate := m.LastLogTerm > n.lastTerm() ||
+		(m.LastLogTerm == n.lastTerm() && m.LastLogIndex >= n.lastIndex())
+	grant := (n.vote == 0 || n.vote == m.From) && upToDate && n.state != Leader
+	if grant {
+		n.vote = m.From
+		n.persist()
+		n.electionElapsed = 0
+	}
+	n.send(Message{Type: MsgVoteResp, To: m.From, Granted: grant})
+}
+
+func (n *Node) handleVoteResp(m Message) {
+	if n.state != Candidate {
+		return
+	}
+	n.votes[m.From] = m.Granted
+	granted, rejected := 0, 0
+	for _, g := range n.votes {
+		if g {
+			granted++
+		} else {
+			rejected++
+		}
+	}
+	switch {
+	case granted >= n.quorum():
+		n.becomeLeader()
+	case rejected >= n.quorum():
+		n.becomeFollower(n.term, 0)
+	}
+}
+
+func (n *Node) handleAppend(m Message) {
+	n.becomeFollower(n.term, m.From)
+
+	prevIndex, prevTerm, entries := m.PrevIndex, m.PrevTerm, m.Entries
+	// Entries at or before our snapshot are committed and already applied.
+	if prevIndex < n.snapshot.Index {
+		skip := 0
+		for skip < len(entries) && entries[skip].Index <= n.snapshot.Index {
+			skip++
+		}
+		entries = entries[skip:]
+		prevIndex, prevTerm = n.snapshot.Index, n.snapshot.Term
+	}
+
+	if prevIndex > n.lastIndex() || n.termAt(prevIndex) != prevTerm {
+		n.send(Message{Type: MsgAppendResp, To: m.From, HintIndex: min(n.lastIndex(), prevIndex-1)})
+		return
+	}
+
+	changed := false
+	for i, e := range entries {
+		if e.Index <= n.lastIndex() {
+			if n.termAt(e.Index) == e.Term {
+				continue
+			}
+			// Conflict: drop our entry and everything after it.
+			n.log = n.log[:e.Index-n.snapshot.Index]
+		}
+		n.log = append(n.log, entries[i:]...)
+		changed = true
+		break
+	}
+	if changed {
+		n.persist()
+	}
+
+	matched := prevIndex + uint64(len(entries))
+	if commit := min(m.Commit, matched); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.applyCommitted()
+	}
+	n.send(Message{Type: MsgAppendResp, To: m.From, Success: true, MatchIndex: matched})
+}
+
+func (n *Node) handleAppendResp(m Message) {
+	if n.state != Leader {
+		return
+	}
+	n.active[m.From] = true
+	if m.Success {
+		if m.MatchIndex > n.matchIndex[m.From] {
+			n.matchIndex[m.From] = m.MatchIndex
+		}
+		n.nextIndex[m.From] = n.matchIndex[m.From] + 1
+		n.maybeCommit()
+		if n.nextIndex[m.From] <= n.lastIndex() {
+			n.sendAppend(m.From)
+		}
+		return
+	}
+	// Back off to just past the follower's hint, never below what it matched.
+	next := min(n.nextIndex[m.From]-1, m.HintIndex+1)
+	n.nextIndex[m.From] = max(next, n.matchIndex[m.From]+1, 1)
+	n.sendAppend(m.From)
+}
+
+func (n *Node) handleSnapshot(m Message) {
+	n.becomeFollower(n.term, m.From)
+	snap := m.Snapshot
+	if snap == nil || snap.Index <= n.commitIndex {
+		n.send(Message{Type: MsgAppendResp, To: m.From, Success: true, MatchIndex: n.commitIndex})
+		return
+	}
+	if err := n.cfg.StateMachine.Restore(snap.Data); err != nil {
+		// Leave the log untouched; the leader will retry.
+		return
+	}
+	n.failWaitersThrough(snap.Index)
+	// Keep any entries past the snapshot that we already have and that
+	// agree with it: they may have been acknowledged to the leader.
+	tail := []Entry(nil)
+	if snap.Index <= n.lastIndex() && n.termAt(snap.Index) == snap.Term {
+		tail = slices.Clone(n.log[snap.Index-n.snapshot.Index+1:])
+	}
+	n.snapshot = *snap
+	n.log = append([]Entry{{Index: snap.Index, Term: snap.Term}}, tail...)
+	n.commitIndex = snap.Index
+	n.applied = snap.Index
+	n.persist()
+	n.send(Message{Type: MsgAppendResp, To: m.From, Success: true, MatchIndex: snap.Index})
+}
+
+// --- Log replication (caller holds n.mu) ---
+
+func (n *Node) broadcastAppend() {
+	for _, p := range n.cfg.Peers {
+		if p != n.cfg.ID {
+			n.sendAppend(p)
+		}
+	}
+}
+
+func (n *Node) sendAppend(to uint64) {
+	next := n.nextIndex[to]
+	if next <= n.snapshot.Index {
+		snap := n.snapshot
+		n.send(Message{Type: MsgSnapshot, To: to, Snapshot: &snap})
+		return
+	}
+	prev := next - 1
+	var entries []Entry
+	if next <= n.lastIndex() {
+		end := min(n.lastIndex(), prev+maxAppendEntries)
+		entries = slices.Clone(n.log[next-n.snapshot.Index : end-n.snapshot.Index+1])
+	}
+	n.send(Message{
+		Type:      MsgAppend,
+		To:        to,
+		PrevIndex: prev,
+		PrevTerm:  n.termAt(prev),
+		Entries:   entries,
+		Commit:    n.commitIndex,
+	})
+}
+
+func (n *Node) appendLocal(data []byte) Entry {
+	e := Entry{Index: n.lastIndex() + 1, Term: n.term, Data: data}
+	n.log = append(n.log, e)
+	n.matchIndex[n.cfg.ID] = e.Index
+	n.persist()
+	return e
+}
+
+// maybeCommit advances the commit index to the highest entry from the
+// current term that a quorum has stored.
+func (n *Node) maybeCommit() {
+	matches := make([]uint64, 0, len(n.cfg.Peers))
+	for _, p := range n.cfg.Peers {
+		matches = append(matches, n.matchIndex[p])
+	}
+	slices.Sort(matches)
+	candidate := matches[len(matches)-n.quorum()]
+	if candidate > n.commitIndex && n.termAt(candidate) == n.term {
+		n.commitIndex = candidate
+		n.applyCommitted()
+	}
+}
+
+func (n *Node) applyCommitted() {
+	for n.applied < n.commitIndex {
+		n.applied++
+		e := n.log[n.applied-n.snapshot.Index]
+		var value any
+		if e.Data != nil {
+			value = n.cfg.StateMachine.Apply(e.Index, e.Data)
+		}
+		if w, ok := n.waiters[e.Index]; ok {
+			delete(n.waiters, e.Index)
+			if w.term == e.Term {
+				w.ch <- applyResult{value: value}
+			} else {
+				w.ch <- applyResult{err: ErrDropped}
+			}
+		}
+	}
+	n.maybeSnapshot()
+}
+
+func (n *Node) maybeSnapshot() {
+	if n.cfg.SnapshotThreshold == 0 || n.applied-n.snapshot.Index < n.cfg.SnapshotThreshold {
+		return
+	}
+	data, err := n.cfg.StateMachine.Snapshot()
+	if err != nil {
+		return
+	}
+	term := n.termAt(n.applied)
+	n.log = append([]Entry{{Index: n.applied, Term: term}}, n.log[n.applied-n.snapshot.Index+1:]...)
+	n.snapshot = Snapshot{Index: n.applied, Term: term, Data: data}
+	n.persist()
+}
+
+// --- Helpers (caller holds n.mu) ---
+
+func (n *Node) lastIndex() uint64 { return n.log[len(n.log)-1].Index }
+func (n *Node) lastTerm() uint64  { return n.log[len(n.log)-1].Term }
+
+// termAt returns the term of the entry at index, or 0 if it has been
+// compacted away or doesn't exist.
+func (n *Node) termAt(index uint64) uint64 {
+	if index < n.snapshot.Index || index > n.lastIndex() {
+		return 0
+	}
+	return n.log[index-n.snapshot.Index].Term
+}
+
+func (n *Node) quorum() int { return len(n.cfg.Peers)/2 + 1 }
+
+func (n *Node) resetElectionTimeout() {
+	n.electionTimeout = n.cfg.ElectionTicks + n.rng.IntN(n.cfg.ElectionTicks)
+}
+
+func (n *Node) persist() {
+	err := n.cfg.Storage.Save(&Persisted{
+		HardState: HardState{Term: n.term, Vote: n.vote},
+		Snapshot:  n.snapshot,
+		Entries:   n.log[1:],
+	})
+	if err != nil {
+		// Continuing without durable state could violate safety after a restart.
+		panic(fmt.Sprintf("raft: node %d: persisting state: %v", n.cfg.ID, err))
+	}
+}
+
+func (n *Node) failWaitersThrough(index uint64) {
+	for i, w := range n.waiters {
+		if i <= index {
+			w.ch <- applyResult{err: ErrDropped}
+			delete(n.waiters, i)
+		}
+	}
+}
+
+func (n *Node) send(m Message) {
+	m.From = n.cfg.ID
+	m.Term = n.term
+	n.outbox = append(n.outbox, m)
+}
+
+// flush unlocks n.mu and then hands queued messages to Send, so transports
+// that deliver synchronously can't deadlock against this node.
+func (n *Node) flush() {
+	out := n.outbox
+	n.outbox = nil
+	n.mu.Unlock()
+	for _, m := range out {
+		n.cfg.Send(m)
+	}
+}
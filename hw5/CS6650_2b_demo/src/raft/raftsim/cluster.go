@@ -0,0 +1,349 @@
+// Package raftsim runs in-process Raft clusters on a virtual clock with a
+// seeded, simulated network, so partitions, message loss and node crashes
+// replay identically for a given seed.
+package raftsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"product-api/raft"
+)
+
+// Options configures a simulated cluster.
+type Options struct {
+	Nodes             int
+	Seed              uint64
+	SnapshotThreshold uint64
+	// DropRate is the probability that any single message is lost.
+	DropRate float64
+	// Messages take between MinDelay and MaxDelay ticks to arrive.
+	MinDelay, MaxDelay int
+}
+
+type inflight struct {
+	at  int
+	seq uint64
+	m   raft.Message
+}
+
+// Cluster is a set of raft.Nodes wired to a simulated network.
+type Cluster struct {
+	opts Options
+	rng  *rand.Rand
+	ids  []uint64
+
+	nodes    map[uint64]*raft.Node
+	storages map[uint64]*raft.MemoryStorage
+	fsms     map[uint64]*LogFSM
+	crashed  map[uint64]bool
+	restarts map[uint64]uint64
+	blocked  map[[2]uint64]bool
+
+	queue []inflight
+	seq   uint64
+	now   int
+
+	// leaders remembers who led each term, to check election safety.
+	leaders   map[uint64]uint64
+	violation error
+}
+
+func NewCluster(opts Options) (*Cluster, error) {
+	if opts.Nodes < 1 {
+		return nil, fmt.Errorf("raftsim: need at least one node")
+	}
+	if opts.MinDelay < 1 {
+		opts.MinDelay = 1
+	}
+	if opts.MaxDelay < opts.MinDelay {
+		opts.MaxDelay = opts.MinDelay + 2
+	}
+	c := &Cluster{
+		opts:     opts,
+		rng:      rand.New(rand.NewPCG(opts.Seed, 0x5eed)),
+		nodes:    make(map[uint64]*raft.Node),
+		storages: make(map[uint64]*raft.MemoryStorage),
+		fsms:     make(map[uint64]*LogFSM),
+		crashed:  make(map[uint64]bool),
+		restarts: make(map[uint64]uint64),
+		blocked:  make(map[[2]uint64]bool),
+		leaders:  make(map[uint64]uint64),
+	}
+	for i := 1; i <= opts.Nodes; i++ {
+		c.ids = append(c.ids, uint64(i))
+	}
+	for _, id := range c.ids {
+		c.storages[id] = raft.NewMemoryStorage()
+		if err := c.start(id); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// IDs returns every node ID in the cluster.
+func (c *Cluster) IDs() []uint64 { return slices.Clone(c.ids) }
+
+// Now returns the number of ticks simulated so far.
+func (c *Cluster) Now() int { return c.now }
+
+// Step advances virtual time by one tick: due messages are delivered,
+// then every live node ticks, then safety invariants are checked.
+func (c *Cluster) Step() {
+	c.now++
+	for len(c.queue) > 0 && c.queue[0].at <= c.now {
+		msg := c.queue[0].m
+		c.queue = c.queue[1:]
+		if !c.crashed[msg.To] && !c.blocked[[2]uint64{msg.From, msg.To}] {
+			c.nodes[msg.To].Step(msg)
+		}
+	}
+	for _, id := range c.ids {
+		if !c.crashed[id] {
+			c.nodes[id].Tick()
+		}
+	}
+	c.check()
+}
+
+// Run advances n ticks.
+func (c *Cluster) Run(n int) {
+	for range n {
+		c.Step()
+	}
+}
+
+// RunUntil steps until cond holds, failing after max ticks.
+func (c *Cluster) RunUntil(desc string, max int, cond func() bool) error {
+	for range max {
+		if cond() {
+			return nil
+		}
+		c.Step()
+	}
+	if cond() {
+		return nil
+	}
+	return fmt.Errorf("tick %d: timed out after %d ticks waiting for %s", c.now, max, desc)
+}
+
+// Leader returns the live leader with the highest term, if any.
+func (c *Cluster) Leader() (uint64, bool) {
+	var leader, term uint64
+	for _, id := range c.ids {
+		if c.crashed[id] {
+			continue
+		}
+		st := c.nodes[id].Status()
+		if st.State == raft.Leader && st.Term >= term {
+			leader, term = id, st.Term
+		}
+	}
+	return leader, leader != 0
+}
+
+// Propose submits data through the node id.
+func (c *Cluster) Propose(id uint64, data string) (uint64, error) {
+	if c.crashed[id] {
+		return 0, fmt.Errorf("node %d is down", id)
+	}
+	index, _, err := c.nodes[id].Propose([]byte(data))
+	return index, err
+}
+
+// Status returns node id's status.
+func (c *Cluster) Status(id uint64) raft.Status { return c.nodes[id].Status() }
+
+// Applied returns the commands node id has applied, in order.
+func (c *Cluster) Applied(id uint64) []string { return c.fsms[id].Commands() }
+
+// Crash stops node id, keeping its persisted state.
+func (c *Cluster) Crash(id uint64) {
+	if c.crashed[id] {
+		return
+	}
+	c.nodes[id].Stop()
+	c.crashed[id] = true
+}
+
+// Restart brings a crashed node back from its persisted state with a fresh
+// state machine.
+func (c *Cluster) Restart(id uint64) error {
+	if !c.crashed[id] {
+		return nil
+	}
+	c.restarts[id]++
+	if err := c.start(id); err != nil {
+		return err
+	}
+	c.crashed[id] = false
+	return nil
+}
+
+// Crashed reports whether node id is down.
+func (c *Cluster) Crashed(id uint64) bool { return c.crashed[id] }
+
+// Partition splits the network so nodes can only talk within their group.
+// Nodes not listed in any group are isolated.
+func (c *Cluster) Partition(groups ...[]uint64) {
+	group := make(map[uint64]int)
+	for i, g := range groups {
+		for _, id := range g {
+			group[id] = i + 1
+		}
+	}
+	c.blocked = make(map[[2]uint64]bool)
+	for _, a := range c.ids {
+		for _, b := range c.ids {
+			if a != b && (group[a] == 0 || group[a] != group[b]) {
+				c.blocked[[2]uint64{a, b}] = true
+			}
+		}
+	}
+}
+
+// Heal removes every partition.
+func (c *Cluster) Heal() { c.blocked = make(map[[2]uint64]bool) }
+
+// Converged reports whether every live node has applied the same commands
+// and at least want of them.
+func (c *Cluster) Converged(want int) bool {
+	var ref []string
+	first := true
+	for _, id := range c.ids {
+		if c.crashed[id] {
+			continue
+		}
+		got := c.fsms[id].Commands()
+		if len(got) < want {
+			return false
+		}
+		if first {
+			ref, first = got, false
+			continue
+		}
+		if !slices.Equal(ref, got) {
+			return false
+		}
+	}
+	return true
+}
+
+// Violation returns the first safety violation observed, if any.
+func (c *Cluster) Violation() error { return c.violation }
+
+// Rand exposes the cluster's seeded generator for scenario decisions.
+func (c *Cluster) Rand() *rand.Rand { return c.rng }
+
+// --- Helpers ---
+
+func (c *Cluster) start(id uint64) error {
+	fsm := NewLogFSM()
+	node, err := raft.NewNode(raft.Config{
+		ID:                id,
+		Peers:             c.ids,
+		ElectionTicks:     10,
+		HeartbeatTicks:    2,
+		SnapshotThreshold: c.opts.SnapshotThreshold,
+		Storage:           c.storages[id],
+		StateMachine:      fsm,
+		Send:              c.send,
+		Rand:              rand.New(rand.NewPCG(c.opts.Seed, id<<16|c.restarts[id])),
+	})
+	if err != nil {
+		return err
+	}
+	c.nodes[id] = node
+	c.fsms[id] = fsm
+	return nil
+}
+
+func (c *Cluster) send(m raft.Message) {
+	if c.crashed[m.From] || c.rng.Float64() < c.opts.DropRate {
+		return
+	}
+	// Round-trip through JSON like the HTTP transport, so nodes never share memory.
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	var copied raft.Message
+	if err := json.Unmarshal(b, &copied); err != nil {
+		panic(err)
+	}
+
+	c.seq++
+	at := c.now + c.opts.MinDelay + c.rng.IntN(c.opts.MaxDelay-c.opts.MinDelay+1)
+	item := inflight{at: at, seq: c.seq, m: copied}
+	i, _ := slices.BinarySearchFunc(c.queue, item, func(a, b inflight) int {
+		if a.at != b.at {
+			return a.at - b.at
+		}
+		return int(a.seq) - int(b.seq)
+	})
+	c.queue = slices.Insert(c.queue, i, item)
+}
+
+// check records the first violation of election safety (one leader per
+// term) or state machine safety (applied sequences never diverge).
+func (c *Cluster) check() {
+	if c.violation != nil {
+		return
+	}
+	for _, id := range c.ids {
+		if c.crashed[id] {
+			continue
+		}
+		st := c.nodes[id].Status()
+		if st.State != raft.Leader {
+			continue
+		}
+		if prev, ok := c.leaders[st.Term]; ok && prev != id {
+			c.violation = fmt.Errorf("tick %d: nodes %d and %d both led term %d", c.now, prev, id, st.Term)
+			return
+		}
+		c.leaders[st.Term] = id
+	}
+
+	for i, a := range c.ids {
+		for _, b := range c.ids[i+1:] {
+			x, y := c.fsms[a].Commands(), c.fsms[b].Commands()
+			n := min(len(x), len(y))
+			if !slices.Equal(x[:n], y[:n]) {
+				c.violation = fmt.Errorf("tick %d: nodes %d and %d applied different commands:\n  %d: %s\n  %d: %s",
+					c.now, a, b, a, strings.Join(x, ","), b, strings.Join(y, ","))
+				return
+			}
+		}
+	}
+}
+
+// LogFSM is a state machine that just records every command it applies.
+type LogFSM struct {
+	commands []string
+}
+
+func NewLogFSM() *LogFSM { return &LogFSM{} }
+
+func (f *LogFSM) Apply(index uint64, data []byte) any {
+	f.commands = append(f.commands, string(data))
+	return len(f.commands)
+}
+
+func (f *LogFSM) Snapshot() ([]byte, error) { return json.Marshal(f.commands) }
+
+func (f *LogFSM) Restore(data []byte) error {
+	var commands []string
+	if err := json.Unmarshal(data, &commands); err != nil {
+		return err
+	}
+	f.commands = commands
+	return nil
+}
+
+// Commands returns a copy of every applied command.
+func (f *LogFSM) Commands() []string { return slices.Clone(f.commands) }
@@ -0,0 +1,58 @@
+package raftsim
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// TestScenarios runs every built-in scenario over a range of seeds. A
+// failure names the seed, which replays the same schedule with
+//
+//	go run ./cmd/raftsim -scenario NAME -seed SEED
+func TestScenarios(t *testing.T) {
+	seeds := uint64(20)
+	if testing.Short() {
+		seeds = 3
+	}
+	for _, s := range Scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			t.Parallel()
+			for seed := uint64(1); seed <= seeds; seed++ {
+				if err := RunScenario(s, seed); err != nil {
+					t.Errorf("seed %d: %v", seed, err)
+				}
+			}
+		})
+	}
+}
+
+// TestDeterministic checks that a seed always produces the same history,
+// which is what makes a failing seed worth reporting.
+func TestDeterministic(t *testing.T) {
+	run := func() ([]string, error) {
+		c, err := NewCluster(Options{Nodes: 5, Seed: 7, MinDelay: 1, MaxDelay: 3, SnapshotThreshold: 50, DropRate: 0.05})
+		if err != nil {
+			return nil, err
+		}
+		if err := runChaos(c); err != nil {
+			return nil, err
+		}
+		var history []string
+		for _, id := range c.IDs() {
+			history = append(history, fmt.Sprintf("%d@%d: %v", id, c.Now(), c.Applied(id)))
+		}
+		return history, nil
+	}
+	first, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(first, second) {
+		t.Errorf("two runs with seed 7 differ:\n%v\n%v", first, second)
+	}
+}
@@ -0,0 +1,284 @@
+package raftsim
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scenario drives a cluster through one failure pattern and returns an
+// error if the expected outcome isn't reached. Safety invariants are
+// checked separately on every tick.
+type Scenario struct {
+	Name  string
+	Nodes int
+	Opts  func(*Options)
+	Run   func(*Cluster) error
+}
+
+// Scenarios lists every built-in scenario in the order they run.
+var Scenarios = []Scenario{
+	{Name: "election", Nodes: 3, Run: runElection},
+	{Name: "replication", Nodes: 3, Run: runReplication},
+	{Name: "leader-crash", Nodes: 3, Run: runLeaderCrash},
+	{Name: "minority-partition", Nodes: 5, Run: runMinorityPartition},
+	{Name: "snapshot-catch-up", Nodes: 3, Opts: func(o *Options) { o.SnapshotThreshold = 20 }, Run: runSnapshotCatchUp},
+	{Name: "chaos", Nodes: 5, Opts: func(o *Options) { o.SnapshotThreshold = 50; o.DropRate = 0.05 }, Run: runChaos},
+}
+
+// RunScenario builds a fresh cluster for s with the given seed and runs it.
+func RunScenario(s Scenario, seed uint64) error {
+	opts := Options{Nodes: s.Nodes, Seed: seed, MinDelay: 1, MaxDelay: 3}
+	if s.Opts != nil {
+		s.Opts(&opts)
+	}
+	c, err := NewCluster(opts)
+	if err != nil {
+		return err
+	}
+	err = s.Run(c)
+	if v := c.Violation(); v != nil {
+		return fmt.Errorf("safety violation: %w", v)
+	}
+	return err
+}
+
+func runElection(c *Cluster) error {
+	return waitLeader(c)
+}
+
+func runReplication(c *Cluster) error {
+	if err := waitLeader(c); err != nil {
+		return err
+	}
+	n, err := proposeN(c, "cmd", 50)
+	if err != nil {
+		return err
+	}
+	return c.RunUntil("all nodes to apply every command", 500, func() bool { return c.Converged(n) })
+}
+
+func runLeaderCrash(c *Cluster) error {
+	if err := waitLeader(c); err != nil {
+		return err
+	}
+	if _, err := proposeN(c, "before", 10); err != nil {
+		return err
+	}
+	if err := c.RunUntil("first batch to apply", 300, func() bool { return c.Converged(10) }); err != nil {
+		return err
+	}
+
+	old, _ := c.Leader()
+	c.Crash(old)
+	if err := c.RunUntil("a new leader", 300, func() bool {
+		id, ok := c.Leader()
+		return ok && id != old
+	}); err != nil {
+		return err
+	}
+	if _, err := proposeN(c, "after", 10); err != nil {
+		return err
+	}
+	if err := c.Restart(old); err != nil {
+		return err
+	}
+	return c.RunUntil("restarted node to catch up", 500, func() bool { return c.Converged(20) })
+}
+
+func runMinorityPartition(c *Cluster) error {
+	if err := waitLeader(c); err != nil {
+		return err
+	}
+	if _, err := proposeN(c, "base", 5); err != nil {
+		return err
+	}
+	if err := c.RunUntil("base commands to apply", 300, func() bool { return c.Converged(5) }); err != nil {
+		return err
+	}
+
+	old, _ := c.Leader()
+	// Strand the leader with one follower; the other three form a majority.
+	minority := []uint64{old}
+	var majority []uint64
+	for _, id := range c.IDs() {
+		switch {
+		case id == old:
+		case len(minority) < 2:
+			minority = append(minority, id)
+		default:
+			majority = append(majority, id)
+		}
+	}
+	c.Partition(minority, majority)
+
+	// The stranded leader accepts these but can never commit them.
+	for i := range 5 {
+		c.Propose(old, fmt.Sprintf("lost-%d", i))
+	}
+	if err := c.RunUntil("the majority to elect a leader", 300, func() bool {
+		id, ok := c.Leader()
+		return ok && slices.Contains(majority, id)
+	}); err != nil {
+		return err
+	}
+	if _, err := proposeN(c, "majority", 10); err != nil {
+		return err
+	}
+	c.Run(50)
+	for _, id := range minority {
+		if got := len(c.Applied(id)); got != 5 {
+			return fmt.Errorf("minority node %d applied %d commands while partitioned, want 5", id, got)
+		}
+	}
+
+	c.Heal()
+	if err := c.RunUntil("the partition to heal", 500, func() bool { return c.Converged(15) }); err != nil {
+		return err
+	}
+	for _, cmd := range c.Applied(old) {
+		if len(cmd) > 5 && cmd[:5] == "lost-" {
+			return fmt.Errorf("uncommitted command %q from the stranded leader was applied", cmd)
+		}
+	}
+	return nil
+}
+
+func runSnapshotCatchUp(c *Cluster) error {
+	if err := waitLeader(c); err != nil {
+		return err
+	}
+	leader, _ := c.Leader()
+	var lagging uint64
+	for _, id := range c.IDs() {
+		if id != leader {
+			lagging = id
+			break
+		}
+	}
+	c.Crash(lagging)
+	if _, err := proposeN(c, "cmd", 100); err != nil {
+		return err
+	}
+	if err := c.RunUntil("the leader to compact its log", 500, func() bool {
+		id, ok := c.Leader()
+		return ok && c.Status(id).SnapshotIndex > 0 && len(c.Applied(id)) == 100
+	}); err != nil {
+		return err
+	}
+	if err := c.Restart(lagging); err != nil {
+		return err
+	}
+	if err := c.RunUntil("the lagging node to catch up", 500, func() bool { return c.Converged(100) }); err != nil {
+		return err
+	}
+	if c.Status(lagging).SnapshotIndex == 0 {
+		return fmt.Errorf("node %d caught up without installing a snapshot", lagging)
+	}
+	return nil
+}
+
+// runChaos crashes, restarts and partitions nodes at random while proposing
+// commands, then heals everything and checks the cluster converges on every
+// command that was acknowledged as committed.
+func runChaos(c *Cluster) error {
+	rng := c.Rand()
+	ids := c.IDs()
+	proposed := 0
+	for range 3000 {
+		switch r := rng.IntN(100); {
+		case r < 2:
+			id := ids[rng.IntN(len(ids))]
+			if downCount(c) < (len(ids)-1)/2 {
+				c.Crash(id)
+			}
+		case r < 5:
+			if err := c.Restart(ids[rng.IntN(len(ids))]); err != nil {
+				return err
+			}
+		case r < 7:
+			shuffled := slices.Clone(ids)
+			rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			cut := 1 + rng.IntN(len(shuffled)-1)
+			c.Partition(shuffled[:cut], shuffled[cut:])
+		case r < 10:
+			c.Heal()
+		case r < 40:
+			if id, ok := c.Leader(); ok {
+				if _, err := c.Propose(id, fmt.Sprintf("chaos-%d", proposed)); err == nil {
+					proposed++
+				}
+			}
+		}
+		c.Step()
+		if c.Violation() != nil {
+			return nil
+		}
+	}
+
+	c.Heal()
+	for _, id := range ids {
+		if err := c.Restart(id); err != nil {
+			return err
+		}
+	}
+	if err := waitLeader(c); err != nil {
+		return err
+	}
+	// A final command commits everything before it in the leader's log. It
+	// can still be lost to a leader change, so keep proposing until one lands.
+	for attempt := range 10 {
+		if _, err := proposeN(c, fmt.Sprintf("final%d", attempt), 1); err != nil {
+			return err
+		}
+		err := c.RunUntil("the cluster to converge", 500, func() bool {
+			if !c.Converged(1) {
+				return false
+			}
+			got := c.Applied(ids[0])
+			return strings.HasPrefix(got[len(got)-1], "final")
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("tick %d: cluster never converged after healing", c.Now())
+}
+
+// --- Helpers ---
+
+func waitLeader(c *Cluster) error {
+	return c.RunUntil("a leader", 500, func() bool {
+		_, ok := c.Leader()
+		return ok
+	})
+}
+
+// proposeN submits n commands named prefix-0..prefix-(n-1) through the
+// current leader, waiting for a new one if leadership moves.
+func proposeN(c *Cluster, prefix string, n int) (int, error) {
+	for i := 0; i < n; {
+		id, ok := c.Leader()
+		if ok {
+			if _, err := c.Propose(id, fmt.Sprintf("%s-%d", prefix, i)); err == nil {
+				i++
+				continue
+			}
+		}
+		if err := waitLeader(c); err != nil {
+			return i, err
+		}
+		c.Step()
+	}
+	return n, nil
+}
+
+func downCount(c *Cluster) int {
+	n := 0
+	for _, id := range c.IDs() {
+		if c.Crashed(id) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,254 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MemoryStorage keeps state in memory. It survives a simulated crash as long
+// as the same instance is handed to the restarted node.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	state *Persisted
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) Load() (*Persisted, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		return &Persisted{}, nil
+	}
+	return clonePersisted(s.state), nil
+}
+
+func (s *MemoryStorage) Save(p *Persisted) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = clonePersisted(p)
+	return nil
+}
+
+// FileStorage keeps state in dir. The latest snapshot is in
+// raft-snapshot.json, replaced atomically when it changes. Everything
+// since is in raft-log.jsonl, to which each Save appends only what changed:
+// a new hard state, new entries, or the index from which a conflicting
+// suffix was dropped. The log is rewritten when a snapshot compacts it.
+type FileStorage struct {
+	dir string
+
+	mu        sync.Mutex
+	log       *os.File
+	hard      HardState
+	snapIndex uint64
+	snapTerm  uint64
+	terms     []uint64 // the term of each logged entry, from snapIndex+1
+}
+
+// logRecord is one line of raft-log.jsonl; exactly one field is set.
+type logRecord struct {
+	HardState    *HardState `json:"hard_state,omitempty"`
+	Entry        *Entry     `json:"entry,omitempty"`
+	TruncateFrom uint64     `json:"truncate_from,omitempty"`
+}
+
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// Load reads the snapshot and replays the log. A record cut short by a
+// crash at the end of the log is dropped. The log is then rewritten
+// without the records later ones superseded.
+func (s *FileStorage) Load() (*Persisted, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &Persisted{}
+	data, err := os.ReadFile(s.path("raft-snapshot.json"))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &p.Snapshot); err != nil {
+			return nil, fmt.Errorf("raft-snapshot.json: %w", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// Before the log existed, state was saved whole to raft-state.json.
+		if legacy, err := os.ReadFile(s.path("raft-state.json")); err == nil {
+			if err := json.Unmarshal(legacy, p); err != nil {
+				return nil, fmt.Errorf("raft-state.json: %w", err)
+			}
+		}
+	default:
+		return nil, err
+	}
+
+	data, err = os.ReadFile(s.path("raft-log.jsonl"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for len(data) > 0 {
+		line, rest, complete := bytes.Cut(data, []byte("\n"))
+		data = rest
+		var rec logRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if !complete {
+				break
+			}
+			return nil, fmt.Errorf("raft-log.jsonl: %w", err)
+		}
+		// Entries are placed by index: a crash between replacing the
+		// snapshot and the log leaves a log that starts before the
+		// snapshot.
+		switch {
+		case rec.HardState != nil:
+			p.HardState = *rec.HardState
+		case rec.Entry != nil && rec.Entry.Index > p.Snapshot.Index:
+			i := int(rec.Entry.Index - p.Snapshot.Index - 1)
+			if i > len(p.Entries) {
+				return nil, fmt.Errorf("raft-log.jsonl: entry %d follows entry %d", rec.Entry.Index, p.Snapshot.Index+uint64(len(p.Entries)))
+			}
+			p.Entries = append(p.Entries[:i], *rec.Entry)
+		case rec.TruncateFrom > p.Snapshot.Index:
+			p.Entries = p.Entries[:min(len(p.Entries), int(rec.TruncateFrom-p.Snapshot.Index-1))]
+		}
+	}
+
+	if err := s.rewrite(p); err != nil {
+		return nil, err
+	}
+	os.Remove(s.path("raft-state.json"))
+	return p, nil
+}
+
+// Save appends what changed since the last Save and syncs the log, unless
+// the snapshot changed, in which case both files are rewritten.
+func (s *FileStorage) Save(p *Persisted) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil || p.Snapshot.Index != s.snapIndex || p.Snapshot.Term != s.snapTerm {
+		return s.rewrite(p)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if p.HardState != s.hard {
+		enc.Encode(logRecord{HardState: &p.HardState})
+	}
+	// Entries with the same index and term are the same entry, and so are
+	// all entries before them, so only the suffix after the newest entry
+	// both logs agree on needs writing. It is usually the last logged one.
+	keep := min(len(p.Entries), len(s.terms))
+	for keep > 0 && p.Entries[keep-1].Term != s.terms[keep-1] {
+		keep--
+	}
+	if keep < len(s.terms) {
+		enc.Encode(logRecord{TruncateFrom: s.snapIndex + uint64(keep) + 1})
+	}
+	for i := keep; i < len(p.Entries); i++ {
+		enc.Encode(logRecord{Entry: &p.Entries[i]})
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	if _, err := s.log.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := s.log.Sync(); err != nil {
+		return err
+	}
+
+	s.hard = p.HardState
+	s.terms = s.terms[:keep]
+	for _, e := range p.Entries[keep:] {
+		s.terms = append(s.terms, e.Term)
+	}
+	return nil
+}
+
+// rewrite replaces the snapshot file, if the snapshot changed, and the log
+// with p's state, then opens the log for appending.
+func (s *FileStorage) rewrite(p *Persisted) error {
+	if p.Snapshot.Index != s.snapIndex || p.Snapshot.Term != s.snapTerm || s.log == nil {
+		data, err := json.Marshal(p.Snapshot)
+		if err != nil {
+			return err
+		}
+		if err := writeFileSync(s.path("raft-snapshot.json"), data); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(logRecord{HardState: &p.HardState})
+	for i := range p.Entries {
+		enc.Encode(logRecord{Entry: &p.Entries[i]})
+	}
+	if err := writeFileSync(s.path("raft-log.jsonl"), buf.Bytes()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path("raft-log.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if s.log != nil {
+		s.log.Close()
+	}
+
+	s.log = f
+	s.hard = p.HardState
+	s.snapIndex, s.snapTerm = p.Snapshot.Index, p.Snapshot.Term
+	s.terms = s.terms[:0]
+	for _, e := range p.Entries {
+		s.terms = append(s.terms, e.Term)
+	}
+	return nil
+}
+
+func (s *FileStorage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// writeFileSync replaces path with data atomically and durably.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func clonePersisted(p *Persisted) *Persisted {
+	out := &Persisted{
+		HardState: p.HardState,
+		Snapshot:  Snapshot{Index: p.Snapshot.Index, Term: p.Snapshot.Term, Data: append([]byte(nil), p.Snapshot.Data...)},
+		Entries:   make([]Entry, len(p.Entries)),
+	}
+	for i, e := range p.Entries {
+		out.Entries[i] = Entry{Index: e.Index, Term: e.Term, Data: append([]byte(nil), e.Data...)}
+	}
+	return out
+}
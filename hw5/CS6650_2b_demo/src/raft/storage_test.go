@@ -0,0 +1,137 @@
+package raft
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func entries(from uint64, terms ...uint64) []Entry {
+	out := make([]Entry, len(terms))
+	for i, term := range terms {
+		index := from + uint64(i)
+		out[i] = Entry{Index: index, Term: term, Data: []byte{byte(index)}}
+	}
+	return out
+}
+
+// reopen loads dir with a fresh FileStorage, as after a restart.
+func reopen(t *testing.T, dir string) *Persisted {
+	t.Helper()
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFileStorageAppendsOnlyChanges(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Persisted{HardState: HardState{Term: 1, Vote: 1}}
+	for i := range 100 {
+		p.Entries = entries(1, make([]uint64, i+1)...)
+		for j := range p.Entries {
+			p.Entries[j].Term = 1
+		}
+		if err := s.Save(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "raft-log.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The empty hard state Load wrote, the new one and one record per
+	// entry, however often each was saved.
+	if n := strings.Count(string(data), "\n"); n != 102 {
+		t.Errorf("log has %d records, want 102", n)
+	}
+	if got := reopen(t, dir); !reflect.DeepEqual(got, p) {
+		t.Errorf("loaded %+v, want %+v", got, p)
+	}
+}
+
+func TestFileStorageTruncatesConflictingSuffix(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStorage(dir)
+	s.Load()
+
+	s.Save(&Persisted{HardState: HardState{Term: 2}, Entries: entries(1, 1, 1, 2, 2, 2)})
+	// A new leader in term 3 overwrote entries 4 and 5 and dropped 6.
+	want := &Persisted{HardState: HardState{Term: 3}, Entries: entries(1, 1, 1, 2, 3, 3)}
+	if err := s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	if got := reopen(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStorageSnapshotCompactsLog(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStorage(dir)
+	s.Load()
+
+	s.Save(&Persisted{HardState: HardState{Term: 1}, Entries: entries(1, 1, 1, 1, 1, 1)})
+	want := &Persisted{
+		HardState: HardState{Term: 1},
+		Snapshot:  Snapshot{Index: 4, Term: 1, Data: []byte("state")},
+		Entries:   entries(5, 1, 1),
+	}
+	if err := s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	if got := reopen(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStorageDropsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStorage(dir)
+	s.Load()
+	want := &Persisted{HardState: HardState{Term: 1}, Entries: entries(1, 1, 1)}
+	s.Save(want)
+
+	f, err := os.OpenFile(filepath.Join(dir, "raft-log.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"entry":{"index":3,"te`)
+	f.Close()
+
+	if got := reopen(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStorageLoadsLegacyState(t *testing.T) {
+	dir := t.TempDir()
+	want := &Persisted{HardState: HardState{Term: 4, Vote: 2}, Snapshot: Snapshot{Index: 2, Term: 3}, Entries: entries(3, 4)}
+	data, _ := json.Marshal(want)
+	if err := os.WriteFile(filepath.Join(dir, "raft-state.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := reopen(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+	if got := reopen(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("after conversion loaded %+v, want %+v", got, want)
+	}
+}
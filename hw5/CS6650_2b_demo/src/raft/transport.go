@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// peerQueueSize bounds buffered messages per peer; Raft tolerates the
+// drops that happen when a peer is slow or down.
+const peerQueueSize = 1024
+
+// HTTPTransport delivers messages by POSTing them as JSON to each peer's
+// /raft/message endpoint, with the cluster's shared secret as a bearer
+// token. Every peer gets its own queue and sender goroutine so one
+// unreachable node doesn't delay the others.
+type HTTPTransport struct {
+	peers  map[uint64]string
+	secret string
+	queues map[uint64]chan Message
+	client *http.Client
+}
+
+// NewHTTPTransport creates a transport for the given peer base URLs
+// (e.g. 2 -> "http://10.0.1.6:8080"). Call Start before sending.
+func NewHTTPTransport(peers map[uint64]string, secret string) *HTTPTransport {
+	t := &HTTPTransport{
+		peers:  peers,
+		secret: secret,
+		queues: make(map[uint64]chan Message),
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+	for id := range peers {
+		t.queues[id] = make(chan Message, peerQueueSize)
+	}
+	return t
+}
+
+// Start runs the per-peer senders until ctx is done.
+func (t *HTTPTransport) Start(ctx context.Context) {
+	for id, q := range t.queues {
+		go t.sendLoop(ctx, t.peers[id], q)
+	}
+}
+
+// Send queues m for delivery, dropping it if the peer's queue is full.
+func (t *HTTPTransport) Send(m Message) {
+	q, ok := t.queues[m.To]
+	if !ok {
+		return
+	}
+	select {
+	case q <- m:
+	default:
+	}
+}
+
+func (t *HTTPTransport) sendLoop(ctx context.Context, baseURL string, q chan Message) {
+	for {
+		select {
+		case m := <-q:
+			body, err := json.Marshal(m)
+			if err != nil {
+				continue
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/raft/message", bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+t.secret)
+			resp, err := t.client.Do(req)
+			if err != nil {
+				slog.Debug("raft send failed", "to", m.To, "type", m.Type, "err", err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusUnauthorized {
+				slog.Warn("raft peer rejected our secret", "to", m.To)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package raft
+
+import "errors"
+
+var (
+	// ErrNotLeader is returned by Propose on a node that isn't the leader.
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrDropped means a proposal was overwritten by another leader's entry,
+	// or compacted into a snapshot before its result could be reported.
+	ErrDropped = errors.New("raft: proposal dropped or outcome unknown")
+	// ErrStopped is returned once a node has been stopped.
+	ErrStopped = errors.New("raft: node stopped")
+)
+
+// State is a node's role in the current term.
+type State string
+
+const (
+	Follower  State = "follower"
+	Candidate State = "candidate"
+	Leader    State = "leader"
+)
+
+// Entry is one slot in the replicated log. A nil Data marks the no-op entry
+// each new leader appends to commit entries from earlier terms.
+type Entry struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// Snapshot is the state machine's state as of Index, which had term Term.
+type Snapshot struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+type MsgType string
+
+const (
+	MsgVote       MsgType = "vote"
+	MsgVoteResp   MsgType = "vote_resp"
+	MsgAppend     MsgType = "append"
+	MsgAppendResp MsgType = "append_resp"
+	MsgSnapshot   MsgType = "snapshot"
+)
+
+// Message is the single wire type exchanged between nodes; which fields are
+// meaningful depends on Type.
+type Message struct {
+	Type MsgType `json:"type"`
+	From uint64  `json:"from"`
+	To   uint64  `json:"to"`
+	Term uint64  `json:"term"`
+
+	// MsgVote: the candidate's last log position.
+	LastLogIndex uint64 `json:"last_log_index,omitempty"`
+	LastLogTerm  uint64 `json:"last_log_term,omitempty"`
+	// MsgVoteResp
+	Granted bool `json:"granted,omitempty"`
+
+	// MsgAppend
+	PrevIndex uint64  `json:"prev_index,omitempty"`
+	PrevTerm  uint64  `json:"prev_term,omitempty"`
+	Entries   []Entry `json:"entries,omitempty"`
+	Commit    uint64  `json:"commit,omitempty"`
+	// MsgAppendResp: on success the highest index known to match the
+	// leader; on failure a hint for where the leader should retry.
+	Success    bool   `json:"success,omitempty"`
+	MatchIndex uint64 `json:"match_index,omitempty"`
+	HintIndex  uint64 `json:"hint_index,omitempty"`
+
+	// MsgSnapshot
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+}
+
+// HardState is the part of a node's state that must survive a crash
+// besides the log itself.
+type HardState struct {
+	Term uint64 `json:"term"`
+	Vote uint64 `json:"vote"`
+}
+
+// Persisted is everything a node writes to stable storage.
+type Persisted struct {
+	HardState HardState `json:"hard_state"`
+	Snapshot  Snapshot  `json:"snapshot"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Storage keeps Persisted state across restarts. Save is called before any
+// message that depends on the new state is sent.
+type Storage interface {
+	Load() (*Persisted, error)
+	Save(*Persisted) error
+}
+
+// StateMachine is the replicated application. Apply must be deterministic:
+// every node applies the same entries in the same order and must end up in
+// the same state.
+type StateMachine interface {
+	Apply(index uint64, data []byte) any
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+// Status is a point-in-time view of a node for debugging and metrics.
+type Status struct {
+	ID            uint64 `json:"id"`
+	State         State  `json:"state"`
+	Term          uint64 `json:"term"`
+	Leader        uint64 `json:"leader"`
+	CommitIndex   uint64 `json:"commit_index"`
+	AppliedIndex  uint64 `json:"applied_index"`
+	LastIndex     uint64 `json:"last_index"`
+	SnapshotIndex uint64 `json:"snapshot_index"`
+}
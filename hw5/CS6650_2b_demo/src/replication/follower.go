@@ -0,0 +1,229 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"product-api/models"
+	"product-api/store"
+)
+
+// pollWait is how long the leader holds a log request open when there is
+// nothing new; the client timeout leaves headroom on top of it.
+const (
+	pollWait    = 20 * time.Second
+	pollLimit   = 1000
+	retryDelay  = time.Second
+	httpTimeout = pollWait + 10*time.Second
+)
+
+// Batch is the leader's response to GET /replication/log.
+// Snapshot is set when the entries the follower asked for have been
+// compacted away; the follower restores it before applying Entries.
+type Batch struct {
+	Epoch     string    `json:"epoch"`
+	LastIndex uint64    `json:"last_index"`
+	Snapshot  *Snapshot `json:"snapshot,omitempty"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Status describes how far a follower is behind its leader.
+type Status struct {
+	Role         string  `json:"role"`
+	LeaderURL    string  `json:"leader_url,omitempty"`
+	Epoch        string  `json:"epoch"`
+	AppliedIndex uint64  `json:"applied_index"`
+	LeaderIndex  uint64  `json:"leader_index"`
+	LagEntries   uint64  `json:"lag_entries"`
+	LagSeconds   float64 `json:"lag_seconds"`
+}
+
+// Follower long-polls the leader's change log and applies each entry locally.
+type Follower struct {
+	leaderURL string
+	client    *http.Client
+	apply     func(Entry) error
+	restore   func(Snapshot)
+
+	mu         sync.Mutex
+	epoch      string
+	applied    uint64
+	leaderLast uint64
+	caughtUpAt time.Time
+	polling    bool
+	startedAt  time.Time
+}
+
+// NewFollower returns a follower that applies entries with apply, and
+// replaces everything it has applied with restore.
+func NewFollower(leaderURL string, apply func(Entry) error, restore func(Snapshot)) *Follower {
+	return &Follower{
+		leaderURL: leaderURL,
+		client:    &http.Client{Timeout: httpTimeout},
+		apply:     apply,
+		restore:   restore,
+		startedAt: time.Now(),
+	}
+}
+
+// Run replicates until ctx is done.
+func (f *Follower) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := f.pollOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("replication poll failed", "leader", f.leaderURL, "err", err)
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// Status reports replication progress. Lag is zero while the follower is
+// caught up and waiting on the leader; otherwise it is the time since the
+// follower was last known to be caught up.
+func (f *Follower) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := Status{
+		Role:         "follower",
+		LeaderURL:    f.leaderURL,
+		Epoch:        f.epoch,
+		AppliedIndex: f.applied,
+		LeaderIndex:  f.leaderLast,
+	}
+	if f.leaderLast > f.applied {
+		st.LagEntries = f.leaderLast - f.applied
+	}
+	if st.LagEntries > 0 || !f.polling || f.epoch == "" {
+		since := f.caughtUpAt
+		if since.IsZero() {
+			since = f.startedAt
+		}
+		st.LagSeconds = time.Since(since).Seconds()
+	}
+	return st
+}
+
+func (f *Follower) pollOnce(ctx context.Context) error {
+	f.mu.Lock()
+	after := f.applied
+	f.polling = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.polling = false
+		f.mu.Unlock()
+	}()
+
+	q := url.Values{}
+	q.Set("after", strconv.FormatUint(after, 10))
+	q.Set("limit", strconv.Itoa(pollLimit))
+	q.Set("wait", pollWait.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.leaderURL+"/replication/log?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader returned %s", resp.Status)
+	}
+
+	var batch Batch
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return fmt.Errorf("decoding batch: %w", err)
+	}
+
+	f.mu.Lock()
+	if f.epoch != "" && f.epoch != batch.Epoch {
+		// The leader restarted with a fresh log. Drop everything the old
+		// leader sent, so nothing only it had survives, and replay the new
+		// log from the start.
+		slog.Warn("leader epoch changed, resyncing from index 0", "old", f.epoch, "new", batch.Epoch)
+		f.epoch = batch.Epoch
+		f.applied = 0
+		f.leaderLast = batch.LastIndex
+		f.mu.Unlock()
+		f.restore(Snapshot{})
+		return nil
+	}
+	f.epoch = batch.Epoch
+	f.mu.Unlock()
+
+	if batch.Snapshot != nil {
+		// The leader compacted the entries this follower still needed.
+		slog.Info("restoring snapshot from leader", "index", batch.Snapshot.Index,
+			"products", len(batch.Snapshot.Products), "categories", len(batch.Snapshot.Categories))
+		f.restore(*batch.Snapshot)
+		f.mu.Lock()
+		f.applied = batch.Snapshot.Index
+		f.mu.Unlock()
+	}
+
+	for _, e := range batch.Entries {
+		if err := f.apply(e); err != nil {
+			return fmt.Errorf("applying entry %d (%s): %w", e.Index, e.Op, err)
+		}
+		f.mu.Lock()
+		f.applied = e.Index
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	f.leaderLast = batch.LastIndex
+	if f.applied >= f.leaderLast {
+		f.caughtUpAt = time.Now()
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+// StoreApplier returns an apply function that replays entries onto the
+// local stores.
+func StoreApplier(products *store.ProductStore, categories *store.CategoryStore) func(Entry) error {
+	return func(e Entry) error {
+		switch e.Op {
+		case store.OpProductUpsert:
+			var p models.Product
+			if err := json.Unmarshal(e.Data, &p); err != nil {
+				return err
+			}
+			return products.UpsertProduct(p.ProductID, &p)
+		case store.OpCategoryUpsert:
+			var c models.Category
+			if err := json.Unmarshal(e.Data, &c); err != nil {
+				return err
+			}
+			return categories.UpsertCategory(c.CategoryID, &c)
+		case store.OpCategoryDelete:
+			var id int
+			if err := json.Unmarshal(e.Data, &id); err != nil {
+				return err
+			}
+			return categories.DeleteCategory(id)
+		}
+		return fmt.Errorf("unknown op %q", e.Op)
+	}
+}
+
+// StoreRestorer returns a restore function that replaces the local stores'
+// contents with a snapshot.
+func StoreRestorer(products *store.ProductStore, categories *store.CategoryStore) func(Snapshot) {
+	return func(snap Snapshot) {
+		products.Restore(snap.Products)
+		// Followers send category creation to the leader, so the next ID doesn't matter here.
+		categories.Restore(snap.Categories, 1)
+	}
+}
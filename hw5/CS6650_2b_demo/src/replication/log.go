@@ -0,0 +1,207 @@
+// Package replication streams the leader's store writes to follower
+// instances over HTTP so every task serves the same catalog.
+package replication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"product-api/models"
+	"product-api/store"
+)
+
+// defaultRetain is how many recent entries the log keeps once it compacts.
+// It compacts when it holds twice that many, so appends stay cheap.
+const defaultRetain = 10000
+
+// Entry is one replicated write. Indexes start at 1 and have no gaps.
+type Entry struct {
+	Index     uint64          `json:"index"`
+	Op        string          `json:"op"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// Snapshot is the catalog as of Index. It stands in for every entry up to
+// and including Index once those have been compacted away.
+type Snapshot struct {
+	Index      uint64            `json:"index"`
+	Products   []models.Product  `json:"products"`
+	Categories []models.Category `json:"categories"`
+}
+
+// Log is the leader's in-memory change log.
+// Epoch changes every time the process starts so followers can tell
+// when the leader's history was reset.
+//
+// The log keeps only its newest entries. Older ones are folded into a copy
+// of the catalog as of base, which followers that are further behind get as
+// a Snapshot instead.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry // entries[i].Index == base+i+1
+	epoch   string
+	retain  int
+
+	base       uint64
+	products   map[int]models.Product
+	categories map[int]models.Category
+
+	// appended is closed and replaced on every append to wake long-polls.
+	appended chan struct{}
+	closed   bool
+}
+
+func NewLog() *Log {
+	var b [8]byte
+	rand.Read(b[:])
+	return &Log{
+		epoch:      hex.EncodeToString(b[:]),
+		retain:     defaultRetain,
+		products:   make(map[int]models.Product),
+		categories: make(map[int]models.Category),
+		appended:   make(chan struct{}),
+	}
+}
+
+// Epoch identifies this log's history.
+func (l *Log) Epoch() string { return l.epoch }
+
+// Append records a write. It has the signature of store.ChangeHook so it can
+// be installed directly on the stores.
+func (l *Log) Append(op string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		// Store values are plain structs; failing to encode one is a programming error.
+		panic("replication: encoding " + op + ": " + err.Error())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, Entry{
+		Index:     l.lastIndexLocked() + 1,
+		Op:        op,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+	if len(l.entries) >= 2*l.retain {
+		l.compactLocked(len(l.entries) - l.retain)
+	}
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// Close releases every waiting Since call so long-polls don't hold up
+// server shutdown. Appends are still accepted afterwards.
+func (l *Log) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.appended)
+		l.appended = make(chan struct{})
+	}
+}
+
+// LastIndex returns the index of the newest entry, or 0 if the log is empty.
+func (l *Log) LastIndex() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastIndexLocked()
+}
+
+// Since returns up to max entries with Index > after. If entries after
+// that have been compacted away, it also returns a snapshot to apply
+// first, and the entries follow on from the snapshot's index. If there is
+// nothing to return it waits until an entry is appended or ctx is done.
+func (l *Log) Since(ctx context.Context, after uint64, max int) (*Snapshot, []Entry) {
+	for {
+		l.mu.Lock()
+		var snap *Snapshot
+		if after < l.base {
+			snap = l.snapshotLocked()
+			after = l.base
+		}
+		if snap != nil || after < l.lastIndexLocked() {
+			start := after - l.base
+			end := min(uint64(len(l.entries)), start+uint64(max))
+			out := append([]Entry(nil), l.entries[start:end]...)
+			l.mu.Unlock()
+			return snap, out
+		}
+		if l.closed {
+			l.mu.Unlock()
+			return nil, nil
+		}
+		wait := l.appended
+		l.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+// --- Helpers (caller must hold l.mu) ---
+
+func (l *Log) lastIndexLocked() uint64 {
+	return l.base + uint64(len(l.entries))
+}
+
+// compactLocked folds the oldest n entries into the catalog kept as of base
+// and drops them.
+func (l *Log) compactLocked(n int) {
+	for _, e := range l.entries[:n] {
+		var err error
+		switch e.Op {
+		case store.OpProductUpsert:
+			var p models.Product
+			if err = json.Unmarshal(e.Data, &p); err == nil {
+				l.products[p.ProductID] = p
+			}
+		case store.OpCategoryUpsert:
+			var c models.Category
+			if err = json.Unmarshal(e.Data, &c); err == nil {
+				l.categories[c.CategoryID] = c
+			}
+		case store.OpCategoryDelete:
+			var id int
+			if err = json.Unmarshal(e.Data, &id); err == nil {
+				delete(l.categories, id)
+			}
+		default:
+			panic("replication: compacting unknown op " + e.Op)
+		}
+		if err != nil {
+			// Append encoded this entry, so it always decodes.
+			panic("replication: decoding " + e.Op + ": " + err.Error())
+		}
+	}
+	l.base = l.entries[n-1].Index
+	// Copy what's left so the dropped entries can be collected.
+	l.entries = append([]Entry(nil), l.entries[n:]...)
+}
+
+func (l *Log) snapshotLocked() *Snapshot {
+	snap := &Snapshot{
+		Index:      l.base,
+		Products:   make([]models.Product, 0, len(l.products)),
+		Categories: make([]models.Category, 0, len(l.categories)),
+	}
+	for _, p := range l.products {
+		snap.Products = append(snap.Products, p)
+	}
+	for _, c := range l.categories {
+		snap.Categories = append(snap.Categories, c)
+	}
+	sort.Slice(snap.Products, func(i, j int) bool { return snap.Products[i].ProductID < snap.Products[j].ProductID })
+	sort.Slice(snap.Categories, func(i, j int) bool { return snap.Categories[i].CategoryID < snap.Categories[j].CategoryID })
+	return snap
+}
@@ -0,0 +1,137 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"product-api/models"
+	"product-api/store"
+)
+
+func product(id, categoryID int) models.Product {
+	return models.Product{ProductID: id, SKU: "sku-" + strconv.Itoa(id), Manufacturer: "m", CategoryID: categoryID, SomeOtherID: 1}
+}
+
+func TestLogCompactsIntoSnapshot(t *testing.T) {
+	l := NewLog()
+	l.retain = 3
+	parent := 1
+	l.Append(store.OpCategoryUpsert, models.Category{CategoryID: 1, Name: "Tools"})
+	l.Append(store.OpCategoryUpsert, models.Category{CategoryID: 2, Name: "Saws", ParentID: &parent})
+	l.Append(store.OpProductUpsert, product(1, 2))
+	l.Append(store.OpCategoryUpsert, models.Category{CategoryID: 3, Name: "Old"})
+	l.Append(store.OpCategoryDelete, 3)
+	l.Append(store.OpProductUpsert, product(1, 1)) // 6 entries: compacts the first 3
+	l.Append(store.OpProductUpsert, product(2, 1))
+
+	if got := l.LastIndex(); got != 7 {
+		t.Fatalf("LastIndex = %d, want 7", got)
+	}
+	if len(l.entries) != 4 || l.base != 3 {
+		t.Fatalf("log holds %d entries after index %d, want 4 after 3", len(l.entries), l.base)
+	}
+
+	ctx := context.Background()
+	snap, entries := l.Since(ctx, 1, 2)
+	if snap == nil {
+		t.Fatal("Since(1) returned no snapshot, but entry 2 was compacted")
+	}
+	if snap.Index != 3 || !slices.Equal(snap.Products, []models.Product{product(1, 2)}) ||
+		len(snap.Categories) != 2 || snap.Categories[1].Name != "Saws" {
+		t.Errorf("snapshot = %+v", snap)
+	}
+	if len(entries) != 2 || entries[0].Index != 4 || entries[1].Index != 5 {
+		t.Errorf("entries after the snapshot = %+v, want 4 and 5", entries)
+	}
+
+	snap, entries = l.Since(ctx, 5, 10)
+	if snap != nil || len(entries) != 2 || entries[0].Index != 6 {
+		t.Errorf("Since(5) = %+v, %+v; want entries 6 and 7 alone", snap, entries)
+	}
+
+	// Compacting again, through index 6, folds in the delete and the new
+	// version of product 1.
+	for id := 3; id <= 4; id++ {
+		l.Append(store.OpProductUpsert, product(id, 1))
+	}
+	snap, _ = l.Since(ctx, 0, 10)
+	if snap == nil || snap.Index != 6 || !slices.Equal(snap.Products, []models.Product{product(1, 1)}) || len(snap.Categories) != 2 {
+		t.Errorf("snapshot after the second compaction = %+v", snap)
+	}
+}
+
+// testLeader serves a Log at /replication/log the way the leader does.
+type testLeader struct {
+	log atomic.Pointer[Log]
+	srv *httptest.Server
+}
+
+func startTestLeader(t *testing.T) *testLeader {
+	t.Helper()
+	leader := &testLeader{}
+	leader.log.Store(NewLog())
+	leader.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := leader.log.Load()
+		after, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Millisecond)
+		defer cancel()
+		snap, entries := l.Since(ctx, after, 1000)
+		json.NewEncoder(w).Encode(Batch{Epoch: l.Epoch(), LastIndex: l.LastIndex(), Snapshot: snap, Entries: entries})
+	}))
+	t.Cleanup(leader.srv.Close)
+	return leader
+}
+
+func TestFollowerRestoresSnapshotsAndResetsOnNewEpoch(t *testing.T) {
+	leader := startTestLeader(t)
+	l := leader.log.Load()
+	l.retain = 2
+	l.Append(store.OpCategoryUpsert, models.Category{CategoryID: 1, Name: "Tools"})
+	for id := 1; id <= 5; id++ {
+		l.Append(store.OpProductUpsert, product(id, 1))
+	}
+
+	products := store.NewProductStore()
+	categories := store.NewCategoryStore()
+	f := NewFollower(leader.srv.URL, StoreApplier(products, categories), StoreRestorer(products, categories))
+	poll := func() {
+		t.Helper()
+		if err := f.pollOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	poll()
+	if st := f.Status(); st.AppliedIndex != 6 || st.LagEntries != 0 {
+		t.Fatalf("after the first poll: %+v, want index 6 applied", st)
+	}
+	if got := len(products.Snapshot()); got != 5 {
+		t.Errorf("follower has %d products, want 5", got)
+	}
+
+	// The leader restarts with a different catalog. Nothing the old leader
+	// sent may survive the resync.
+	fresh := NewLog()
+	fresh.Append(store.OpCategoryUpsert, models.Category{CategoryID: 7, Name: "Garden"})
+	fresh.Append(store.OpProductUpsert, product(9, 7))
+	leader.log.Store(fresh)
+
+	poll() // notices the new epoch
+	if got, _ := categories.Snapshot(); len(got) != 0 || len(products.Snapshot()) != 0 {
+		t.Errorf("after the epoch change the follower still has %d categories and %d products", len(got), len(products.Snapshot()))
+	}
+	poll()
+	if got := products.Snapshot(); len(got) != 1 || got[0].ProductID != 9 {
+		t.Errorf("follower products after resyncing = %+v, want product 9 alone", got)
+	}
+	if _, err := categories.GetCategory(1); err == nil {
+		t.Error("category 1, which only the old leader had, survived the resync")
+	}
+}
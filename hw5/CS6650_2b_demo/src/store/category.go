@@ -0,0 +1,235 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"product-api/models"
+)
+
+// CategoryStore provides thread-safe in-memory storage for the category tree.
+// Children are indexed by parent so subtree walks don't scan every category.
+type CategoryStore struct {
+	mu         sync.RWMutex
+	categories map[int]*models.Category
+	children   map[int]map[int]struct{}
+	nextID     int
+	onChange   ChangeHook
+}
+
+func NewCategoryStore() *CategoryStore {
+	return &CategoryStore{
+		categories: make(map[int]*models.Category),
+		children:   make(map[int]map[int]struct{}),
+		nextID:     1,
+	}
+}
+
+func (s *CategoryStore) GetCategory(id int) (*models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	category, exists := s.categories[id]
+	if !exists {
+		return nil, newError(ErrNotFound, fmt.Sprintf("category with ID %d not found", id))
+	}
+	return category, nil
+}
+
+// ListCategories returns every category ordered by ID.
+func (s *CategoryStore) ListCategories() []*models.Category {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*models.Category, 0, len(s.categories))
+	for _, c := range s.categories {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CategoryID < out[j].CategoryID })
+	return out
+}
+
+// CreateCategory stores a new category under the next free ID.
+func (s *CategoryStore) CreateCategory(category *models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if _, taken := s.categories[s.nextID]; !taken {
+			break
+		}
+		s.nextID++
+	}
+	if err := s.checkParentLocked(s.nextID, category.ParentID); err != nil {
+		return err
+	}
+
+	category.CategoryID = s.nextID
+	s.nextID++
+	s.putLocked(category)
+	return nil
+}
+
+// UpsertCategory creates or replaces the category with the given ID.
+// The parent must exist and must not be the category itself or one of its descendants.
+func (s *CategoryStore) UpsertCategory(id int, category *models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkParentLocked(id, category.ParentID); err != nil {
+		return err
+	}
+
+	if old, exists := s.categories[id]; exists {
+		s.unlinkLocked(old)
+	}
+	category.CategoryID = id
+	s.putLocked(category)
+	return nil
+}
+
+// DeleteCategory removes a leaf category. Categories that still have children
+// are rejected so the tree never contains orphans.
+func (s *CategoryStore) DeleteCategory(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteLocked(id)
+}
+
+// DeleteUnusedCategory removes a leaf category like DeleteCategory, and
+// rejects it while any product is filed under it. The products are counted
+// under the category lock, which ProductStore.UpsertProductInCategory also
+// holds, so no product can be filed under the category before it is gone.
+func (s *CategoryStore) DeleteUnusedCategory(id int, products *ProductStore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.categories[id]; !exists {
+		return newError(ErrNotFound, fmt.Sprintf("category with ID %d not found", id))
+	}
+	if n := products.CountByCategory(id); n > 0 {
+		return newError(ErrConflict, fmt.Sprintf("category %d is referenced by %d product(s)", id, n))
+	}
+	return s.deleteLocked(id)
+}
+
+// SetChangeHook installs h to observe writes. Call it before serving requests.
+func (s *CategoryStore) SetChangeHook(h ChangeHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = h
+}
+
+// Subtree returns the IDs of the category and all of its descendants.
+func (s *CategoryStore) Subtree(id int) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.categories[id]; !exists {
+		return nil, newError(ErrNotFound, fmt.Sprintf("category with ID %d not found", id))
+	}
+
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for child := range s.children[ids[i]] {
+			ids = append(ids, child)
+		}
+	}
+	return ids, nil
+}
+
+// Snapshot returns a copy of every category, ordered by ID, along with the
+// ID CreateCategory will try next.
+func (s *CategoryStore) Snapshot() ([]models.Category, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.Category, 0, len(s.categories))
+	for _, c := range s.categories {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CategoryID < out[j].CategoryID })
+	return out, s.nextID
+}
+
+// Restore replaces the whole tree with the given categories and rebuilds the
+// children index. The change hook is not called.
+func (s *CategoryStore) Restore(categories []models.Category, nextID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.categories = make(map[int]*models.Category, len(categories))
+	s.children = make(map[int]map[int]struct{})
+	s.nextID = max(nextID, 1)
+	for i := range categories {
+		c := categories[i]
+		s.categories[c.CategoryID] = &c
+		if c.ParentID != nil {
+			siblings, ok := s.children[*c.ParentID]
+			if !ok {
+				siblings = make(map[int]struct{})
+				s.children[*c.ParentID] = siblings
+			}
+			siblings[c.CategoryID] = struct{}{}
+		}
+	}
+}
+
+// --- Helpers (caller must hold s.mu) ---
+
+func (s *CategoryStore) checkParentLocked(id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, exists := s.categories[*parentID]; !exists {
+		return newError(ErrInvalid, fmt.Sprintf("parent category %d does not exist", *parentID))
+	}
+	// Walk up from the proposed parent; reaching id means the move would create a cycle.
+	for cur := parentID; cur != nil; cur = s.categories[*cur].ParentID {
+		if *cur == id {
+			return newError(ErrInvalid, fmt.Sprintf("category %d cannot be its own ancestor", id))
+		}
+	}
+	return nil
+}
+
+func (s *CategoryStore) putLocked(category *models.Category) {
+	s.categories[category.CategoryID] = category
+	if category.ParentID != nil {
+		siblings, ok := s.children[*category.ParentID]
+		if !ok {
+			siblings = make(map[int]struct{})
+			s.children[*category.ParentID] = siblings
+		}
+		siblings[category.CategoryID] = struct{}{}
+	}
+	if s.onChange != nil {
+		s.onChange(OpCategoryUpsert, *category)
+	}
+}
+
+func (s *CategoryStore) deleteLocked(id int) error {
+	category, exists := s.categories[id]
+	if !exists {
+		return newError(ErrNotFound, fmt.Sprintf("category with ID %d not found", id))
+	}
+	if len(s.children[id]) > 0 {
+		return newError(ErrConflict, fmt.Sprintf("category %d still has child categories", id))
+	}
+
+	s.unlinkLocked(category)
+	delete(s.categories, id)
+	delete(s.children, id)
+	if s.onChange != nil {
+		s.onChange(OpCategoryDelete, id)
+	}
+	return nil
+}
+
+func (s *CategoryStore) unlinkLocked(category *models.Category) {
+	if category.ParentID != nil {
+		delete(s.children[*category.ParentID], category.CategoryID)
+	}
+}
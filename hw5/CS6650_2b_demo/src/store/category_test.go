@@ -0,0 +1,51 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"product-api/models"
+)
+
+// TestCategoryDeleteRacesProductUpsert deletes categories while products are
+// filed under them. Every product that was stored must end up in a category
+// that still exists, and every category that was deleted must have had none.
+func TestCategoryDeleteRacesProductUpsert(t *testing.T) {
+	const categories = 200
+	cats := NewCategoryStore()
+	products := NewProductStore()
+	for range categories {
+		if err := cats.CreateCategory(&models.Category{Name: "c"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for id := 1; id <= categories; id++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := cats.DeleteUnusedCategory(id, products)
+			if err != nil && !errors.Is(err, ErrConflict) {
+				t.Errorf("deleting category %d: %v", id, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			p := &models.Product{SKU: "sku", Manufacturer: "m", CategoryID: id, Weight: 1}
+			err := products.UpsertProductInCategory(id, p, cats)
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Errorf("storing product %d: %v", id, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for id := 1; id <= categories; id++ {
+		_, err := cats.GetCategory(id)
+		if n := products.CountByCategory(id); n > 0 && err != nil {
+			t.Errorf("category %d was deleted with %d product(s) in it", id, n)
+		}
+	}
+}
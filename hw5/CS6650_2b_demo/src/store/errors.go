@@ -0,0 +1,24 @@
+package store
+
+import "errors"
+
+// Sentinel errors let handlers map store failures to HTTP status codes
+// with errors.Is while keeping the human-readable message intact.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrInvalid  = errors.New("invalid")
+)
+
+// storeError pairs a descriptive message with one of the sentinel errors above.
+type storeError struct {
+	kind error
+	msg  string
+}
+
+func (e *storeError) Error() string { return e.msg }
+func (e *storeError) Unwrap() error { return e.kind }
+
+func newError(kind error, msg string) error {
+	return &storeError{kind: kind, msg: msg}
+}
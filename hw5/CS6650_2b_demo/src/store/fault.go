@@ -0,0 +1,154 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"product-api/models"
+)
+
+// FaultStore holds the fault-injection rules, in the order they are tried.
+type FaultStore struct {
+	mu     sync.RWMutex
+	rules  []*faultRule
+	nextID int
+}
+
+type faultRule struct {
+	models.FaultRule
+	matched  atomic.Uint64
+	injected atomic.Uint64
+}
+
+func NewFaultStore() *FaultStore {
+	return &FaultStore{nextID: 1}
+}
+
+// ListRules returns a copy of every rule with its counters.
+func (s *FaultStore) ListRules() []models.FaultRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.FaultRule, 0, len(s.rules))
+	for _, r := range s.rules {
+		out = append(out, r.snapshot())
+	}
+	return out
+}
+
+// AddRule validates rule, gives it an ID and appends it.
+func (s *FaultStore) AddRule(rule models.FaultRule) (models.FaultRule, error) {
+	if err := normalizeFaultRule(&rule); err != nil {
+		return models.FaultRule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule.ID = s.nextID
+	s.nextID++
+	s.rules = append(s.rules, &faultRule{FaultRule: rule})
+	return rule, nil
+}
+
+// ReplaceRules swaps in a new rule list, all or nothing. IDs in the input
+// are ignored.
+func (s *FaultStore) ReplaceRules(rules []models.FaultRule) ([]models.FaultRule, error) {
+	for i := range rules {
+		if err := normalizeFaultRule(&rules[i]); err != nil {
+			return nil, newError(ErrInvalid, fmt.Sprintf("rule %d: %v", i, err))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = make([]*faultRule, 0, len(rules))
+	for i := range rules {
+		rules[i].ID = s.nextID
+		s.nextID++
+		s.rules = append(s.rules, &faultRule{FaultRule: rules[i]})
+	}
+	return rules, nil
+}
+
+// DeleteRule removes one rule.
+func (s *FaultStore) DeleteRule(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.rules, func(r *faultRule) bool { return r.ID == id })
+	if i < 0 {
+		return newError(ErrNotFound, fmt.Sprintf("fault rule %d not found", id))
+	}
+	s.rules = slices.Delete(s.rules, i, i+1)
+	return nil
+}
+
+// Pick finds the first rule that match accepts and counts the match. The
+// rule is returned only if roll, uniform in [0, 100), falls within its
+// Percent; a request is never tried against later rules.
+func (s *FaultStore) Pick(match func(*models.FaultRule) bool, roll float64) (models.FaultRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.rules {
+		if !match(&r.FaultRule) {
+			continue
+		}
+		r.matched.Add(1)
+		if roll >= r.Percent {
+			return models.FaultRule{}, false
+		}
+		r.injected.Add(1)
+		return r.snapshot(), true
+	}
+	return models.FaultRule{}, false
+}
+
+func (r *faultRule) snapshot() models.FaultRule {
+	out := r.FaultRule
+	out.Matched = r.matched.Load()
+	out.Injected = r.injected.Load()
+	return out
+}
+
+func normalizeFaultRule(r *models.FaultRule) error {
+	r.Method = strings.ToUpper(r.Method)
+	r.Header = http.CanonicalHeaderKey(r.Header)
+	r.Matched, r.Injected = 0, 0
+	switch {
+	case r.Route != "" && !strings.HasPrefix(r.Route, "/"):
+		return newError(ErrInvalid, "route must start with /")
+	case r.HeaderValue != "" && r.Header == "":
+		return newError(ErrInvalid, "header_value needs header")
+	case r.Percent < 0 || r.Percent > 100:
+		return newError(ErrInvalid, "percent must be between 0 and 100")
+	case r.LatencyMs < 0:
+		return newError(ErrInvalid, "latency_ms must be >= 0")
+	}
+	switch r.Fault {
+	case models.FaultNone:
+		if r.LatencyMs == 0 {
+			return newError(ErrInvalid, "rule must set latency_ms, fault or both")
+		}
+	case models.FaultError:
+		if r.Status == 0 {
+			r.Status = http.StatusServiceUnavailable
+		}
+		if r.Status < 400 || r.Status > 599 {
+			return newError(ErrInvalid, "status must be between 400 and 599")
+		}
+	case models.FaultReset, models.FaultTruncate:
+	default:
+		return newError(ErrInvalid, fmt.Sprintf("fault %q is not one of error, reset, truncate", r.Fault))
+	}
+	if r.Fault != models.FaultError {
+		r.Status = 0
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package store
+
+// ChangeHook observes every successful write. Stores call it while holding
+// their write lock, so a hook sees writes in exactly the order they were
+// applied and must not call back into the store.
+type ChangeHook func(op string, value any)
+
+// Operations reported to a ChangeHook, with the type of value passed for each.
+const (
+	OpProductUpsert  = "product.upsert"  // models.Product
+	OpCategoryUpsert = "category.upsert" // models.Category
+	OpCategoryDelete = "category.delete" // int (category ID)
+)
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key. Until Done is set the original request is still running.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Done        bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyStore remembers responses by idempotency key for a fixed TTL.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+	ttl     time.Duration
+}
+
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		records: make(map[string]*IdempotencyRecord),
+		ttl:     ttl,
+	}
+}
+
+// Begin claims key for a request with the given fingerprint.
+// It returns (nil, nil) when the caller should run the request,
+// a completed record when the stored response should be replayed,
+// ErrInvalid when the key was used for a different request, and
+// ErrConflict when the original request is still in flight.
+func (s *IdempotencyStore) Begin(key, fingerprint string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	rec, exists := s.records[key]
+	if exists && !now.Before(rec.ExpiresAt) {
+		delete(s.records, key)
+		exists = false
+	}
+	if !exists {
+		s.records[key] = &IdempotencyRecord{Fingerprint: fingerprint, ExpiresAt: now.Add(s.ttl)}
+		return nil, nil
+	}
+
+	if rec.Fingerprint != fingerprint {
+		return nil, newError(ErrInvalid, "Idempotency-Key was already used with a different request")
+	}
+	if !rec.Done {
+		return nil, newError(ErrConflict, "a request with this Idempotency-Key is still in progress")
+	}
+	copied := *rec
+	return &copied, nil
+}
+
+// Complete stores the response for a key claimed with Begin.
+func (s *IdempotencyStore) Complete(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, exists := s.records[key]
+	if !exists {
+		return
+	}
+	rec.Done = true
+	rec.Status = status
+	rec.Header = header
+	rec.Body = body
+	rec.ExpiresAt = time.Now().Add(s.ttl)
+}
+
+// Abandon drops a claimed key so the request can be retried.
+func (s *IdempotencyStore) Abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+}
+
+// ExpireRecords removes records past their TTL and returns how many were removed.
+func (s *IdempotencyStore) ExpireRecords() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+			n++
+		}
+	}
+	return n
+}
+
+// StartExpiry runs ExpireRecords every interval in a background goroutine
+// until the returned stop function is called.
+func (s *IdempotencyStore) StartExpiry(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.ExpireRecords()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
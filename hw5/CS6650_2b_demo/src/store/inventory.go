@@ -0,0 +1,278 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"product-api/models"
+)
+
+// DefaultReservationTTL is used when a reservation request doesn't ask for one.
+const DefaultReservationTTL = 5 * time.Minute
+
+// ReservationIDStride spaces reservation IDs when they are numbered by
+// product: the nth reservation of product p is p*ReservationIDStride + n.
+const ReservationIDStride = 1 << 20
+
+// InventoryStore tracks per-product stock and outstanding reservations.
+// A single mutex guards both maps so reserve/commit/release are atomic
+// with respect to each other and stock can never go negative.
+type InventoryStore struct {
+	mu           sync.Mutex
+	stock        map[int]*models.Inventory
+	reservations map[int]*models.Reservation
+	nextID       int
+
+	// byProduct holds the next n for each product when reservation IDs
+	// are numbered by product; nil means one sequence for all products.
+	byProduct map[int]int
+}
+
+func NewInventoryStore() *InventoryStore {
+	return &InventoryStore{
+		stock:        make(map[int]*models.Inventory),
+		reservations: make(map[int]*models.Reservation),
+		nextID:       1,
+	}
+}
+
+// GetInventory returns a copy of the product's stock level.
+func (s *InventoryStore) GetInventory(productID int) (models.Inventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, exists := s.stock[productID]
+	if !exists {
+		return models.Inventory{}, newError(ErrNotFound, fmt.Sprintf("no inventory for product %d", productID))
+	}
+	return *inv, nil
+}
+
+// SetStock sets the on-hand quantity. It refuses to drop below the amount
+// currently reserved, since that would make outstanding reservations unfulfillable.
+func (s *InventoryStore) SetStock(productID, onHand int) (models.Inventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, exists := s.stock[productID]
+	if !exists {
+		inv = &models.Inventory{ProductID: productID}
+		s.stock[productID] = inv
+	}
+	if onHand < inv.Reserved {
+		return *inv, newError(ErrConflict,
+			fmt.Sprintf("on_hand %d is below the %d units currently reserved", onHand, inv.Reserved))
+	}
+	inv.OnHand = onHand
+	inv.Available = inv.OnHand - inv.Reserved
+	return *inv, nil
+}
+
+// Reserve holds quantity units of the product for ttl.
+func (s *InventoryStore) Reserve(productID, quantity int, ttl time.Duration) (*models.Reservation, error) {
+	if quantity < 1 {
+		return nil, newError(ErrInvalid, "quantity must be >= 1")
+	}
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, exists := s.stock[productID]
+	if !exists {
+		return nil, newError(ErrNotFound, fmt.Sprintf("no inventory for product %d", productID))
+	}
+	if inv.Available < quantity {
+		return nil, newError(ErrConflict,
+			fmt.Sprintf("insufficient stock for product %d: requested %d, available %d", productID, quantity, inv.Available))
+	}
+
+	inv.Reserved += quantity
+	inv.Available -= quantity
+
+	res := &models.Reservation{
+		ReservationID: s.newReservationIDLocked(productID),
+		ProductID:     productID,
+		Quantity:      quantity,
+		ExpiresAt:     time.Now().Add(ttl),
+	}
+	s.reservations[res.ReservationID] = res
+	copied := *res
+	return &copied, nil
+}
+
+// NumberReservationsByProduct makes Reserve derive reservation IDs from
+// product IDs, so ReservationProduct can tell which product a reservation
+// holds without the store that issued it. Call it before serving requests.
+func (s *InventoryStore) NumberReservationsByProduct() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byProduct = make(map[int]int)
+}
+
+// ReservationProduct returns the product of a reservation issued by a
+// store that numbers reservations by product.
+func ReservationProduct(reservationID int) int {
+	return reservationID / ReservationIDStride
+}
+
+// Commit turns a reservation into a sale, removing the units from stock.
+func (s *InventoryStore) Commit(reservationID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.takeLocked(reservationID)
+	if err != nil {
+		return err
+	}
+	inv := s.stock[res.ProductID]
+	inv.OnHand -= res.Quantity
+	inv.Reserved -= res.Quantity
+	return nil
+}
+
+// Release returns a reservation's units to available stock.
+func (s *InventoryStore) Release(reservationID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.takeLocked(reservationID)
+	if err != nil {
+		return err
+	}
+	s.releaseLocked(res)
+	return nil
+}
+
+// ExpireReservations releases every reservation whose deadline has passed
+// and returns how many were released.
+func (s *InventoryStore) ExpireReservations() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for id, res := range s.reservations {
+		if !now.Before(res.ExpiresAt) {
+			delete(s.reservations, id)
+			s.releaseLocked(res)
+			n++
+		}
+	}
+	return n
+}
+
+// StartExpiry runs ExpireReservations every interval in a background
+// goroutine until the returned stop function is called.
+func (s *InventoryStore) StartExpiry(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.ExpireReservations()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// ExportProduct returns the product's stock and its outstanding
+// reservations, or nil if it has no inventory.
+func (s *InventoryStore) ExportProduct(productID int) (*models.Inventory, []models.Reservation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, exists := s.stock[productID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *inv
+	var reservations []models.Reservation
+	for _, res := range s.reservations {
+		if res.ProductID == productID {
+			reservations = append(reservations, *res)
+		}
+	}
+	return &copied, reservations
+}
+
+// ImportProduct stores stock and reservations exported by another store,
+// replacing any the product had here.
+func (s *InventoryStore) ImportProduct(inv models.Inventory, reservations []models.Reservation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeProductLocked(inv.ProductID)
+	s.stock[inv.ProductID] = &inv
+	for _, res := range reservations {
+		s.reservations[res.ReservationID] = &res
+	}
+}
+
+// RemoveProduct drops the product's stock and reservations.
+func (s *InventoryStore) RemoveProduct(productID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeProductLocked(productID)
+}
+
+// --- Helpers (caller must hold s.mu) ---
+
+// newReservationIDLocked returns an unused reservation ID for the product.
+func (s *InventoryStore) newReservationIDLocked(productID int) int {
+	if s.byProduct == nil {
+		id := s.nextID
+		s.nextID++
+		return id
+	}
+	// n wraps around, so skip reservations still outstanding, including
+	// any handed over from another store.
+	for {
+		n := s.byProduct[productID]%(ReservationIDStride-1) + 1
+		s.byProduct[productID] = n
+		id := productID*ReservationIDStride + n
+		if _, taken := s.reservations[id]; !taken {
+			return id
+		}
+	}
+}
+
+func (s *InventoryStore) removeProductLocked(productID int) {
+	delete(s.stock, productID)
+	for id, res := range s.reservations {
+		if res.ProductID == productID {
+			delete(s.reservations, id)
+		}
+	}
+}
+
+// takeLocked removes and returns a live reservation. A reservation past its
+// deadline is released here rather than waiting for the next expiry sweep.
+func (s *InventoryStore) takeLocked(reservationID int) (*models.Reservation, error) {
+	res, exists := s.reservations[reservationID]
+	if !exists {
+		return nil, newError(ErrNotFound, fmt.Sprintf("reservation %d not found", reservationID))
+	}
+	delete(s.reservations, reservationID)
+	if !time.Now().Before(res.ExpiresAt) {
+		s.releaseLocked(res)
+		return nil, newError(ErrNotFound, fmt.Sprintf("reservation %d has expired", reservationID))
+	}
+	return res, nil
+}
+
+func (s *InventoryStore) releaseLocked(res *models.Reservation) {
+	inv := s.stock[res.ProductID]
+	inv.Reserved -= res.Quantity
+	inv.Available += res.Quantity
+}
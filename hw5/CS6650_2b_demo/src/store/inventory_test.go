@@ -0,0 +1,203 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkInventory reports whether the product's counters are consistent:
+// nothing negative and Available == OnHand - Reserved. It only marks the
+// test failed, so goroutines can call it too.
+func checkInventory(t *testing.T, s *InventoryStore, productID int) bool {
+	t.Helper()
+	inv, err := s.GetInventory(productID)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	if inv.OnHand < 0 || inv.Reserved < 0 || inv.Available < 0 {
+		t.Errorf("negative stock: %+v", inv)
+		return false
+	}
+	if inv.Available != inv.OnHand-inv.Reserved {
+		t.Errorf("available != on_hand - reserved: %+v", inv)
+		return false
+	}
+	return true
+}
+
+func TestInventoryConcurrentReserveCommitRelease(t *testing.T) {
+	const (
+		stock      = 100
+		goroutines = 500
+	)
+	s := NewInventoryStore()
+	if _, err := s.SetStock(1, stock); err != nil {
+		t.Fatal(err)
+	}
+
+	var committed, conflicts atomic.Int64
+	var wg sync.WaitGroup
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.Reserve(1, 1+i%3, time.Minute)
+			if errors.Is(err, ErrConflict) {
+				conflicts.Add(1)
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !checkInventory(t, s, 1) {
+				return
+			}
+			if i%2 == 0 {
+				if err := s.Commit(res.ReservationID); err != nil {
+					t.Error(err)
+					return
+				}
+				committed.Add(int64(res.Quantity))
+			} else if err := s.Release(res.ReservationID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkInventory(t, s, 1)
+	inv, _ := s.GetInventory(1)
+	if inv.Reserved != 0 {
+		t.Errorf("reserved = %d after every reservation was settled, want 0", inv.Reserved)
+	}
+	if want := stock - int(committed.Load()); inv.OnHand != want {
+		t.Errorf("on_hand = %d, want %d (%d units committed)", inv.OnHand, want, committed.Load())
+	}
+	if conflicts.Load() == 0 {
+		t.Log("no reservation ran out of stock; the test didn't exercise contention")
+	}
+}
+
+func TestInventoryConcurrentReservationsNeverOversell(t *testing.T) {
+	const (
+		stock      = 50
+		goroutines = 300
+	)
+	s := NewInventoryStore()
+	if _, err := s.SetStock(1, stock); err != nil {
+		t.Fatal(err)
+	}
+
+	var reserved atomic.Int64
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Reserve(1, 1, time.Minute); err == nil {
+				reserved.Add(1)
+			} else if !errors.Is(err, ErrConflict) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved.Load() != stock {
+		t.Errorf("%d reservations succeeded, want exactly %d", reserved.Load(), stock)
+	}
+	checkInventory(t, s, 1)
+}
+
+func TestInventoryCommitAndReleaseRaceOnOneReservation(t *testing.T) {
+	s := NewInventoryStore()
+	if _, err := s.SetStock(1, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 200 {
+		res, err := s.Reserve(1, 5, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Exactly one of a commit, a release and the expiry sweep may
+		// settle each reservation.
+		var settled atomic.Int32
+		for op := range 3 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				switch op {
+				case 0:
+					if s.Commit(res.ReservationID) == nil {
+						settled.Add(1)
+					}
+				case 1:
+					if s.Release(res.ReservationID) == nil {
+						settled.Add(1)
+					}
+				case 2:
+					s.ExpireReservations()
+				}
+			}()
+		}
+		wg.Wait()
+		if n := settled.Load(); n != 1 {
+			t.Fatalf("reservation %d settled %d times, want 1", res.ReservationID, n)
+		}
+		if !checkInventory(t, s, 1) {
+			return
+		}
+	}
+}
+
+func TestInventoryExpiryRacesWithCommit(t *testing.T) {
+	s := NewInventoryStore()
+	if _, err := s.SetStock(1, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				s.ExpireReservations()
+			}
+		}
+	}()
+	for range 400 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.Reserve(1, 1, time.Millisecond)
+			if err != nil {
+				if !errors.Is(err, ErrConflict) {
+					t.Error(err)
+				}
+				return
+			}
+			// The reservation may already have expired; either way the
+			// counters must stay consistent.
+			s.Commit(res.ReservationID)
+		}()
+	}
+	wg.Wait()
+	close(stop)
+
+	time.Sleep(2 * time.Millisecond)
+	s.ExpireReservations()
+	checkInventory(t, s, 1)
+	if inv, _ := s.GetInventory(1); inv.Reserved != 0 {
+		t.Errorf("reserved = %d after every reservation expired or was committed, want 0", inv.Reserved)
+	}
+}
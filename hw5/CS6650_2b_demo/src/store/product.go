@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"product-api/models"
@@ -12,6 +13,7 @@ import (
 type ProductStore struct {
 	mu       sync.RWMutex
 	products map[int]*models.Product
+	onChange ChangeHook
 }
 
 func NewProductStore() *ProductStore {
@@ -26,7 +28,7 @@ func (s *ProductStore) GetProduct(id int) (*models.Product, error) {
 
 	product, exists := s.products[id]
 	if !exists {
-		return nil, fmt.Errorf("product with ID %d not found", id)
+		return nil, newError(ErrNotFound, fmt.Sprintf("product with ID %d not found", id))
 	}
 	return product, nil
 }
@@ -37,5 +39,105 @@ func (s *ProductStore) UpsertProduct(id int, product *models.Product) error {
 
 	product.ProductID = id
 	s.products[id] = product
+	if s.onChange != nil {
+		s.onChange(OpProductUpsert, *product)
+	}
+	return nil
+}
+
+// UpsertProductInCategory stores the product like UpsertProduct, provided
+// its category exists. The category is looked up under the category lock,
+// held until the product is stored, so the category can't be deleted in
+// between. Like CategoryStore.DeleteUnusedCategory, it takes the category
+// lock before the product lock.
+func (s *ProductStore) UpsertProductInCategory(id int, product *models.Product, categories *CategoryStore) error {
+	categories.mu.RLock()
+	defer categories.mu.RUnlock()
+
+	if _, exists := categories.categories[product.CategoryID]; !exists {
+		return newError(ErrInvalid, fmt.Sprintf("category_id %d does not exist", product.CategoryID))
+	}
+	return s.UpsertProduct(id, product)
+}
+
+// DeleteProduct removes the product with the given ID. Only a cluster
+// handoff deletes products, and a cluster can't be replicated, so the
+// change hook isn't told.
+func (s *ProductStore) DeleteProduct(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.products[id]; !exists {
+		return newError(ErrNotFound, fmt.Sprintf("product with ID %d not found", id))
+	}
+	delete(s.products, id)
 	return nil
-}
\ No newline at end of file
+}
+
+// SetChangeHook installs h to observe writes. Call it before serving requests.
+func (s *ProductStore) SetChangeHook(h ChangeHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = h
+}
+
+// ListProductsByCategory returns the products whose CategoryID is in
+// categoryIDs, ordered by product ID.
+func (s *ProductStore) ListProductsByCategory(categoryIDs []int) []*models.Product {
+	wanted := make(map[int]struct{}, len(categoryIDs))
+	for _, id := range categoryIDs {
+		wanted[id] = struct{}{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*models.Product, 0)
+	for _, p := range s.products {
+		if _, ok := wanted[p.CategoryID]; ok {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProductID < out[j].ProductID })
+	return out
+}
+
+// CountByCategory returns how many products reference the given category.
+func (s *ProductStore) CountByCategory(categoryID int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, p := range s.products {
+		if p.CategoryID == categoryID {
+			n++
+		}
+	}
+	return n
+}
+
+// Snapshot returns a copy of every product, ordered by ID.
+func (s *ProductStore) Snapshot() []models.Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]models.Product, 0, len(s.products))
+	for _, p := range s.products {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProductID < out[j].ProductID })
+	return out
+}
+
+// Restore replaces every product with the given ones. The change hook is
+// not called: restoring a snapshot isn't a write to replicate.
+func (s *ProductStore) Restore(products []models.Product) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.products = make(map[int]*models.Product, len(products))
+	for i := range products {
+		p := products[i]
+		s.products[p.ProductID] = &p
+	}
+}
@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exporter receives every finished, sampled span.
+type Exporter interface {
+	Export(SpanData)
+	Close() error
+}
+
+// NoopExporter discards spans.
+type NoopExporter struct{}
+
+func (NoopExporter) Export(SpanData) {}
+func (NoopExporter) Close() error    { return nil }
+
+// FileExporter appends spans to a file as JSON lines. Writes are buffered
+// and flushed every second and on Close.
+type FileExporter struct {
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	e := &FileExporter{
+		f:    f,
+		w:    w,
+		enc:  json.NewEncoder(w),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go e.flushLoop(time.Second)
+	return e, nil
+}
+
+func (e *FileExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(span)
+}
+
+// Close flushes buffered spans and closes the file.
+func (e *FileExporter) Close() error {
+	close(e.stop)
+	<-e.done
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.w.Flush(); err != nil {
+		e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
+
+func (e *FileExporter) flushLoop(interval time.Duration) {
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.mu.Lock()
+			e.w.Flush()
+			e.mu.Unlock()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Collector keeps spans in memory so tests and debug endpoints can inspect them.
+// When limit is positive only roughly the most recent limit spans are retained.
+type Collector struct {
+	mu    sync.Mutex
+	spans []SpanData
+	limit int
+}
+
+func NewCollector(limit int) *Collector {
+	return &Collector{limit: limit}
+}
+
+func (c *Collector) Export(span SpanData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = append(c.spans, span)
+	// Trim in batches so a full collector doesn't copy on every span.
+	if c.limit > 0 && len(c.spans) >= 2*c.limit {
+		c.spans = append(c.spans[:0], c.spans[len(c.spans)-c.limit:]...)
+	}
+}
+
+func (c *Collector) Close() error { return nil }
+
+// Spans returns a copy of every span collected so far.
+func (c *Collector) Spans() []SpanData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SpanData(nil), c.spans...)
+}
+
+// Trace returns the collected spans belonging to one trace.
+func (c *Collector) Trace(traceID string) []SpanData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []SpanData
+	for _, s := range c.spans {
+		if s.TraceID == traceID {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Reset drops every collected span.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = nil
+}
+
+// ServeHTTP lists collected spans as JSON, filtered by ?trace_id= when given.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	spans := c.Spans()
+	if id := r.URL.Query().Get("trace_id"); id != "" {
+		spans = c.Trace(id)
+	}
+	if spans == nil {
+		spans = []SpanData{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spans)
+}
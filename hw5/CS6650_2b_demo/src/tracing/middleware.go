@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Middleware starts a server span for every request, continuing the trace
+// from an incoming traceparent header when one is present, and echoes the
+// server span's traceparent on the response.
+func Middleware(t *Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remote, _ := ParseTraceparent(r.Header.Get("traceparent"))
+
+			ctx, span := t.StartRemote(r.Context(), r.Method, remote)
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.RequestURI())
+			w.Header().Set("traceparent", span.SpanContext().Traceparent())
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				// The route pattern is only known once chi has matched the request.
+				if rc := chi.RouteContext(ctx); rc != nil && rc.RoutePattern() != "" {
+					span.name = r.Method + " " + rc.RoutePattern()
+					span.SetAttribute("http.route", rc.RoutePattern())
+				}
+				span.SetAttribute("http.status_code", strconv.Itoa(sw.status))
+				span.End()
+			}()
+			next.ServeHTTP(sw, r.WithContext(ctx))
+		})
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,233 @@
+// Package tracing records OpenTelemetry-style spans with W3C trace context
+// propagation, without depending on an external tracing backend.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+
+// SpanContext identifies a span within a trace, as carried by traceparent.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(h string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", h)
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", h)
+	}
+
+	var sc SpanContext
+	if len(parts[1]) != 32 || decodeHex(sc.TraceID[:], parts[1]) != nil || !sc.TraceID.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid trace-id in traceparent %q", h)
+	}
+	if len(parts[2]) != 16 || decodeHex(sc.SpanID[:], parts[2]) != nil || !sc.SpanID.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid parent-id in traceparent %q", h)
+	}
+	var flags [1]byte
+	if len(parts[3]) != 2 || decodeHex(flags[:], parts[3]) != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace-flags in traceparent %q", h)
+	}
+	sc.Sampled = flags[0]&0x01 == 1
+	return sc, nil
+}
+
+// SpanData is the finished, exported form of a span.
+type SpanData struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Name         string            `json:"name"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	DurationUS   int64             `json:"duration_us"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Tracer creates spans and hands finished ones to its exporter.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Span is an in-progress unit of work. A nil *Span is valid and records nothing,
+// so code can trace unconditionally.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	name   string
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs map[string]string
+	err   string
+	ended bool
+}
+
+type spanKey struct{}
+type tracerKey struct{}
+
+// WithTracer stores t in ctx so Start can find it.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// SpanFromContext returns the active span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a child of the span in ctx using the tracer in ctx.
+// Without a tracer it returns ctx unchanged and a nil span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+	if t == nil {
+		return ctx, nil
+	}
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.sc
+	}
+	return t.start(ctx, name, parent)
+}
+
+// StartRemote begins a span whose parent arrived over the wire.
+func (t *Tracer) StartRemote(ctx context.Context, name string, remote SpanContext) (context.Context, *Span) {
+	return t.start(WithTracer(ctx, t), name, remote)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, parent SpanContext) (context.Context, *Span) {
+	s := &Span{tracer: t, name: name, start: time.Now(), parent: parent.SpanID}
+	if parent.TraceID.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+	} else {
+		fillRandom(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	fillRandom(s.sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanContext returns the identifiers to propagate downstream.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]string)
+	}
+	s.attrs[key] = value
+}
+
+// RecordError marks the span as failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and exports it. Calling End more than once is a no-op.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceID:    s.sc.TraceID.String(),
+		SpanID:     s.sc.SpanID.String(),
+		Name:       s.name,
+		Start:      s.start,
+		End:        end,
+		DurationUS: end.Sub(s.start).Microseconds(),
+		Attributes: s.attrs,
+		Error:      s.err,
+	}
+	s.mu.Unlock()
+
+	if s.parent.IsValid() {
+		data.ParentSpanID = s.parent.String()
+	}
+	if s.sc.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// --- Helpers ---
+
+func fillRandom(b []byte) {
+	for {
+		for i := range b {
+			b[i] = byte(rand.Uint32())
+		}
+		for _, v := range b {
+			if v != 0 {
+				return
+			}
+		}
+	}
+}
+
+func decodeHex(dst []byte, s string) error {
+	if strings.ToLower(s) != s {
+		return fmt.Errorf("uppercase hex")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
@@ -16,10 +16,23 @@ PRODUCTS = [
 
 PRODUCT_COUNTER = 100
 
+# Products must reference an existing category, so seed ids 1-50 first.
+CATEGORIES = [{"name": f"Category-{i}"} for i in range(1, 51)]
+
+
+def seed_categories(client):
+    for i, category in enumerate(CATEGORIES, start=1):
+        client.put(
+            f"/categories/{i}",
+            json=category,
+            name="/categories/[id] (seed)",
+        )
+
 class HttpUserLoadTest(HttpUser):
     wait_time = between(1, 3)
 
     def on_start(self):
+        seed_categories(self.client)
         for product in PRODUCTS:
             self.client.post(
                 f"/products/{product['product_id']}/details",
@@ -55,6 +68,7 @@ class FastHttpUserLoadTest(FastHttpUser):
     wait_time = between(1, 3)
 
     def on_start(self):
+        seed_categories(self.client)
         for product in PRODUCTS:
             self.client.post(
                 f"/products/{product['product_id']}/details",
@@ -0,0 +1,88 @@
+package albumsvc
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// artist is a performer albums are filed under.
+type artist struct {
+	ID   string `json:"id"`
+	Name string `json:"name" binding:"required"`
+}
+
+// getArtists responds with the list of all artists as JSON.
+func (svc *service) getArtists(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, svc.albums.Artists())
+}
+
+// getArtistByID responds with the artist whose ID matches the id parameter.
+func (svc *service) getArtistByID(c *gin.Context) {
+	ar, ok := svc.albums.Artist(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errArtistNotFound)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, ar)
+}
+
+// postArtists adds an artist from JSON received in the request body. The
+// ID is made from the name unless the client sends one.
+func (svc *service) postArtists(c *gin.Context) {
+	var ar artist
+	if err := c.ShouldBindJSON(&ar); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	created, err := svc.albums.CreateArtist(ar)
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", "/artists/"+url.PathEscape(created.ID))
+	c.IndentedJSON(http.StatusCreated, created)
+}
+
+// getArtistAlbums responds with one page of an artist's albums. It takes
+// the same filter, sort and paging parameters as GET /albums.
+func (svc *service) getArtistAlbums(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := svc.albums.Artist(id); !ok {
+		abortWithStoreError(c, errArtistNotFound)
+		return
+	}
+	query, problems := parseAlbumQuery(c.GetQuery, svc.rates)
+	if len(problems) > 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "query parameters are invalid", problems...)
+		return
+	}
+	query.artistID = id
+	svc.respondWithPage(c, query)
+}
+
+// slugify makes an artist ID from a name: "Sarah Vaughan" becomes
+// "sarah-vaughan". Letters and digits of any script are kept.
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "artist"
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package albumsvc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errBlobNotFound is returned when no blob has the requested key.
+var errBlobNotFound = errors.New("blob not found")
+
+// blobStore keeps binary objects, such as cover images, under slash-separated
+// keys like "covers/31/original".
+type blobStore interface {
+	// Put stores data under key, replacing any blob there.
+	Put(key, contentType string, data []byte) (blobInfo, error)
+	// Open returns the blob under key, or errBlobNotFound.
+	Open(key string) (blob, error)
+	// DeleteAll removes every blob whose key starts with prefix + "/".
+	DeleteAll(prefix string) error
+}
+
+// blobInfo describes a stored blob.
+type blobInfo struct {
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ETag        string    `json:"etag"` // quoted, ready for the ETag header
+	ModTime     time.Time `json:"mod_time"`
+	File        string    `json:"file"` // fsBlobStore: name of the data file
+}
+
+// blob is an open blob. Close it when done.
+type blob struct {
+	io.ReadSeekCloser
+	blobInfo
+}
+
+// fsBlobStore keeps blobs as files under a directory.
+//
+// Each key has a small JSON file, <key>.json, naming a data file that is
+// never modified once written. Put writes the new data file first and then
+// renames a new JSON file into place, so a reader always finds a complete
+// blob, and one that matches its ETag.
+type fsBlobStore struct {
+	dir string
+}
+
+func newFSBlobStore(dir string) (*fsBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fsBlobStore{dir: dir}, nil
+}
+
+// Put stores data under key, replacing any blob there.
+func (s *fsBlobStore) Put(key, contentType string, data []byte) (blobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return blobInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return blobInfo{}, err
+	}
+	old, oldErr := s.info(path)
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:16])
+	info := blobInfo{
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		ETag:        `"` + hash + `"`,
+		ModTime:     time.Now().UTC().Truncate(time.Second),
+		File:        filepath.Base(path) + "." + hash,
+	}
+	if err := writeFileAtomic(filepath.Join(filepath.Dir(path), info.File), data); err != nil {
+		return blobInfo{}, err
+	}
+	meta, err := json.Marshal(info)
+	if err != nil {
+		return blobInfo{}, err
+	}
+	if err := writeFileAtomic(path+".json", meta); err != nil {
+		return blobInfo{}, err
+	}
+	// Readers that already opened the old data file keep reading it.
+	if oldErr == nil && old.File != info.File {
+		os.Remove(filepath.Join(filepath.Dir(path), old.File))
+	}
+	return info, nil
+}
+
+// Open returns the blob under key, or errBlobNotFound.
+func (s *fsBlobStore) Open(key string) (blob, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return blob{}, err
+	}
+	// A Put between reading the JSON file and opening the data file it
+	// names removes that data file; the JSON file then names a newer one.
+	for range 3 {
+		info, err := s.info(path)
+		if err != nil {
+			return blob{}, err
+		}
+		f, err := os.Open(filepath.Join(filepath.Dir(path), info.File))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return blob{}, err
+		}
+		return blob{ReadSeekCloser: f, blobInfo: info}, nil
+	}
+	return blob{}, fmt.Errorf("blob %s kept changing while being opened", key)
+}
+
+// DeleteAll removes every blob whose key starts with prefix + "/".
+func (s *fsBlobStore) DeleteAll(prefix string) error {
+	path, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// path maps a key to a file path, refusing keys that would escape s.dir.
+func (s *fsBlobStore) path(key string) (string, error) {
+	p := filepath.FromSlash(key)
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, p), nil
+}
+
+func (s *fsBlobStore) info(path string) (blobInfo, error) {
+	data, err := os.ReadFile(path + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return blobInfo{}, errBlobNotFound
+	}
+	if err != nil {
+		return blobInfo{}, err
+	}
+	var info blobInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return blobInfo{}, fmt.Errorf("%s.json: %w", path, err)
+	}
+	return info, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path,
+// so path never holds part of data.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,465 @@
+package albumsvc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltAlbumStore is an AlbumStore that also keeps its albums in a bbolt
+// database file, so they survive a restart.
+//
+// The database has four buckets:
+//
+//	meta     "version" is the schema version the albums were written at
+//	artists  one artist per key, keyed by the order they were added
+//	albums   one album per key, keyed by its position in the store
+//	orders   one order per key, keyed by the order they were placed
+//
+// Keys are big-endian integers, so a bucket iterates in the store's order.
+// Every change is one transaction, committed before the change is visible.
+// A checkout writes its order together with the albums it took stock from.
+// Opening a database written by an older version upgrades its albums
+// through albumMigrations and rewrites it at the current version. Opening
+// an album file written by the JSON-lines store that came before imports
+// it; see importAlbumFile.
+type BoltAlbumStore struct {
+	mem *AlbumStore
+
+	mu sync.Mutex // serializes writes, so the database and mem agree on order
+	db *bolt.DB
+}
+
+var (
+	metaBucket    = []byte("meta")
+	artistsBucket = []byte("artists")
+	albumsBucket  = []byte("albums")
+	ordersBucket  = []byte("orders")
+
+	versionKey = []byte("version")
+)
+
+// albumMigrations upgrade a stored album from one schema version to the
+// next: albumMigrations[i] turns a version i+1 album into a version i+2
+// one. Add a function here whenever the album type changes in a way old
+// records can't be decoded into.
+var albumMigrations = []func(map[string]any) error{
+	// 1 to 2: artists became records of their own and albums gained
+	// tracks. A version 1 album only has an artist name; load files it
+	// under the artist with that name, as for any album written that way.
+	func(map[string]any) error { return nil },
+	// 2 to 3: prices became amounts in minor units with a currency, and
+	// albums gained a price history. Earlier prices were US dollars.
+	func(doc map[string]any) error {
+		dollars, ok := doc["price"].(float64)
+		if !ok {
+			return errors.New("price is not a number")
+		}
+		price := map[string]any{"amount": math.Round(dollars * 100), "currency": "USD"}
+		doc["price"] = price
+		doc["price_history"] = []any{map[string]any{"price": price}}
+		return nil
+	},
+	// 3 to 4: albums gained stock. Nothing was counted before, so there is
+	// none, and the album can't be sold, until someone sets it.
+	func(doc map[string]any) error {
+		doc["stock"] = 0
+		log.Printf("album %v has no stock after upgrading it to schema version 4; set its stock to sell it", doc["id"])
+		return nil
+	},
+}
+
+// albumSchemaVersion is the version the store writes.
+var albumSchemaVersion = len(albumMigrations) + 1
+
+// firstBoltVersion is the version the first databases were written at.
+// Albums at earlier versions only exist in album files, which are
+// upgraded as they are imported.
+const firstBoltVersion = 4
+
+// storedAlbum is how an album is written to the database: with its price
+// history, which albums leave out of their JSON.
+type storedAlbum struct {
+	album
+	History []pricePoint `json:"price_history"`
+}
+
+// OpenBoltAlbumStore loads the albums in the database at path. If there is
+// no database yet, it is created holding the seed albums.
+func OpenBoltAlbumStore(path string, seed []album) (*BoltAlbumStore, error) {
+	if err := importAlbumFile(path); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s := &BoltAlbumStore{mem: NewAlbumStore(nil), db: db}
+
+	version, err := s.load()
+	switch {
+	case err != nil:
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	case version == 0:
+		s.mem = NewAlbumStore(seed)
+		err = s.rewrite()
+	case version < albumSchemaVersion:
+		err = s.rewrite()
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Entries returns a copy of every album with its position, in order.
+func (s *BoltAlbumStore) Entries() []albumEntry { return s.mem.Entries() }
+
+// Get returns the album with the given ID.
+func (s *BoltAlbumStore) Get(id string) (album, bool) { return s.mem.Get(id) }
+
+// Create stores a new album, assigning it an ID from newID if it has none.
+// See AlbumStore.Create.
+func (s *BoltAlbumStore) Create(a album, newID idGenerator) (album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.ID == "" {
+		for a.ID = newID(); s.exists(a.ID); a.ID = newID() {
+		}
+	} else if s.exists(a.ID) {
+		return album{}, errDuplicateID
+	}
+	notePrice(&a, nil, time.Now())
+	if err := s.put(&a); err != nil {
+		return album{}, err
+	}
+	return a, nil
+}
+
+// Put stores a under its ID, replacing the album there if there is one.
+// See AlbumStore.Put.
+func (s *BoltAlbumStore) Put(a album) (stored album, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.mem.Get(a.ID)
+	if exists {
+		notePrice(&a, &old, time.Now())
+	} else {
+		notePrice(&a, nil, time.Now())
+	}
+	if err := s.put(&a); err != nil {
+		return album{}, false, err
+	}
+	return a, !exists, nil
+}
+
+// Update applies change to the album with the given ID and returns the
+// result. See AlbumStore.Update.
+func (s *BoltAlbumStore) Update(id string, change func(*album) error) (album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.mem.Get(id)
+	if !exists {
+		return album{}, errNotFound
+	}
+	a := old
+	a.Tracks = slices.Clone(a.Tracks)
+	if err := change(&a); err != nil {
+		return album{}, err
+	}
+	a.ID = id
+	notePrice(&a, &old, time.Now())
+	if err := s.put(&a); err != nil {
+		return album{}, err
+	}
+	return a, nil
+}
+
+// Delete removes the album with the given ID.
+func (s *BoltAlbumStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.mem.entry(id)
+	if !ok {
+		return errNotFound
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(albumsBucket).Delete(itob(e.seq))
+	})
+	if err != nil {
+		return err
+	}
+	return s.mem.Delete(id)
+}
+
+// Artists returns a copy of every artist, in the order they were added.
+func (s *BoltAlbumStore) Artists() []artist { return s.mem.Artists() }
+
+// Artist returns the artist with the given ID.
+func (s *BoltAlbumStore) Artist(id string) (artist, bool) { return s.mem.Artist(id) }
+
+// CreateArtist stores a new artist. See AlbumStore.CreateArtist.
+func (s *BoltAlbumStore) CreateArtist(ar artist) (artist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ar, err := s.mem.planArtist(ar)
+	if err != nil {
+		return artist{}, err
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error { return putArtist(tx, ar) }); err != nil {
+		return artist{}, err
+	}
+	s.mem.restoreArtist(ar)
+	return ar, nil
+}
+
+// PlaceOrder turns a cart into an order. See AlbumStore.PlaceOrder.
+func (s *BoltAlbumStore) PlaceOrder(c cart, rates *exchangeRates, newID idGenerator) (o order, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, placed, err := s.mem.planOrder(c, rates, newID)
+	if err != nil || placed {
+		return o, false, err
+	}
+	// Store the albums with the stock the order leaves them, so loading the
+	// database needn't replay orders.
+	sold := make(map[string]albumEntry)
+	for _, line := range o.Lines {
+		e, ok := sold[line.AlbumID]
+		if !ok {
+			if e, ok = s.mem.entry(line.AlbumID); !ok {
+				continue
+			}
+		}
+		e.Stock -= line.Quantity
+		sold[line.AlbumID] = e
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range sold {
+			if err := putAlbum(tx, e.album, e.seq); err != nil {
+				return err
+			}
+		}
+		return putOrder(tx, o)
+	})
+	if err != nil {
+		return order{}, false, err
+	}
+	s.mem.commitOrder(o, true)
+	return o, true, nil
+}
+
+// Order returns the order with the given ID.
+func (s *BoltAlbumStore) Order(id string) (order, bool) { return s.mem.Order(id) }
+
+// Close closes the database. Every change is already on disk.
+func (s *BoltAlbumStore) Close() error {
+	return s.db.Close()
+}
+
+// --- Helpers ---
+
+func (s *BoltAlbumStore) exists(id string) bool {
+	_, ok := s.mem.Get(id)
+	return ok
+}
+
+// put writes a, and the artist it creates if any, and then stores it,
+// keeping the position of the album it replaces. The caller holds s.mu.
+func (s *BoltAlbumStore) put(a *album) error {
+	ar, err := s.mem.plan(a)
+	if err != nil {
+		return err
+	}
+	seq := s.mem.position(a.ID)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if ar != nil {
+			if err := putArtist(tx, *ar); err != nil {
+				return err
+			}
+		}
+		return putAlbum(tx, *a, seq)
+	})
+	if err != nil {
+		return err
+	}
+	if ar != nil {
+		s.mem.restoreArtist(*ar)
+	}
+	s.mem.restore(*a, seq)
+	return nil
+}
+
+// load reads the database into s.mem and returns the schema version it was
+// written at, or 0 if it is new.
+func (s *BoltAlbumStore) load() (version int, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return nil
+		}
+		if version, err = strconv.Atoi(string(meta.Get(versionKey))); err != nil {
+			return errors.New("not an album store")
+		}
+		if version < firstBoltVersion || version > albumSchemaVersion {
+			return fmt.Errorf("schema version %d is not supported; this build reads versions %d to %d", version, firstBoltVersion, albumSchemaVersion)
+		}
+
+		err := forEach(tx, artistsBucket, func(_ []byte, ar artist) error {
+			s.mem.restoreArtist(ar)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(albumsBucket).ForEach(func(k, v []byte) error {
+			a, err := decodeAlbum(v, version)
+			if err != nil {
+				return fmt.Errorf("album %d: %w", btoi(k), err)
+			}
+			ar, err := s.mem.plan(&a)
+			if err != nil {
+				return fmt.Errorf("album %s: %w", a.ID, err)
+			}
+			if ar != nil {
+				s.mem.restoreArtist(*ar)
+			}
+			s.mem.restore(a, btoi(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// The albums were stored with these orders already taken out of
+		// their stock.
+		return forEach(tx, ordersBucket, func(_ []byte, o order) error {
+			s.mem.commitOrder(o, false)
+			return nil
+		})
+	})
+	return version, err
+}
+
+// decodeAlbum reads an album written at the given schema version,
+// migrating it to the current one first.
+func decodeAlbum(data []byte, version int) (album, error) {
+	if version < albumSchemaVersion {
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return album{}, err
+		}
+		for _, migrate := range albumMigrations[version-1:] {
+			if err := migrate(doc); err != nil {
+				return album{}, err
+			}
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return album{}, err
+		}
+	}
+	var stored storedAlbum
+	err := json.Unmarshal(data, &stored)
+	stored.album.History = stored.History
+	return stored.album, err
+}
+
+// rewrite replaces everything in the database with what s.mem holds, at
+// the current schema version, in one transaction.
+func (s *BoltAlbumStore) rewrite() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metaBucket, artistsBucket, albumsBucket, ordersBucket} {
+			if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(albumSchemaVersion))); err != nil {
+			return err
+		}
+		for _, ar := range s.mem.Artists() {
+			if err := putArtist(tx, ar); err != nil {
+				return err
+			}
+		}
+		for _, e := range s.mem.Entries() {
+			if err := putAlbum(tx, e.album, e.seq); err != nil {
+				return err
+			}
+		}
+		for _, o := range s.mem.Orders() {
+			if err := putOrder(tx, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putArtist(tx *bolt.Tx, ar artist) error {
+	return putNext(tx.Bucket(artistsBucket), ar)
+}
+
+func putAlbum(tx *bolt.Tx, a album, seq uint64) error {
+	data, err := json.Marshal(storedAlbum{album: a, History: a.History})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(albumsBucket).Put(itob(seq), data)
+}
+
+func putOrder(tx *bolt.Tx, o order) error {
+	return putNext(tx.Bucket(ordersBucket), o)
+}
+
+// putNext stores v as JSON under the bucket's next sequence number.
+func putNext(b *bolt.Bucket, v any) error {
+	n, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(n), data)
+}
+
+// forEach decodes every value in a bucket, in key order.
+func forEach[T any](tx *bolt.Tx, bucket []byte, fn func(k []byte, v T) error) error {
+	return tx.Bucket(bucket).ForEach(func(k, data []byte) error {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("%s %d: %w", bucket, btoi(k), err)
+		}
+		return fn(k, v)
+	})
+}
+
+// itob encodes n as a key that sorts in numeric order.
+func itob(n uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, n)
+}
+
+func btoi(k []byte) uint64 {
+	return binary.BigEndian.Uint64(k)
+}
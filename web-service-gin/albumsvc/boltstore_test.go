@@ -0,0 +1,162 @@
+package albumsvc
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltAlbumStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "albums.db")
+	s, err := OpenBoltAlbumStore(path, seedAlbums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newID, err := newIDGenerator("seq", s.Entries())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := s.Create(album{Title: "Pastel Blues", Artist: "Nina Simone", Price: money{1500, "USD"}, Stock: 5}, newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update("1", func(a *album) error { a.Price.Amount = 4999; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("2"); err != nil {
+		t.Fatal(err)
+	}
+	o, _, err := s.PlaceOrder(cart{ID: "c1", Currency: "USD", Items: []cartItem{{AlbumID: created.ID, Quantity: 2}}}, noRates(), newULID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := s.Entries()
+	s.Close()
+
+	s, err = OpenBoltAlbumStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	got := s.Entries()
+	if len(got) != len(want) {
+		t.Fatalf("reopened store has %d albums, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].seq != want[i].seq || got[i].Price != want[i].Price ||
+			got[i].Stock != want[i].Stock || len(got[i].History) != len(want[i].History) {
+			t.Errorf("album %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if a, _ := s.Get(created.ID); a.Stock != 3 {
+		t.Errorf("stock after selling 2 of 5 = %d, want 3", a.Stock)
+	}
+	if _, ok := s.Order(o.ID); !ok {
+		t.Errorf("order %s is gone", o.ID)
+	}
+	if _, ok := s.Artist("nina-simone"); !ok {
+		t.Error("artist created with the album is gone")
+	}
+	// The cart's order is remembered, so placing it again sells nothing.
+	if _, created, err := s.PlaceOrder(cart{ID: "c1", Currency: "USD"}, noRates(), newULID); err != nil || created {
+		t.Errorf("placing cart c1 again: created %v, err %v", created, err)
+	}
+}
+
+// An album file as the JSON-lines store wrote it at schema version 2,
+// with a last record cut short by a crash.
+const oldAlbumFile = `{"format":"albums","version":2}
+{"op":"artist","artist":{"id":"gerry-mulligan","name":"Gerry Mulligan"}}
+{"op":"put","seq":7,"album":{"id":"1","title":"Blue Train","artist":"John Coltrane","price":56.99}}
+{"op":"put","seq":8,"album":{"id":"2","title":"Jeru","artist_id":"gerry-mulligan","price":17.99}}
+{"op":"put","seq":9,"album":{"id":"3","title":"Gone","artist":"Nobody","price":1}}
+{"op":"delete","id":"3"}
+{"op":"put","seq":10,"album":{"id":"4","tit`
+
+func TestBoltAlbumStoreImportsAlbumFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "albums.db")
+	if err := os.WriteFile(path, []byte(oldAlbumFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&logs)
+	s, err := OpenBoltAlbumStore(path, seedAlbums)
+	log.SetOutput(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("imported store has %d albums, want 2 and no seed albums", len(entries))
+	}
+	a := entries[0]
+	if a.seq != 7 || a.Price != (money{5699, "USD"}) || a.ArtistID != "john-coltrane" || a.Stock != 0 || len(a.History) != 1 {
+		t.Errorf("imported album = %+v", a)
+	}
+	if entries[1].ID != "2" || entries[1].ArtistID != "gerry-mulligan" {
+		t.Errorf("second imported album = %+v", entries[1])
+	}
+	if !strings.Contains(logs.String(), "album 1 has no stock") {
+		t.Errorf("no warning about album 1's stock in %q", logs.String())
+	}
+
+	// The file is kept, and a database at the current version is in its place.
+	if kept, err := os.ReadFile(path + ".jsonl"); err != nil || string(kept) != oldAlbumFile {
+		t.Errorf("the album file wasn't kept as albums.db.jsonl: %v", err)
+	}
+	var version string
+	s.db.View(func(tx *bolt.Tx) error {
+		version = string(tx.Bucket(metaBucket).Get(versionKey))
+		return nil
+	})
+	if version != "4" {
+		t.Errorf("schema version after importing = %s, want 4", version)
+	}
+
+	// New albums go after the imported ones, and everything survives a reopen.
+	newID, _ := newIDGenerator("seq", s.Entries())
+	created, err := s.Create(album{Title: "Pastel Blues", Artist: "Nina Simone", Price: money{1500, "USD"}}, newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s, err = OpenBoltAlbumStore(path, seedAlbums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	entries = s.Entries()
+	if len(entries) != 3 || entries[2].ID != created.ID || entries[2].seq <= 8 {
+		t.Errorf("after reopening: %+v, want the two imported albums and then %s", entries, created.ID)
+	}
+}
+
+func TestBoltAlbumStoreRejectsUnknownVersions(t *testing.T) {
+	for _, version := range []string{"3", "5"} {
+		path := filepath.Join(t.TempDir(), "albums.db")
+		db, err := bolt.Open(path, 0o644, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Update(func(tx *bolt.Tx) error {
+			meta, _ := tx.CreateBucket(metaBucket)
+			return meta.Put(versionKey, []byte(version))
+		})
+		db.Close()
+
+		if s, err := OpenBoltAlbumStore(path, seedAlbums); err == nil {
+			s.Close()
+			t.Errorf("opened a database at schema version %s", version)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package albumsvc
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errCartNotFound is returned when no cart has the requested ID.
+	errCartNotFound = errors.New("cart not found")
+	// errCheckedOut is returned when changing a cart that became an order.
+	errCheckedOut = errors.New("cart has been checked out")
+	// errTooMany is returned when adding to an item would take it past
+	// maxQuantity.
+	errTooMany = errors.New("too many of one album")
+)
+
+// maxQuantity is the most of one album a cart may hold. It keeps line
+// totals far from overflowing.
+const maxQuantity = 1000
+
+// cart is a shopper's list of albums to buy. It holds no prices: they are
+// worked out from the albums whenever the cart is shown or checked out.
+type cart struct {
+	ID        string     `json:"id"`
+	Currency  string     `json:"currency" binding:"omitempty,iso4217"`
+	Items     []cartItem `json:"items"`
+	OrderID   string     `json:"order_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// cartItem is a quantity of one album in a cart.
+type cartItem struct {
+	AlbumID  string `json:"album_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,gte=1,lte=1000"` // lte is maxQuantity
+}
+
+// cartItemPatch is the body of PUT /carts/:id/items/:albumId.
+type cartItemPatch struct {
+	Quantity int `json:"quantity" binding:"required,gte=1,lte=1000"` // lte is maxQuantity
+}
+
+// cartView is a cart as clients see it, priced.
+type cartView struct {
+	ID        string       `json:"id"`
+	Currency  string       `json:"currency"`
+	Items     []lineItem   `json:"items"`
+	Total     money        `json:"total"`
+	Problems  []fieldError `json:"problems,omitempty"` // what would fail checkout
+	OrderID   string       `json:"order_id,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// cartStore keeps carts in memory; unlike orders, they don't outlive the
+// process. Each cart has its own lock, so checking out one cart doesn't
+// hold up changes to others. Checkout places orders in albums, priced with
+// rates.
+type cartStore struct {
+	albums albumRepository
+	rates  *exchangeRates
+
+	mu    sync.Mutex
+	carts map[string]*cartSlot
+}
+
+type cartSlot struct {
+	mu   sync.Mutex
+	cart cart
+}
+
+func newCartStore(albums albumRepository, rates *exchangeRates) *cartStore {
+	return &cartStore{albums: albums, rates: rates, carts: make(map[string]*cartSlot)}
+}
+
+// Create adds an empty cart.
+func (s *cartStore) Create(currency string) cart {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := cart{Currency: currency, Items: []cartItem{}, CreatedAt: time.Now().UTC()}
+	for c.ID = newULID(); s.carts[c.ID] != nil; c.ID = newULID() {
+	}
+	s.carts[c.ID] = &cartSlot{cart: c}
+	return c
+}
+
+// Get returns the cart with the given ID.
+func (s *cartStore) Get(id string) (cart, bool) {
+	slot := s.slot(id)
+	if slot == nil {
+		return cart{}, false
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	return slot.cart, true
+}
+
+// Update applies change to a copy of an open cart's items and stores the
+// result.
+func (s *cartStore) Update(id string, change func(items []cartItem) ([]cartItem, error)) (cart, error) {
+	slot := s.slot(id)
+	if slot == nil {
+		return cart{}, errCartNotFound
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if slot.cart.OrderID != "" {
+		return cart{}, errCheckedOut
+	}
+	items, err := change(slices.Clone(slot.cart.Items))
+	if err != nil {
+		return cart{}, err
+	}
+	slot.cart.Items = items
+	return slot.cart, nil
+}
+
+// Checkout places an order for a cart, or returns the order it already
+// became. The cart stays locked while the order is placed, so concurrent
+// checkouts of one cart all get the same order.
+func (s *cartStore) Checkout(id string) (o order, created bool, err error) {
+	slot := s.slot(id)
+	if slot == nil {
+		return order{}, false, errCartNotFound
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if slot.cart.OrderID != "" {
+		o, ok := s.albums.Order(slot.cart.OrderID)
+		if !ok {
+			return order{}, false, errOrderNotFound
+		}
+		return o, false, nil
+	}
+	o, created, err = s.albums.PlaceOrder(slot.cart, s.rates, newULID)
+	if err != nil {
+		return order{}, false, err
+	}
+	slot.cart.OrderID = o.ID
+	return o, created, nil
+}
+
+// Delete removes a cart.
+func (s *cartStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.carts[id] == nil {
+		return errCartNotFound
+	}
+	delete(s.carts, id)
+	return nil
+}
+
+func (s *cartStore) slot(id string) *cartSlot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.carts[id]
+}
+
+// postCarts creates an empty cart priced in the currency given in the
+// request body, US dollars by default.
+func (svc *service) postCarts(c *gin.Context) {
+	var body cart
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithBindError(c, err)
+			return
+		}
+	}
+	if body.Currency == "" {
+		body.Currency = "USD"
+	}
+	if !svc.rates.has(body.Currency) {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "cart is invalid",
+			fieldError{Field: "currency", Message: "has no exchange rate"})
+		return
+	}
+
+	cart := svc.carts.Create(body.Currency)
+	c.Header("Location", cartLocation(cart.ID))
+	c.IndentedJSON(http.StatusCreated, svc.viewCart(cart))
+}
+
+// getCart responds with a cart, priced at the albums' current prices.
+func (svc *service) getCart(c *gin.Context) {
+	cart, ok := svc.carts.Get(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errCartNotFound)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, svc.viewCart(cart))
+}
+
+// deleteCart discards a cart. Orders placed from it are kept.
+func (svc *service) deleteCart(c *gin.Context) {
+	if err := svc.carts.Delete(c.Param("id")); err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// postCartItem adds a quantity of an album to a cart, on top of any
+// already there.
+func (svc *service) postCartItem(c *gin.Context) {
+	var item cartItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	if _, ok := svc.albums.Get(item.AlbumID); !ok {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "cartItem is invalid",
+			fieldError{Field: "album_id", Message: "is not the id of an album"})
+		return
+	}
+
+	cart, err := svc.carts.Update(c.Param("id"), func(items []cartItem) ([]cartItem, error) {
+		if i := slices.IndexFunc(items, func(it cartItem) bool { return it.AlbumID == item.AlbumID }); i >= 0 {
+			if items[i].Quantity+item.Quantity > maxQuantity {
+				return nil, errTooMany
+			}
+			items[i].Quantity += item.Quantity
+			return items, nil
+		}
+		return append(items, item), nil
+	})
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, svc.viewCart(cart))
+}
+
+// putCartItem sets the quantity of an album in a cart, adding it if it
+// isn't there.
+func (svc *service) putCartItem(c *gin.Context) {
+	var body cartItemPatch
+	if err := c.ShouldBindJSON(&body); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	albumID := c.Param("albumId")
+	if _, ok := svc.albums.Get(albumID); !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+
+	cart, err := svc.carts.Update(c.Param("id"), func(items []cartItem) ([]cartItem, error) {
+		if i := slices.IndexFunc(items, func(it cartItem) bool { return it.AlbumID == albumID }); i >= 0 {
+			items[i].Quantity = body.Quantity
+			return items, nil
+		}
+		return append(items, cartItem{AlbumID: albumID, Quantity: body.Quantity}), nil
+	})
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, svc.viewCart(cart))
+}
+
+// deleteCartItem removes an album from a cart.
+func (svc *service) deleteCartItem(c *gin.Context) {
+	albumID := c.Param("albumId")
+	cart, err := svc.carts.Update(c.Param("id"), func(items []cartItem) ([]cartItem, error) {
+		i := slices.IndexFunc(items, func(it cartItem) bool { return it.AlbumID == albumID })
+		if i < 0 {
+			return nil, errNotInCart
+		}
+		return slices.Delete(items, i, i+1), nil
+	})
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, svc.viewCart(cart))
+}
+
+// checkoutCart turns a cart into an order, taking its items out of stock.
+// Checking out the same cart again returns the same order.
+// Responses: 201 new order, 200 the order placed earlier, 404 unknown cart,
+// 400 empty cart, 409 an item is gone or short of stock.
+func (svc *service) checkoutCart(c *gin.Context) {
+	o, created, err := svc.carts.Checkout(c.Param("id"))
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", "/orders/"+url.PathEscape(o.ID))
+	if created {
+		c.IndentedJSON(http.StatusCreated, o)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, o)
+}
+
+// --- Helpers ---
+
+// errNotInCart is returned when removing an album a cart doesn't hold.
+var errNotInCart = errors.New("album is not in the cart")
+
+func (svc *service) viewCart(c cart) cartView {
+	lines, total, problems := priceItems(c.Items, c.Currency, svc.rates, svc.albums.Get)
+	return cartView{
+		ID:        c.ID,
+		Currency:  c.Currency,
+		Items:     lines,
+		Total:     total,
+		Problems:  problems,
+		OrderID:   c.OrderID,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+func cartLocation(id string) string {
+	return "/carts/" + url.PathEscape(id)
+}
@@ -0,0 +1,175 @@
+package albumsvc
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newCart creates a cart holding the given quantities of albums and
+// returns its ID.
+func newCart(t *testing.T, router http.Handler, quantities map[string]int) string {
+	t.Helper()
+	id := decode[cartView](t, serve(t, router, "POST", "/carts", "", http.StatusCreated)).ID
+	for albumID, n := range quantities {
+		serve(t, router, "PUT", "/carts/"+id+"/items/"+albumID, `{"quantity":`+strconv.Itoa(n)+`}`, http.StatusOK)
+	}
+	return id
+}
+
+func TestCheckoutsOfDifferentCartsShareTheStock(t *testing.T) {
+	const carts = 20
+	router := newTestRouter(t)
+	// Album 3 has 3 copies; every cart wants one.
+	ids := make([]string, carts)
+	for i := range ids {
+		ids[i] = newCart(t, router, map[string]int{"3": 1})
+	}
+
+	statuses := make([]int, carts)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = send(router, "POST", "/carts/"+id+"/checkout", "").Code
+		}()
+	}
+	wg.Wait()
+
+	counts := map[int]int{}
+	for _, s := range statuses {
+		counts[s]++
+	}
+	if counts[http.StatusCreated] != 3 || counts[http.StatusConflict] != carts-3 {
+		t.Errorf("checkout statuses %v, want 3 × 201 and %d × 409", counts, carts-3)
+	}
+	if a := decode[album](t, serve(t, router, "GET", "/albums/3", "", http.StatusOK)); a.Stock != 0 {
+		t.Errorf("stock after selling out = %d, want 0", a.Stock)
+	}
+}
+
+func TestCheckoutOfOneCartIsIdempotent(t *testing.T) {
+	const checkouts = 20
+	router := newTestRouter(t)
+	id := newCart(t, router, map[string]int{"1": 2, "2": 1})
+
+	type result struct {
+		status   int
+		order    order
+		location string
+	}
+	results := make([]result, checkouts)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := send(router, "POST", "/carts/"+id+"/checkout", "")
+			results[i] = result{status: w.Code, location: w.Header().Get("Location")}
+			if err := json.Unmarshal(w.Body.Bytes(), &results[i].order); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	first := results[0].order.ID
+	for _, r := range results {
+		switch r.status {
+		case http.StatusCreated:
+			created++
+		case http.StatusOK:
+		default:
+			t.Fatalf("checkout status %d, want 201 or 200", r.status)
+		}
+		if r.order.ID != first || r.location != "/orders/"+first {
+			t.Errorf("checkout returned order %s at %s, want order %s", r.order.ID, r.location, first)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d checkouts created an order, want 1", created)
+	}
+
+	// Checking out again later still returns the same order with 200.
+	w := serve(t, router, "POST", "/carts/"+id+"/checkout", "", http.StatusOK)
+	if o := decode[order](t, w); o.ID != first || o.Total != (money{2*5699 + 1799, "USD"}) {
+		t.Errorf("later checkout = %+v, want order %s totalling 132.97 USD", o, first)
+	}
+	if a := decode[album](t, serve(t, router, "GET", "/albums/1", "", http.StatusOK)); a.Stock != 8 {
+		t.Errorf("stock of album 1 = %d, want 8: the order was placed more than once", a.Stock)
+	}
+	serve(t, router, "POST", "/carts/"+id+"/items", `{"album_id":"1","quantity":1}`, http.StatusConflict)
+}
+
+func TestCartQuantityLimits(t *testing.T) {
+	router := newTestRouter(t)
+	id := newCart(t, router, nil)
+	items := "/carts/" + id + "/items"
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		detail             fieldError
+	}{
+		{"POST", items, `{"album_id":"1","quantity":0}`, http.StatusBadRequest,
+			fieldError{Field: "quantity", Message: "is required"}},
+		{"POST", items, `{"album_id":"1","quantity":-1}`, http.StatusBadRequest,
+			fieldError{Field: "quantity", Message: "must be at least 1"}},
+		{"POST", items, `{"album_id":"1","quantity":1001}`, http.StatusBadRequest,
+			fieldError{Field: "quantity", Message: "must be at most 1000"}},
+		{"PUT", items + "/1", `{"quantity":9223372036854775807}`, http.StatusBadRequest,
+			fieldError{Field: "quantity", Message: "must be at most 1000"}},
+		{"POST", items, `{"album_id":"1","quantity":600}`, http.StatusOK, fieldError{}},
+		// Adding to an item can't take it past the limit either.
+		{"POST", items, `{"album_id":"1","quantity":600}`, http.StatusBadRequest,
+			fieldError{Field: "quantity", Message: "would take the cart past 1000 of this album"}},
+		{"POST", items, `{"album_id":"1","quantity":400}`, http.StatusOK, fieldError{}},
+	}
+	for _, tt := range tests {
+		w := serve(t, router, tt.method, tt.path, tt.body, tt.status)
+		if tt.status == http.StatusOK {
+			continue
+		}
+		if got := decode[errorBody](t, w).Error; len(got.Details) != 1 || got.Details[0] != tt.detail {
+			t.Errorf("%s %s: details %+v, want %+v", tt.method, tt.body, got.Details, tt.detail)
+		}
+	}
+	cart := decode[cartView](t, serve(t, router, "GET", "/carts/"+id, "", http.StatusOK))
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != maxQuantity {
+		t.Errorf("cart items = %+v, want %d of album 1", cart.Items, maxQuantity)
+	}
+}
+
+func TestBuildOrderRejectsBadQuantities(t *testing.T) {
+	lookup := func(id string) (album, bool) {
+		return album{ID: id, Title: id, Price: money{math.MaxInt64 / 2, "USD"}, Stock: math.MaxInt32}, true
+	}
+	tests := []struct {
+		name  string
+		items []cartItem
+		want  fieldError
+	}{
+		{"zero", []cartItem{{"1", 0}}, fieldError{"items[0].quantity", "must be between 1 and 1000"}},
+		{"negative", []cartItem{{"1", 1}, {"2", -3}}, fieldError{"items[1].quantity", "must be between 1 and 1000"}},
+		{"too many", []cartItem{{"1", maxQuantity + 1}}, fieldError{"items[0].quantity", "must be between 1 and 1000"}},
+		{"line total overflows", []cartItem{{"1", 3}}, fieldError{"items[0]", "line total is too large"}},
+		{"order total overflows", []cartItem{{"1", 1}, {"2", 1}, {"3", 1}}, fieldError{"items[2]", "order total is too large"}},
+	}
+	for _, tt := range tests {
+		_, err := buildOrder(cart{ID: "c", Currency: "USD", Items: tt.items}, "o", time.Now(), noRates(), lookup)
+		unsellable, ok := err.(*checkoutError)
+		if !ok {
+			t.Errorf("%s: err = %v, want a checkoutError", tt.name, err)
+			continue
+		}
+		if len(unsellable.problems) != 1 || unsellable.problems[0] != tt.want {
+			t.Errorf("%s: problems %+v, want %+v", tt.name, unsellable.problems, tt.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package albumsvc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCoverBytes = 10 << 20
+	// maxCoverSide bounds decoding: a small file can claim to be an
+	// enormous image, and decoding allocates for every pixel.
+	maxCoverSide = 4096
+)
+
+// coverTypes are the image types a cover may be uploaded as.
+var coverTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// thumbnailSizes are the longest sides, in pixels, of the thumbnails made
+// for every cover. GET /albums/:id/cover?size=N serves one of them.
+var thumbnailSizes = []int{64, 256, 512}
+
+// coverInfo is the response to an upload.
+type coverInfo struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ETag        string `json:"etag"`
+	Thumbnails  []int  `json:"thumbnail_sizes"`
+}
+
+// putCover stores an album's cover image, sent either as the request body
+// or as the "cover" file of a multipart form, and makes its thumbnails.
+// Responses: 201 for a first cover, 200 for a replacement, 404 unknown
+// album, 413 over 10 MiB, 415 not a JPEG, PNG or GIF image.
+func (svc *service) putCover(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := svc.albums.Get(id); !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+
+	data, err := readCoverUpload(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			abortWithError(c, http.StatusRequestEntityTooLarge, codeTooLarge, "cover must be at most "+strconv.Itoa(maxCoverBytes>>20)+" MiB")
+		case errors.Is(err, errNoCoverPart):
+			abortWithError(c, http.StatusBadRequest, codeValidation, "cover is invalid",
+				fieldError{Field: "cover", Message: "is required"})
+		default:
+			abortWithError(c, http.StatusBadRequest, codeValidation, "could not read the upload: "+err.Error())
+		}
+		return
+	}
+
+	// Trust the bytes, not the Content-Type header.
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(coverTypes, contentType) {
+		abortWithError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia,
+			"cover must be one of "+strings.Join(coverTypes, ", ")+", not "+contentType)
+		return
+	}
+	img, err := decodeCover(data)
+	if err != nil {
+		abortWithError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "cover is not a valid image: "+err.Error())
+		return
+	}
+
+	svc.coverMu.Lock()
+	defer svc.coverMu.Unlock()
+
+	prefix := coverPrefix(id)
+	replaced := svc.hasCover(prefix)
+	info, err := svc.covers.Put(prefix+"/original", contentType, data)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	flat := flatten(img)
+	for _, size := range thumbnailSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumbnail(flat, size), &jpeg.Options{Quality: 85}); err != nil {
+			abortWithError(c, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		if _, err := svc.covers.Put(prefix+"/"+strconv.Itoa(size), "image/jpeg", buf.Bytes()); err != nil {
+			abortWithError(c, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+	}
+
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	bounds := img.Bounds()
+	c.Header("Location", albumLocation(id)+"/cover")
+	c.IndentedJSON(status, coverInfo{
+		ContentType: contentType,
+		Size:        info.Size,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		ETag:        info.ETag,
+		Thumbnails:  thumbnailSizes,
+	})
+}
+
+// getCover serves an album's cover, or with ?size=N one of its thumbnails.
+// It answers conditional requests (If-None-Match, If-Modified-Since) and
+// byte ranges.
+func (svc *service) getCover(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := svc.albums.Get(id); !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+	variant := "original"
+	if size, ok := c.GetQuery("size"); ok {
+		n, err := strconv.Atoi(size)
+		if err != nil || !slices.Contains(thumbnailSizes, n) {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "query parameters are invalid",
+				fieldError{Field: "size", Message: "must be one of " + joinInts(thumbnailSizes, ", ")})
+			return
+		}
+		variant = size
+	}
+
+	b, err := svc.covers.Open(coverPrefix(id) + "/" + variant)
+	if errors.Is(err, errBlobNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "album has no cover")
+		return
+	}
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	defer b.Close()
+
+	c.Header("Content-Type", b.ContentType)
+	c.Header("ETag", b.ETag)
+	c.Header("Cache-Control", "no-cache")
+	http.ServeContent(c.Writer, c.Request, "", b.ModTime, b)
+}
+
+// deleteCover removes an album's cover and its thumbnails.
+func (svc *service) deleteCover(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := svc.albums.Get(id); !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+	svc.coverMu.Lock()
+	defer svc.coverMu.Unlock()
+
+	if !svc.hasCover(coverPrefix(id)) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "album has no cover")
+		return
+	}
+	if err := svc.covers.DeleteAll(coverPrefix(id)); err != nil {
+		abortWithError(c, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// --- Helpers ---
+
+var errNoCoverPart = errors.New("multipart form has no cover file")
+
+// readCoverUpload returns the uploaded image, from a multipart form's
+// "cover" file or else the raw body.
+func readCoverUpload(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCoverBytes+1<<20)
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return readLimited(c.Request.Body)
+	}
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errNoCoverPart
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "cover" {
+			return readLimited(part)
+		}
+	}
+}
+
+// readLimited reads r, failing once it has more than maxCoverBytes. The
+// body as a whole gets some slack for multipart framing.
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxCoverBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCoverBytes {
+		return nil, &http.MaxBytesError{Limit: maxCoverBytes}
+	}
+	return data, nil
+}
+
+func decodeCover(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width > maxCoverSide || cfg.Height > maxCoverSide {
+		return nil, errors.New("images may be at most " + strconv.Itoa(maxCoverSide) + " pixels on a side")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// coverPrefix is the blob key prefix of an album's cover. Album IDs may hold
+// any character, so they are hex-encoded.
+func coverPrefix(albumID string) string {
+	return "covers/" + hex.EncodeToString([]byte(albumID))
+}
+
+func (svc *service) hasCover(prefix string) bool {
+	b, err := svc.covers.Open(prefix + "/original")
+	if err != nil {
+		return false
+	}
+	b.Close()
+	return true
+}
+
+// flatten draws img over a white background, since JPEG thumbnails have no
+// transparency.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// thumbnail scales src down so its longest side is size pixels, averaging
+// the pixels each output pixel covers. Images already small enough keep
+// their size.
+func thumbnail(src *image.RGBA, size int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := sw, sh
+	if longest := max(sw, sh); longest > size {
+		dw = max(1, sw*size/longest)
+		dh = max(1, sh*size/longest)
+	}
+	if dw == sw && dh == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := range dw {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					bl += int(row[i+2])
+					n++
+				}
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(bl / n)
+			dst.Pix[o+3] = 255
+		}
+	}
+	return dst
+}
+
+func joinInts(ns []int, sep string) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, sep)
+}
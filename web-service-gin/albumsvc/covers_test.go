@@ -0,0 +1,107 @@
+package albumsvc
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// putTestCover uploads a w×h PNG as album 1's cover and returns the
+// response.
+func putTestCover(t *testing.T, router http.Handler, w, h, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("PUT", "/albums/1/cover", &buf)
+	req.Header.Set("Content-Type", "image/png")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != status {
+		t.Fatalf("PUT cover: status %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	return rec
+}
+
+// getCover requests album 1's cover with the given headers.
+func getCover(router http.Handler, method, query string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/albums/1/cover"+query, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCoverETagAndRanges(t *testing.T) {
+	router := newTestRouter(t)
+	serve(t, router, "GET", "/albums/1/cover", "", http.StatusNotFound)
+
+	info := decode[coverInfo](t, putTestCover(t, router, 40, 30, http.StatusCreated))
+	full := getCover(router, "GET", "", nil)
+	if full.Code != http.StatusOK || full.Header().Get("ETag") != info.ETag ||
+		full.Header().Get("Content-Type") != "image/png" || int64(full.Body.Len()) != info.Size {
+		t.Fatalf("GET cover: %d, ETag %q, type %q, %d bytes; upload said ETag %q, %d bytes",
+			full.Code, full.Header().Get("ETag"), full.Header().Get("Content-Type"), full.Body.Len(), info.ETag, info.Size)
+	}
+	if full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", full.Header().Get("Accept-Ranges"))
+	}
+	body := full.Body.Bytes()
+
+	tests := []struct {
+		name, method string
+		header       map[string]string
+		status       int
+		body         []byte
+		contentRange string
+	}{
+		{"matching If-None-Match", "GET", map[string]string{"If-None-Match": info.ETag}, http.StatusNotModified, nil, ""},
+		{"matching If-None-Match on HEAD", "HEAD", map[string]string{"If-None-Match": info.ETag}, http.StatusNotModified, nil, ""},
+		{"stale If-None-Match", "GET", map[string]string{"If-None-Match": `"old"`}, http.StatusOK, body, ""},
+		{"first bytes", "GET", map[string]string{"Range": "bytes=0-9"}, http.StatusPartialContent, body[:10],
+			"bytes 0-9/" + strconv.Itoa(len(body))},
+		{"suffix", "GET", map[string]string{"Range": "bytes=-5"}, http.StatusPartialContent, body[len(body)-5:],
+			"bytes " + strconv.Itoa(len(body)-5) + "-" + strconv.Itoa(len(body)-1) + "/" + strconv.Itoa(len(body))},
+		{"If-Range with the current ETag", "GET", map[string]string{"Range": "bytes=0-9", "If-Range": info.ETag},
+			http.StatusPartialContent, body[:10], "bytes 0-9/" + strconv.Itoa(len(body))},
+		{"If-Range with an old ETag", "GET", map[string]string{"Range": "bytes=0-9", "If-Range": `"old"`},
+			http.StatusOK, body, ""},
+		{"unsatisfiable range", "GET", map[string]string{"Range": "bytes=100000-"}, http.StatusRequestedRangeNotSatisfiable, nil,
+			"bytes */" + strconv.Itoa(len(body))},
+	}
+	for _, tt := range tests {
+		w := getCover(router, tt.method, "", tt.header)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.body != nil && !bytes.Equal(w.Body.Bytes(), tt.body) {
+			t.Errorf("%s: got %d bytes, want %d", tt.name, w.Body.Len(), len(tt.body))
+		}
+		if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+			t.Errorf("%s: Content-Range = %q, want %q", tt.name, got, tt.contentRange)
+		}
+	}
+
+	// Thumbnails have ETags of their own.
+	thumb := getCover(router, "GET", "?size=64", nil)
+	if thumb.Code != http.StatusOK || thumb.Header().Get("Content-Type") != "image/jpeg" || thumb.Header().Get("ETag") == info.ETag {
+		t.Errorf("thumbnail: %d, type %q, ETag %q", thumb.Code, thumb.Header().Get("Content-Type"), thumb.Header().Get("ETag"))
+	}
+
+	// A new cover has a new ETag, so the old one no longer matches.
+	replaced := decode[coverInfo](t, putTestCover(t, router, 30, 40, http.StatusOK))
+	if replaced.ETag == info.ETag {
+		t.Fatalf("replacing the cover kept ETag %s", info.ETag)
+	}
+	if w := getCover(router, "GET", "", map[string]string{"If-None-Match": info.ETag}); w.Code != http.StatusOK || w.Header().Get("ETag") != replaced.ETag {
+		t.Errorf("GET with the old ETag: %d, ETag %q, want 200 and %q", w.Code, w.Header().Get("ETag"), replaced.ETag)
+	}
+}
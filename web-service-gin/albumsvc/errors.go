@@ -0,0 +1,147 @@
+package albumsvc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes used in the "code" field of every error response.
+const (
+	codeInvalidJSON      = "INVALID_JSON"
+	codeValidation       = "VALIDATION_FAILED"
+	codeNotFound         = "NOT_FOUND"
+	codeConflict         = "CONFLICT"
+	codeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	codeTooLarge         = "PAYLOAD_TOO_LARGE"
+	codeUnsupportedMedia = "UNSUPPORTED_MEDIA_TYPE"
+	codeNoRate           = "NO_EXCHANGE_RATE"
+	codeOutOfStock       = "OUT_OF_STOCK"
+	codeInvalidQuery     = "INVALID_QUERY"
+	codeTooComplex       = "QUERY_TOO_COMPLEX"
+	codeInternal         = "INTERNAL"
+)
+
+// errorBody is the envelope every failed request gets:
+//
+//	{"error": {"code": "VALIDATION_FAILED", "message": "...", "details": [...]}}
+type errorBody struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []fieldError `json:"details,omitempty"`
+}
+
+func (e apiError) Error() string { return e.Message }
+
+// fieldError describes one invalid field of a request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// abortWithError writes the error envelope and stops the handler chain.
+func abortWithError(c *gin.Context, status int, code, message string, details ...fieldError) {
+	c.AbortWithStatusJSON(status, errorBody{Error: apiError{Code: code, Message: message, Details: details}})
+}
+
+// abortWithBindError reports why a request body couldn't be bound: either
+// it isn't valid JSON for the target, or it failed the binding tags.
+func abortWithBindError(c *gin.Context, err error) {
+	status, body := bindError(err)
+	c.AbortWithStatusJSON(status, errorBody{Error: body})
+}
+
+// abortWithStoreError maps store errors to responses.
+func abortWithStoreError(c *gin.Context, err error) {
+	status, body := storeError(err)
+	c.AbortWithStatusJSON(status, errorBody{Error: body})
+}
+
+// bindError is the response abortWithBindError writes for err.
+func bindError(err error) (int, apiError) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return http.StatusBadRequest, apiError{Code: codeInvalidJSON, Message: "request body is not valid JSON: " + err.Error()}
+	}
+	// Namespaces look like "album.tracks[0].title": the type that failed,
+	// then the path to the field by JSON names.
+	var kind string
+	details := make([]fieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		var field string
+		kind, field, _ = strings.Cut(fe.Namespace(), ".")
+		details = append(details, fieldError{Field: field, Message: describeTag(fe)})
+	}
+	return http.StatusBadRequest, apiError{Code: codeValidation, Message: strings.TrimSuffix(kind, "Patch") + " is invalid", Details: details}
+}
+
+// storeError is the response abortWithStoreError writes for err.
+func storeError(err error) (int, apiError) {
+	var unsellable *checkoutError
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: "album not found"}
+	case errors.Is(err, errDuplicateID):
+		return http.StatusConflict, apiError{Code: codeConflict, Message: "album with this id already exists"}
+	case errors.Is(err, errArtistNotFound):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: "artist not found"}
+	case errors.Is(err, errArtistExists):
+		return http.StatusConflict, apiError{Code: codeConflict, Message: "artist with this id or name already exists"}
+	case errors.Is(err, errUnknownArtist):
+		return http.StatusBadRequest, apiError{Code: codeValidation, Message: "album is invalid",
+			Details: []fieldError{{Field: "artist_id", Message: "is not the id of an artist"}}}
+	case errors.Is(err, errArtistMismatch):
+		return http.StatusBadRequest, apiError{Code: codeValidation, Message: "album is invalid",
+			Details: []fieldError{{Field: "artist", Message: "does not match the name of the artist with this artist_id"}}}
+	case errors.Is(err, errTrackNotFound):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: "track not found"}
+	case errors.Is(err, errTrackNumber):
+		return http.StatusBadRequest, apiError{Code: codeValidation, Message: "track is invalid",
+			Details: []fieldError{{Field: "number", Message: "must be at most one past the last track"}}}
+	case errors.Is(err, errCartNotFound):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: "cart not found"}
+	case errors.Is(err, errCheckedOut):
+		return http.StatusConflict, apiError{Code: codeConflict, Message: "cart has been checked out"}
+	case errors.Is(err, errTooMany):
+		return http.StatusBadRequest, apiError{Code: codeValidation, Message: "cartItem is invalid",
+			Details: []fieldError{{Field: "quantity", Message: "would take the cart past " + strconv.Itoa(maxQuantity) + " of this album"}}}
+	case errors.Is(err, errNotInCart):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: "album is not in the cart"}
+	case errors.Is(err, errEmptyCart):
+		return http.StatusBadRequest, apiError{Code: codeValidation, Message: "cart is invalid",
+			Details: []fieldError{{Field: "items", Message: "must not be empty"}}}
+	case errors.As(err, &unsellable):
+		return http.StatusConflict, apiError{Code: codeOutOfStock, Message: unsellable.Error(), Details: unsellable.problems}
+	case errors.Is(err, errOrderNotFound):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: "order not found"}
+	}
+	return http.StatusInternalServerError, apiError{Code: codeInternal, Message: err.Error()}
+}
+
+func describeTag(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		// The only use is an album's artist, which may be given by ID.
+		return "is required unless artist_id is given"
+	case "min":
+		return "must not be empty"
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "iso4217":
+		return "must be an ISO 4217 currency code"
+	}
+	return fmt.Sprintf("failed the %q check", fe.Tag())
+}
@@ -0,0 +1,156 @@
+package albumsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Before BoltAlbumStore, the "file" store kept albums in a file of JSON
+// lines at the same path: a header line followed by one record per change.
+//
+//	{"format":"albums","version":3}
+//	{"op":"artist","artist":{"id":"john-coltrane","name":"John Coltrane"}}
+//	{"op":"put","seq":1,"album":{"id":"1","title":"Blue Train",...}}
+//	{"op":"checkout","order":{"id":"01K...","cart_id":"01K...",...}}
+//	{"op":"delete","id":"1"}
+//
+// Files were written at schema versions 1 to 4. OpenBoltAlbumStore imports
+// such a file into a new database in its place, upgrading its albums
+// through albumMigrations, and keeps the file beside it as <path>.jsonl.
+
+const albumFileFormat = "albums"
+
+type fileHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type logRecord struct {
+	Op     string          `json:"op"` // "artist", "put", "checkout", "order" or "delete"
+	Seq    uint64          `json:"seq,omitempty"`
+	ID     string          `json:"id,omitempty"`
+	Album  json.RawMessage `json:"album,omitempty"`
+	Artist *artist         `json:"artist,omitempty"`
+	Order  *order          `json:"order,omitempty"`
+}
+
+// importAlbumFile replaces the album file at path, if that is what is
+// there, with a database holding the same albums. Anything else at path,
+// including nothing, is left alone.
+//
+// The database is built beside the file and renamed over it once it is
+// complete, so a crash leaves either the file, which is imported again on
+// the next start, or the database.
+func importAlbumFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return nil // a bbolt database starts with a binary page header
+	}
+
+	mem := NewAlbumStore(nil)
+	if err := loadAlbumFile(data, mem); err != nil {
+		return err
+	}
+
+	tmp := path + ".import"
+	os.Remove(tmp) // left by an import that crashed
+	db, err := bolt.Open(tmp, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	err = (&BoltAlbumStore{mem: mem, db: db}).rewrite()
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.WriteFile(path+".jsonl", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("importing the album file: %w", err)
+	}
+	// Sync the directory so the rename itself survives a crash.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	log.Printf("imported %d albums and %d orders from the album file %s; the file is kept as %s.jsonl",
+		len(mem.Entries()), len(mem.Orders()), path, path)
+	return nil
+}
+
+// loadAlbumFile replays an album file's records into mem.
+func loadAlbumFile(data []byte, mem *AlbumStore) error {
+	lines := bytes.Split(data, []byte("\n"))
+	var header fileHeader
+	if err := json.Unmarshal(lines[0], &header); err != nil || header.Format != albumFileFormat {
+		return errors.New("not an album store")
+	}
+	if header.Version < 1 || header.Version > albumSchemaVersion {
+		return fmt.Errorf("schema version %d is not supported; this build reads versions 1 to %d", header.Version, albumSchemaVersion)
+	}
+
+	for i, line := range lines[1:] {
+		if len(line) == 0 {
+			continue
+		}
+		var rec logRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if i == len(lines)-2 {
+				// The last write was interrupted before it was synced, so
+				// it was never acknowledged; drop it.
+				break
+			}
+			return fmt.Errorf("line %d: %w", i+2, err)
+		}
+		switch rec.Op {
+		case "artist":
+			if rec.Artist == nil {
+				return fmt.Errorf("line %d: artist record without an artist", i+2)
+			}
+			mem.restoreArtist(*rec.Artist)
+		case "put":
+			a, err := decodeAlbum(rec.Album, header.Version)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+2, err)
+			}
+			ar, err := mem.plan(&a)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+2, err)
+			}
+			if ar != nil {
+				mem.restoreArtist(*ar)
+			}
+			mem.restore(a, rec.Seq)
+		case "checkout", "order":
+			// A checkout takes its items out of stock; the file was
+			// compacted with "order" records, whose albums already had.
+			if rec.Order == nil {
+				return fmt.Errorf("line %d: %s record without an order", i+2, rec.Op)
+			}
+			mem.commitOrder(*rec.Order, rec.Op == "checkout")
+		case "delete":
+			mem.Delete(rec.ID)
+		default:
+			return fmt.Errorf("line %d: unknown op %q", i+2, rec.Op)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package albumsvc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	gqlvalidator "github.com/vektah/gqlparser/v2/validator"
+	"github.com/vektah/gqlparser/v2/validator/rules"
+)
+
+const (
+	maxGraphQLBytes = 1 << 20
+
+	// maxQueryComplexity bounds what one GraphQL request may cost (see
+	// queryCost). Fifty albums with their artists and tracks cost about
+	// 1,200.
+	maxQueryComplexity = 5000
+	// gqlListCost is how many items a list that isn't paged, such as an
+	// album's tracks, is assumed to have.
+	gqlListCost = 10
+)
+
+// catalogSchemaSDL is the schema /graphql serves. Prices, filters and
+// paging work as in the REST API: albums(currency: "EUR") compares and
+// shows prices in euros, minPrice and maxPrice are amounts in the query's
+// currency, sort takes the same keys as GET /albums?sort=, and nextCursor
+// is passed back as after to get the next page.
+const catalogSchemaSDL = `type Query {
+  albums(artist: String, artistId: ID, q: String, minPrice: Float, maxPrice: Float,
+    currency: String, sort: String, first: Int, after: String): AlbumPage!
+  album(id: ID!, currency: String): Album
+  artists: [Artist!]!
+  artist(id: ID!): Artist
+}
+
+type Mutation {
+  createAlbum(input: AlbumInput!): Album!
+  updateAlbum(id: ID!, input: AlbumPatch!): Album!
+  "Deletes an album and its cover, and returns its ID."
+  deleteAlbum(id: ID!): ID!
+}
+
+type AlbumPage {
+  items: [Album!]!
+  nextCursor: String
+}
+
+type Album {
+  id: ID!
+  title: String!
+  artistId: ID!
+  artist: Artist!
+  price: Money!
+  priceHistory: [PricePoint!]!
+  stock: Int!
+  tracks: [Track!]!
+  runtimeSeconds: Int!
+}
+
+type Artist {
+  id: ID!
+  name: String!
+  albums(q: String, minPrice: Float, maxPrice: Float, currency: String,
+    sort: String, first: Int, after: String): AlbumPage!
+}
+
+type Track {
+  number: Int!
+  title: String!
+  durationSeconds: Int!
+}
+
+"An amount in a currency's minor unit, such as cents."
+type Money {
+  amount: Int!
+  currency: String!
+}
+
+type PricePoint {
+  price: Money!
+  "When the price was set, in RFC 3339 format; null if before prices were tracked."
+  at: String
+}
+
+input AlbumInput {
+  id: ID
+  title: String!
+  artistId: ID
+  artist: String
+  price: MoneyInput!
+  stock: Int
+  tracks: [TrackInput!]
+}
+
+"Fields left out keep their current value."
+input AlbumPatch {
+  title: String
+  artistId: ID
+  artist: String
+  price: MoneyInput
+  stock: Int
+  tracks: [TrackInput!]
+}
+
+input MoneyInput {
+  amount: Int!
+  currency: String!
+}
+
+input TrackInput {
+  title: String!
+  durationSeconds: Int!
+}
+`
+
+// The schema is loaded twice: gqlparser validates a request and works out
+// what it costs before graphql-go runs it with the resolvers in
+// resolvers.go, which New binds to each service.
+var (
+	catalogSchema = gqlparser.MustLoadSchema(&ast.Source{Name: "catalog.graphql", Input: catalogSchemaSDL})
+	gqlRules      = rules.NewDefaultRules()
+)
+
+// gqlMultipliers give the number of objects paged fields may return. A
+// page's items are counted by the field that returns the page.
+var gqlMultipliers = map[string]func(args map[string]any) int{
+	"Query.albums":    pageSize,
+	"Artist.albums":   pageSize,
+	"AlbumPage.items": func(map[string]any) int { return 1 },
+}
+
+// pageSize is the most albums an albums field may return. A first outside
+// the allowed range fails when the field is resolved.
+func pageSize(args map[string]any) int {
+	if n, err := strconv.Atoi(fmt.Sprint(args["first"])); err == nil && n >= 1 && n <= maxPageSize {
+		return n
+	}
+	return defaultPageSize
+}
+
+// gqlRequest is a GraphQL request, as posted in JSON or sent as the
+// parameters of a GET.
+type gqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// postGraphQL runs a GraphQL request posted as JSON:
+//
+//	{"query": "...", "operationName": "...", "variables": {...}}
+//
+// Responses: 200 once the operation has run, even if some fields failed;
+// 400 if the request isn't valid or costs too much; 413 over 1 MiB.
+func (svc *service) postGraphQL(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxGraphQLBytes)
+	var req gqlRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithGQLError(c, http.StatusRequestEntityTooLarge, newGQLError(codeTooLarge, "request body must be at most 1 MiB"))
+			return
+		}
+		abortWithGQLError(c, http.StatusBadRequest, newGQLError(codeInvalidJSON, "request body is not valid JSON: "+err.Error()))
+		return
+	}
+	svc.runGraphQL(c, req, true)
+}
+
+// getGraphQL runs a query sent as the query, operationName and variables
+// parameters. Mutations must be posted.
+func (svc *service) getGraphQL(c *gin.Context) {
+	req := gqlRequest{Query: c.Query("query"), OperationName: c.Query("operationName")}
+	if raw := c.Query("variables"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+			abortWithGQLError(c, http.StatusBadRequest, newGQLError(codeInvalidJSON, "variables are not a valid JSON object: "+err.Error()))
+			return
+		}
+	}
+	svc.runGraphQL(c, req, false)
+}
+
+// getGraphQLSchema responds with the schema in GraphQL's schema language,
+// since /graphql doesn't answer introspection queries.
+func (svc *service) getGraphQLSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(catalogSchemaSDL))
+}
+
+// runGraphQL checks req against the schema and the complexity limit, then
+// runs it. Field errors are described as the REST API would describe them.
+func (svc *service) runGraphQL(c *gin.Context, req gqlRequest, allowMutation bool) {
+	if strings.TrimSpace(req.Query) == "" {
+		abortWithGQLError(c, http.StatusBadRequest, newGQLError(codeInvalidQuery, "Request has no query."))
+		return
+	}
+	doc, errs := gqlparser.LoadQueryWithRules(catalogSchema, req.Query, gqlRules)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			err.Extensions = map[string]any{"code": codeInvalidQuery}
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": errs})
+		return
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	switch {
+	case op == nil && req.OperationName == "":
+		abortWithGQLError(c, http.StatusBadRequest, newGQLError(codeInvalidQuery, "Must provide operation name if query contains multiple operations."))
+		return
+	case op == nil:
+		abortWithGQLError(c, http.StatusBadRequest, newGQLError(codeInvalidQuery, fmt.Sprintf("Unknown operation named %q.", req.OperationName)))
+		return
+	case op.Operation == ast.Mutation && !allowMutation:
+		c.Header("Allow", http.MethodPost)
+		abortWithGQLError(c, http.StatusMethodNotAllowed, newGQLError(codeMethodNotAllowed, "mutations must be sent with POST"))
+		return
+	}
+	vars, err := gqlvalidator.VariableValues(catalogSchema, op, req.Variables)
+	if err != nil {
+		invalid := newGQLError(codeInvalidQuery, err.Error())
+		var ge *gqlerror.Error
+		if errors.As(err, &ge) {
+			invalid.Message, invalid.Path = ge.Message, ge.Path
+		}
+		abortWithGQLError(c, http.StatusBadRequest, invalid)
+		return
+	}
+	if queryCost(op.SelectionSet, vars, maxQueryComplexity) > maxQueryComplexity {
+		tooComplex := newGQLError(codeTooComplex, fmt.Sprintf("Query costs more than the limit of %d.", maxQueryComplexity))
+		tooComplex.Locations = []gqlerror.Location{{Line: op.Position.Line, Column: op.Position.Column}}
+		abortWithGQLError(c, http.StatusBadRequest, tooComplex)
+		return
+	}
+
+	res := svc.graphql.Exec(c.Request.Context(), req.Query, req.OperationName, req.Variables)
+	for _, err := range res.Errors {
+		describeFieldError(err)
+	}
+	c.IndentedJSON(http.StatusOK, res)
+}
+
+// queryCost is what running sels costs: every field costs 1, and a field
+// with a selection adds that selection's cost once for each object it may
+// return. It stops adding up as soon as the cost passes budget.
+func queryCost(sels ast.SelectionSet, vars map[string]any, budget int) int {
+	cost := 0
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			cost++
+			if len(sel.SelectionSet) > 0 {
+				n := gqlMultiplier(sel, vars)
+				cost += n * queryCost(sel.SelectionSet, vars, (budget-cost)/n)
+			}
+		case *ast.InlineFragment:
+			cost += queryCost(sel.SelectionSet, vars, budget-cost)
+		case *ast.FragmentSpread:
+			cost += queryCost(sel.Definition.SelectionSet, vars, budget-cost)
+		}
+		if cost > budget {
+			return cost
+		}
+	}
+	return cost
+}
+
+// gqlMultiplier is how many objects a field may return: its page size if
+// it is paged, gqlListCost for other lists and otherwise 1.
+func gqlMultiplier(f *ast.Field, vars map[string]any) int {
+	if f.Definition == nil || f.ObjectDefinition == nil {
+		return 1
+	}
+	if m, ok := gqlMultipliers[f.ObjectDefinition.Name+"."+f.Name]; ok {
+		return max(1, m(f.ArgumentMap(vars)))
+	}
+	if f.Definition.Type.Elem != nil {
+		return gqlListCost
+	}
+	return 1
+}
+
+// newGQLError returns an error about the request as a whole, with one of
+// the codes the REST API uses.
+func newGQLError(code, message string) *gqlerror.Error {
+	return &gqlerror.Error{Message: message, Extensions: map[string]any{"code": code}}
+}
+
+// abortWithGQLError writes a response for a request that couldn't be run.
+func abortWithGQLError(c *gin.Context, status int, err *gqlerror.Error) {
+	c.AbortWithStatusJSON(status, gin.H{"errors": []*gqlerror.Error{err}})
+}
+
+// describeFieldError gives the error a resolver returned the message and
+// code a REST response would have, with field names in the schema's
+// camelCase.
+func describeFieldError(qe *gqlerrors.QueryError) {
+	err := qe.ResolverError
+	if err == nil {
+		return
+	}
+	var body apiError
+	var invalid validator.ValidationErrors
+	switch {
+	case errors.As(err, &body):
+	case errors.As(err, &invalid):
+		_, body = bindError(err)
+	default:
+		_, body = storeError(err)
+	}
+	qe.Message = body.Message
+	qe.Extensions = map[string]any{"code": body.Code}
+	if len(body.Details) > 0 {
+		details := make([]fieldError, len(body.Details))
+		for i, d := range body.Details {
+			details[i] = fieldError{Field: camelCase(d.Field), Message: d.Message}
+		}
+		qe.Extensions["details"] = details
+	}
+}
+
+// camelCase turns "tracks[0].duration_seconds" into
+// "tracks[0].durationSeconds".
+func camelCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range s {
+		switch {
+		case r == '_':
+			upper = true
+			continue
+		case upper:
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package albumsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2"
+)
+
+// gqlResult is a decoded /graphql response.
+type gqlResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code    string       `json:"code"`
+			Details []fieldError `json:"details"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router, err := New(Config{BlobDir: t.TempDir(), AccessLog: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// postQuery posts a GraphQL request and decodes the response, failing the
+// test unless it has the given status.
+func postQuery(t *testing.T, router http.Handler, status int, query string, vars map[string]any) gqlResult {
+	t.Helper()
+	body, _ := json.Marshal(gqlRequest{Query: query, Variables: vars})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	var res gqlResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// Compact the data so tests can compare it as a string.
+	var data bytes.Buffer
+	if len(res.Data) > 0 {
+		if err := json.Compact(&data, res.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res.Data = data.Bytes()
+	return res
+}
+
+func TestGraphQLQueryAlbums(t *testing.T) {
+	router := newTestRouter(t)
+	res := postQuery(t, router, http.StatusOK, `{
+  albums(first: 2, sort: "price") {
+    items { id price { amount currency } artist { name } tracks { number } }
+    nextCursor
+  }
+}`, nil)
+	if len(res.Errors) > 0 {
+		t.Fatalf("errors: %+v", res.Errors)
+	}
+	var data struct {
+		Albums struct {
+			Items []struct {
+				ID     string
+				Price  money
+				Artist artist
+			}
+			NextCursor *string
+		}
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	page := data.Albums
+	if len(page.Items) != 2 || page.Items[0].ID != "2" || page.Items[1].ID != "3" {
+		t.Fatalf("items = %+v, want albums 2 and 3", page.Items)
+	}
+	if page.Items[0].Price != (money{1799, "USD"}) || page.Items[0].Artist.Name != "Gerry Mulligan" {
+		t.Errorf("first item = %+v", page.Items[0])
+	}
+	if page.NextCursor == nil {
+		t.Fatal("no nextCursor with one album left")
+	}
+
+	res = postQuery(t, router, http.StatusOK, `query($after: String) { albums(sort: "price", after: $after) { items { id } nextCursor } }`,
+		map[string]any{"after": *page.NextCursor})
+	if string(res.Data) != `{"albums":{"items":[{"id":"1"}],"nextCursor":null}}` {
+		t.Errorf("second page = %s", res.Data)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	router := newTestRouter(t)
+
+	res := postQuery(t, router, http.StatusOK, `mutation($in: AlbumInput!) {
+  createAlbum(input: $in) { id artistId runtimeSeconds tracks { number } }
+}`, map[string]any{"in": map[string]any{
+		"title":  "Pastel Blues",
+		"artist": "Nina Simone",
+		"price":  map[string]any{"amount": 1500, "currency": "USD"},
+		"tracks": []any{
+			map[string]any{"title": "Be My Husband", "durationSeconds": 180},
+			map[string]any{"title": "Sinnerman", "durationSeconds": 622},
+		},
+	}})
+	want := `{"createAlbum":{"id":"4","artistId":"nina-simone","runtimeSeconds":802,"tracks":[{"number":1},{"number":2}]}}`
+	if len(res.Errors) > 0 || string(res.Data) != want {
+		t.Fatalf("createAlbum = %s %+v, want %s", res.Data, res.Errors, want)
+	}
+
+	res = postQuery(t, router, http.StatusOK, `mutation { updateAlbum(id: "4", input: {stock: 3}) { stock title } }`, nil)
+	if string(res.Data) != `{"updateAlbum":{"stock":3,"title":"Pastel Blues"}}` {
+		t.Errorf("updateAlbum = %s %+v", res.Data, res.Errors)
+	}
+
+	res = postQuery(t, router, http.StatusOK, `mutation { deleteAlbum(id: "4") }`, nil)
+	if string(res.Data) != `{"deleteAlbum":"4"}` {
+		t.Errorf("deleteAlbum = %s %+v", res.Data, res.Errors)
+	}
+	res = postQuery(t, router, http.StatusOK, `{ album(id: "4") { id } }`, nil)
+	if string(res.Data) != `{"album":null}` {
+		t.Errorf("album after deleting it = %s", res.Data)
+	}
+}
+
+func TestGraphQLFieldErrors(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name    string
+		query   string
+		code    string
+		details []fieldError
+	}{
+		{
+			name: "invalid input",
+			query: `mutation { createAlbum(input: {title: "X", artist: "Y", price: {amount: -1, currency: "USD"},
+  tracks: [{title: "t", durationSeconds: 0}]}) { id } }`,
+			code: codeValidation,
+			details: []fieldError{
+				{Field: "price.amount", Message: "must be at least 0"},
+				{Field: "tracks[0].durationSeconds", Message: "is required"},
+			},
+		},
+		{
+			name:  "unknown album",
+			query: `mutation { updateAlbum(id: "nope", input: {stock: 1}) { id } }`,
+			code:  codeNotFound,
+		},
+		{
+			name:    "bad argument",
+			query:   `{ albums(first: 0) { items { id } } }`,
+			code:    codeValidation,
+			details: []fieldError{{Field: "first", Message: "must be between 1 and 1000"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := postQuery(t, router, http.StatusOK, tt.query, nil)
+			if len(res.Errors) != 1 {
+				t.Fatalf("errors = %+v, want one", res.Errors)
+			}
+			ext := res.Errors[0].Extensions
+			if ext.Code != tt.code {
+				t.Errorf("code = %s, want %s", ext.Code, tt.code)
+			}
+			if len(ext.Details) != len(tt.details) {
+				t.Fatalf("details = %+v, want %+v", ext.Details, tt.details)
+			}
+			for i := range tt.details {
+				if ext.Details[i] != tt.details[i] {
+					t.Errorf("details[%d] = %+v, want %+v", i, ext.Details[i], tt.details[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGraphQLRejectedRequests(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		vars   map[string]any
+		status int
+		code   string
+	}{
+		{"empty", " ", nil, http.StatusBadRequest, codeInvalidQuery},
+		{"unknown field", `{ nope }`, nil, http.StatusBadRequest, codeInvalidQuery},
+		{"syntax error", `{ albums {`, nil, http.StatusBadRequest, codeInvalidQuery},
+		{"missing variable", `query($n: Int!) { albums(first: $n) { items { id } } }`, nil, http.StatusBadRequest, codeInvalidQuery},
+		{"unnamed operation", `query A { artists { id } } query B { artists { name } }`, nil, http.StatusBadRequest, codeInvalidQuery},
+		{"too complex", `{ albums(first: 100) { items { artist { albums(first: 100) { items { id } } } } } }`,
+			nil, http.StatusBadRequest, codeTooComplex},
+		{"too complex through a variable", `query($n: Int) { albums(first: $n) { items { artist { albums(first: $n) { items { id } } } } } }`,
+			map[string]any{"n": 100}, http.StatusBadRequest, codeTooComplex},
+		{"too complex through fragments", `{ albums(first: 1000) { ...Page } } fragment Page on AlbumPage { items { ...Tracks } }
+fragment Tracks on Album { tracks { title } }`, nil, http.StatusBadRequest, codeTooComplex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := postQuery(t, router, tt.status, tt.query, tt.vars)
+			if len(res.Errors) != 1 || res.Errors[0].Extensions.Code != tt.code {
+				t.Errorf("errors = %+v, want one with code %s", res.Errors, tt.code)
+			}
+		})
+	}
+
+	// Mutations may only be posted.
+	w := httptest.NewRecorder()
+	q := url.Values{"query": {`mutation { deleteAlbum(id: "1") }`}}
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/graphql?"+q.Encode(), nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET mutation: status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+	res := postQuery(t, router, http.StatusOK, `{ album(id: "1") { id } }`, nil)
+	if string(res.Data) != `{"album":{"id":"1"}}` {
+		t.Errorf("album 1 after a GET mutation = %s", res.Data)
+	}
+}
+
+func TestQueryCost(t *testing.T) {
+	tests := []struct {
+		query string
+		vars  map[string]any
+		cost  int
+	}{
+		{`{ artists { id } }`, nil, 1 + gqlListCost*1},
+		{`{ albums(first: 2) { items { id } nextCursor } }`, nil, 1 + 2*(1+1+1)},
+		{`{ albums { items { id } } }`, nil, 1 + defaultPageSize*(1+1)},
+		{`query($n: Int) { albums(first: $n) { items { id } } }`, map[string]any{"n": 5}, 1 + 5*(1+1)},
+		{`{ album(id: "1") { tracks { title number } } }`, nil, 1 + 1 + gqlListCost*2},
+		{`{ album(id: "1") { ...F } } fragment F on Album { id title }`, nil, 1 + 2},
+		{`{ album(id: "1") { ... on Album { id } } }`, nil, 1 + 1},
+	}
+	for _, tt := range tests {
+		doc, errs := gqlparser.LoadQueryWithRules(catalogSchema, tt.query, gqlRules)
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", tt.query, errs)
+		}
+		if got := queryCost(doc.Operations[0].SelectionSet, tt.vars, 1<<30); got != tt.cost {
+			t.Errorf("cost of %s = %d, want %d", tt.query, got, tt.cost)
+		}
+	}
+
+	// Counting stops once the budget is spent.
+	doc, _ := gqlparser.LoadQueryWithRules(catalogSchema, `{ albums(first: 1000) { items { tracks { title } } } }`, gqlRules)
+	if got := queryCost(doc.Operations[0].SelectionSet, nil, 10); got <= 10 {
+		t.Errorf("cost over a budget of 10 = %d, want more than 10", got)
+	}
+}
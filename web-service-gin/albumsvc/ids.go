@@ -0,0 +1,70 @@
+package albumsvc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// idGenerator returns a new album ID on every call. The store skips IDs
+// that are already taken, so a generator needn't check for them.
+type idGenerator func() string
+
+// newIDGenerator returns the generator for a scheme named in Config.IDScheme:
+//
+//	seq   1, 2, 3, ... (the default, matching the seed albums), counting
+//	      on from the highest numeric ID among the existing albums
+//	uuid  random RFC 9562 version 4 UUIDs
+//	ulid  ULIDs, which sort by creation time
+func newIDGenerator(scheme string, existing []albumEntry) (idGenerator, error) {
+	switch scheme {
+	case "", "seq":
+		var n atomic.Uint64
+		for _, e := range existing {
+			if id, err := strconv.ParseUint(e.ID, 10, 64); err == nil && id > n.Load() {
+				n.Store(id)
+			}
+		}
+		return func() string { return strconv.FormatUint(n.Add(1), 10) }, nil
+	case "uuid":
+		return newUUID, nil
+	case "ulid":
+		return newULID, nil
+	}
+	return nil, fmt.Errorf("album ID scheme %q is not one of seq, uuid, ulid", scheme)
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// crockford is the base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a 48-bit millisecond timestamp followed by 80 random
+// bits, as 26 Crockford base32 characters.
+func newULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	// 128 bits in 26 characters: the first holds the top 3 bits, each of
+	// the rest the next 5.
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,187 @@
+package albumsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// money is an amount in a currency's minor unit, such as cents, so sums
+// and comparisons are exact.
+type money struct {
+	Amount   int64  `json:"amount" binding:"gte=0"`
+	Currency string `json:"currency" binding:"required,iso4217"`
+}
+
+// UnmarshalJSON also accepts a bare number, read as US dollars, which is
+// how prices were sent before they had a currency.
+func (m *money) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && (data[0] == '-' || data[0] >= '0' && data[0] <= '9') {
+		var dollars float64
+		if err := json.Unmarshal(data, &dollars); err != nil {
+			return err
+		}
+		*m = money{Amount: int64(math.Round(dollars * 100)), Currency: "USD"}
+		return nil
+	}
+	type plain money
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// pricePoint is one entry of an album's price history. At is zero for
+// prices set before history was kept.
+type pricePoint struct {
+	Price money     `json:"price"`
+	At    time.Time `json:"at,omitzero"`
+}
+
+// notePrice carries an album's price history over from old, the album it
+// replaces (nil for a new one), and adds a's price if it changed.
+func notePrice(a *album, old *album, now time.Time) {
+	var history []pricePoint
+	if old != nil {
+		history = old.History
+	}
+	if len(history) == 0 || history[len(history)-1].Price != a.Price {
+		// Clip so the append never writes into old's array, which readers
+		// may hold.
+		history = append(slices.Clip(history), pricePoint{Price: a.Price, At: now.UTC()})
+	}
+	a.History = history
+}
+
+// getPriceHistory responds with every price an album has had, oldest first.
+func (svc *service) getPriceHistory(c *gin.Context) {
+	a, ok := svc.albums.Get(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, a.History)
+}
+
+// minorDigits returns how many decimal places a currency's minor unit has:
+// 2 for most, 0 for the yen, 3 for the Bahraini dinar.
+func minorDigits(currency string) int {
+	switch currency {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG", "RWF",
+		"UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3
+	case "CLF", "UYW":
+		return 4
+	}
+	return 2
+}
+
+// exchangeRates holds how much of each currency one unit of Base buys.
+type exchangeRates struct {
+	Base  string
+	Date  string // the day the rates are from, as given in the file
+	rates map[string]*big.Rat
+}
+
+// noRates returns a table that converts only between USD and itself.
+func noRates() *exchangeRates {
+	return &exchangeRates{Base: "USD", rates: map[string]*big.Rat{"USD": big.NewRat(1, 1)}}
+}
+
+// loadRates reads a rate table like
+//
+//	{"base": "USD", "date": "2026-10-01", "rates": {"EUR": 0.9215, "JPY": 149.62}}
+//
+// Rates are read as exact decimals, not floats.
+func loadRates(path string) (*exchangeRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Base  string                 `json:"base"`
+		Date  string                 `json:"date"`
+		Rates map[string]json.Number `json:"rates"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.Base == "" {
+		return nil, fmt.Errorf("%s: no base currency", path)
+	}
+	r := &exchangeRates{Base: file.Base, Date: file.Date, rates: map[string]*big.Rat{file.Base: big.NewRat(1, 1)}}
+	for code, n := range file.Rates {
+		rate, ok := new(big.Rat).SetString(n.String())
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("%s: rate for %s must be a positive number", path, code)
+		}
+		r.rates[code] = rate
+	}
+	return r, nil
+}
+
+// has reports whether prices can be converted to and from currency.
+func (r *exchangeRates) has(currency string) bool {
+	_, ok := r.rates[currency]
+	return ok
+}
+
+// convert returns m in another currency, rounded half away from zero to
+// the nearest minor unit. It reports false if either currency has no rate.
+func (r *exchangeRates) convert(m money, to string) (money, bool) {
+	if m.Currency == to {
+		return m, true
+	}
+	from, ok1 := r.rates[m.Currency]
+	into, ok2 := r.rates[to]
+	if !ok1 || !ok2 {
+		return money{}, false
+	}
+	// amount / 10^fromDigits / from * into * 10^toDigits
+	x := new(big.Rat).SetInt64(m.Amount)
+	x.Mul(x, into)
+	x.Quo(x, from)
+	x.Mul(x, pow10Rat(minorDigits(to)-minorDigits(m.Currency)))
+	return money{Amount: roundRat(x), Currency: to}, true
+}
+
+// parseAmount reads a decimal amount such as "19.99" in a currency's
+// minor units, rounding extra decimal places.
+func parseAmount(s, currency string) (int64, error) {
+	x, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, errors.New("not a number")
+	}
+	return roundRat(x.Mul(x, pow10Rat(minorDigits(currency)))), nil
+}
+
+func pow10Rat(n int) *big.Rat {
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(n, -n))), nil)
+	if n < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
+// roundRat rounds x half away from zero.
+func roundRat(x *big.Rat) int64 {
+	num, den := new(big.Int).Abs(x.Num()), x.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
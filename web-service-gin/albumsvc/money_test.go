@@ -0,0 +1,146 @@
+package albumsvc
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeRates writes a rate table to a temporary file and returns its path.
+func writeRates(t *testing.T, table string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testRates = `{"base": "USD", "date": "2026-10-01",
+	"rates": {"EUR": 0.92, "JPY": 149.5, "BHD": 0.376, "CHF": 0.5}}`
+
+func TestConvertRoundsHalfAwayFromZero(t *testing.T) {
+	rates, err := loadRates(writeRates(t, testRates))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from money
+		to   string
+		want int64
+	}{
+		{money{5699, "USD"}, "USD", 5699},
+		{money{5699, "USD"}, "EUR", 5243},   // 52.4308
+		{money{100, "USD"}, "JPY", 150},     // 149.5
+		{money{1, "USD"}, "JPY", 1},         // 1.495
+		{money{50, "USD"}, "BHD", 188},      // three decimal places
+		{money{1, "USD"}, "CHF", 1},         // 0.005
+		{money{3, "USD"}, "CHF", 2},         // 0.015
+		{money{1000, "EUR"}, "JPY", 1625},   // through the base
+		{money{1625, "JPY"}, "EUR", 1000},   // and back
+		{money{150, "JPY"}, "USD", 100},     // 1.0033...
+		{money{188, "BHD"}, "USD", 50},      // 0.5
+		{money{0, "EUR"}, "JPY", 0},         // nothing
+		{money{12345, "CHF"}, "CHF", 12345}, // same currency, untouched
+	}
+	for _, tt := range tests {
+		got, ok := rates.convert(tt.from, tt.to)
+		if !ok || got != (money{tt.want, tt.to}) {
+			t.Errorf("convert(%v, %s) = %v, %v, want %d %s", tt.from, tt.to, got, ok, tt.want, tt.to)
+		}
+	}
+	if _, ok := rates.convert(money{100, "USD"}, "GBP"); ok {
+		t.Error("converted to GBP, which has no rate")
+	}
+	if _, ok := rates.convert(money{100, "GBP"}, "USD"); ok {
+		t.Error("converted from GBP, which has no rate")
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s, currency string
+		want        int64
+	}{
+		{"19.99", "USD", 1999},
+		{"19.995", "USD", 2000},
+		{"19.994", "USD", 1999},
+		{"20", "USD", 2000},
+		{"149.5", "JPY", 150},
+		{"0.0005", "BHD", 1},
+	}
+	for _, tt := range tests {
+		if got, err := parseAmount(tt.s, tt.currency); err != nil || got != tt.want {
+			t.Errorf("parseAmount(%q, %s) = %d, %v, want %d", tt.s, tt.currency, got, err, tt.want)
+		}
+	}
+	if _, err := parseAmount("ten", "USD"); err == nil {
+		t.Error("parseAmount accepted ten")
+	}
+}
+
+func TestLoadRatesRejectsBadTables(t *testing.T) {
+	for _, table := range []string{
+		`{"rates": {"EUR": 0.92}}`,
+		`{"base": "USD", "rates": {"EUR": 0}}`,
+		`{"base": "USD", "rates": {"EUR": -1}}`,
+		`{"base": "USD", "rates": {"EUR": "x"}}`,
+	} {
+		if _, err := loadRates(writeRates(t, table)); err == nil {
+			t.Errorf("loadRates accepted %s", table)
+		}
+	}
+}
+
+func TestPricesInOtherCurrencies(t *testing.T) {
+	router := newTestRouterWithRates(t, testRates)
+
+	a := decode[album](t, serve(t, router, "GET", "/albums/1?currency=JPY", "", http.StatusOK))
+	if a.Price != (money{8520, "JPY"}) { // 8520.005
+		t.Errorf("album 1 in JPY = %v, want 8520 JPY", a.Price)
+	}
+	w := serve(t, router, "GET", "/albums/1?currency=GBP", "", http.StatusBadRequest)
+	if got := decode[errorBody](t, w).Error.Details; len(got) != 1 || got[0].Field != "currency" {
+		t.Errorf("GBP: details %+v, want one about currency", got)
+	}
+
+	// Filters compare prices in the requested currency: album 2 is
+	// 17.99 USD, 16.5508 EUR.
+	var ids []string
+	for _, a := range decode[[]album](t, serve(t, router, "GET", "/albums?currency=EUR&min_price=16.55&max_price=16.55", "", http.StatusOK)) {
+		ids = append(ids, a.ID)
+		if a.Price.Currency != "EUR" {
+			t.Errorf("album %s listed in %s, want EUR", a.ID, a.Price.Currency)
+		}
+	}
+	if !slices.Equal(ids, []string{"2"}) {
+		t.Errorf("albums at 16.55 EUR = %v, want [2]", ids)
+	}
+
+	// Carts round the unit price, then multiply, so line totals add up
+	// to what a customer could check on a receipt.
+	cart := decode[cartView](t, serve(t, router, "POST", "/carts", `{"currency":"EUR"}`, http.StatusCreated))
+	serve(t, router, "PUT", "/carts/"+cart.ID+"/items/2", `{"quantity":3}`, http.StatusOK)
+	serve(t, router, "PUT", "/carts/"+cart.ID+"/items/1", `{"quantity":1}`, http.StatusOK)
+	o := decode[order](t, serve(t, router, "POST", "/carts/"+cart.ID+"/checkout", "", http.StatusCreated))
+	want := []lineItem{
+		{AlbumID: "2", Title: "Jeru", Quantity: 3, UnitPrice: money{1655, "EUR"}, LineTotal: money{4965, "EUR"}},
+		{AlbumID: "1", Title: "Blue Train", Quantity: 1, UnitPrice: money{5243, "EUR"}, LineTotal: money{5243, "EUR"}},
+	}
+	if !slices.Equal(o.Lines, want) || o.Total != (money{4965 + 5243, "EUR"}) {
+		t.Errorf("order = %+v, total %v; want %+v totalling 102.08 EUR", o.Lines, o.Total, want)
+	}
+
+	serve(t, router, "POST", "/carts", `{"currency":"GBP"}`, http.StatusBadRequest)
+}
+
+func newTestRouterWithRates(t *testing.T, table string) http.Handler {
+	t.Helper()
+	router, err := New(Config{BlobDir: t.TempDir(), RatesFile: writeRates(t, table), AccessLog: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
@@ -0,0 +1,136 @@
+package albumsvc
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errOrderNotFound is returned when no order has the requested ID.
+	errOrderNotFound = errors.New("order not found")
+	// errEmptyCart is returned when checking out a cart with no items.
+	errEmptyCart = errors.New("cart is empty")
+)
+
+// order is a checked-out cart. Its prices are the ones the albums had at
+// checkout, whatever they cost now.
+type order struct {
+	ID        string     `json:"id"`
+	CartID    string     `json:"cart_id"`
+	Lines     []lineItem `json:"lines"`
+	Total     money      `json:"total"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// lineItem is a quantity of one album at its unit price.
+type lineItem struct {
+	AlbumID   string `json:"album_id"`
+	Title     string `json:"title"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice money  `json:"unit_price"`
+	LineTotal money  `json:"line_total"`
+}
+
+// checkoutError lists the items that kept a cart from being checked out.
+type checkoutError struct {
+	problems []fieldError
+}
+
+func (e *checkoutError) Error() string {
+	return "cart cannot be checked out"
+}
+
+// priceItems prices a cart's items at the albums' current prices in the
+// given currency, converting with rates. Items that couldn't be bought as
+// they are, because the album is gone, short of stock, priced in a
+// currency with no exchange rate or too expensive to total, are reported
+// as problems and left out of the total.
+func priceItems(items []cartItem, currency string, rates *exchangeRates, lookup func(id string) (album, bool)) ([]lineItem, money, []fieldError) {
+	lines := make([]lineItem, 0, len(items))
+	total := money{Currency: currency}
+	var problems []fieldError
+	for i, item := range items {
+		line := lineItem{AlbumID: item.AlbumID, Quantity: item.Quantity}
+		field := "items[" + strconv.Itoa(i) + "]"
+		a, ok := lookup(item.AlbumID)
+		if !ok {
+			problems = append(problems, fieldError{Field: field + ".album_id", Message: "album no longer exists"})
+			lines = append(lines, line)
+			continue
+		}
+		line.Title = a.Title
+		unit, ok := rates.convert(a.Price, currency)
+		if !ok {
+			problems = append(problems, fieldError{Field: field, Message: "no exchange rate from " + a.Price.Currency + " to " + currency})
+			lines = append(lines, line)
+			continue
+		}
+		line.UnitPrice = unit
+		amount, ok := mulAmount(unit.Amount, item.Quantity)
+		if !ok {
+			problems = append(problems, fieldError{Field: field, Message: "line total is too large"})
+			lines = append(lines, line)
+			continue
+		}
+		line.LineTotal = money{Amount: amount, Currency: currency}
+		lines = append(lines, line)
+		if item.Quantity > a.Stock {
+			problems = append(problems, fieldError{Field: field + ".quantity", Message: "only " + strconv.Itoa(a.Stock) + " in stock"})
+			continue
+		}
+		if total.Amount > math.MaxInt64-amount {
+			problems = append(problems, fieldError{Field: field, Message: "order total is too large"})
+			continue
+		}
+		total.Amount += amount
+	}
+	return lines, total, problems
+}
+
+// mulAmount returns amount * quantity, reporting false if it overflows.
+// Amounts are never negative.
+func mulAmount(amount int64, quantity int) (int64, bool) {
+	if quantity != 0 && amount > math.MaxInt64/int64(quantity) {
+		return 0, false
+	}
+	return amount * int64(quantity), true
+}
+
+// buildOrder prices c as an order, failing if any item can't be bought.
+// Carts normally hold only quantities their handlers accepted, but c is
+// checked again so that no order sells a negative or absurd quantity.
+func buildOrder(c cart, id string, now time.Time, rates *exchangeRates, lookup func(id string) (album, bool)) (order, error) {
+	if len(c.Items) == 0 {
+		return order{}, errEmptyCart
+	}
+	var invalid []fieldError
+	for i, item := range c.Items {
+		if item.Quantity <= 0 || item.Quantity > maxQuantity {
+			invalid = append(invalid, fieldError{Field: "items[" + strconv.Itoa(i) + "].quantity",
+				Message: "must be between 1 and " + strconv.Itoa(maxQuantity)})
+		}
+	}
+	if len(invalid) > 0 {
+		return order{}, &checkoutError{problems: invalid}
+	}
+	lines, total, problems := priceItems(c.Items, c.Currency, rates, lookup)
+	if len(problems) > 0 {
+		return order{}, &checkoutError{problems: problems}
+	}
+	return order{ID: id, CartID: c.ID, Lines: lines, Total: total, CreatedAt: now.UTC()}, nil
+}
+
+// getOrder responds with the order whose ID matches the id parameter.
+func (svc *service) getOrder(c *gin.Context) {
+	o, ok := svc.albums.Order(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errOrderNotFound)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, o)
+}
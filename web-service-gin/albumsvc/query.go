@@ -0,0 +1,316 @@
+package albumsvc
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// albumQuery is a parsed GET /albums query string.
+type albumQuery struct {
+	artistID string // set by routes scoped to one artist
+	artist   string // exact match, ignoring case
+	q        string // substring of title or artist, ignoring case
+	minPrice *int64 // in currency's minor units
+	maxPrice *int64
+	sort     []sortKey
+	sortSpec string // sort as given, so a cursor can be checked against it
+	limit    int
+	after    *cursor
+
+	// currency is what prices are compared in, and shown in if convert is
+	// set. Albums whose price can't be converted match no price range and
+	// sort after all others.
+	currency string
+	convert  bool
+	rates    *exchangeRates
+}
+
+// sortKey orders albums by one field.
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// cursor marks the last album of a page. Pages continue with the albums
+// that sort after it, so albums added or removed between requests never
+// make a page skip or repeat one that was already there.
+type cursor struct {
+	Sort     string `json:"s"`
+	Currency string `json:"c"`
+	Values   []any  `json:"v"` // the last album's value for each sort key
+	Seq      uint64 `json:"q"` // tiebreaker: position in the store
+}
+
+// albumRow is an album with its price in the query's currency.
+type albumRow struct {
+	albumEntry
+	price  int64
+	priced bool // false if the price couldn't be converted
+}
+
+// sortFields are the fields sort= accepts.
+var sortFields = []string{"id", "title", "artist", "price"}
+
+// queryParams looks up a query parameter, like gin.Context.GetQuery.
+type queryParams func(name string) (string, bool)
+
+// get returns the parameter, or "" if it isn't given.
+func (p queryParams) get(name string) string {
+	v, _ := p(name)
+	return v
+}
+
+// parseAlbumQuery reads the filter, sort and paging parameters. Every bad
+// parameter is reported, not just the first. Prices are converted with
+// rates.
+func parseAlbumQuery(params queryParams, rates *exchangeRates) (albumQuery, []fieldError) {
+	q := albumQuery{
+		rates:    rates,
+		artist:   params.get("artist"),
+		q:        strings.ToLower(params.get("q")),
+		sortSpec: params.get("sort"),
+		limit:    defaultPageSize,
+		currency: "USD",
+	}
+	var problems []fieldError
+
+	currency, problem := parseCurrency(params, rates)
+	if problem != nil {
+		problems = append(problems, *problem)
+	} else if currency != "" {
+		q.currency, q.convert = currency, true
+	}
+
+	for _, name := range []string{"min_price", "max_price"} {
+		raw, ok := params(name)
+		if !ok {
+			continue
+		}
+		v, err := parseAmount(raw, q.currency)
+		if err != nil || v < 0 {
+			problems = append(problems, fieldError{Field: name, Message: "must be a non-negative amount in " + q.currency})
+			continue
+		}
+		if name == "min_price" {
+			q.minPrice = &v
+		} else {
+			q.maxPrice = &v
+		}
+	}
+
+	if q.sortSpec != "" {
+		for _, part := range strings.Split(q.sortSpec, ",") {
+			key := sortKey{field: strings.TrimPrefix(part, "-"), desc: strings.HasPrefix(part, "-")}
+			if !slices.Contains(sortFields, key.field) {
+				problems = append(problems, fieldError{Field: "sort", Message: "must be a comma-separated list of " + strings.Join(sortFields, ", ") + ", each optionally prefixed with -"})
+				break
+			}
+			q.sort = append(q.sort, key)
+		}
+	}
+
+	if raw, ok := params("limit"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageSize {
+			problems = append(problems, fieldError{Field: "limit", Message: "must be between 1 and " + strconv.Itoa(maxPageSize)})
+		} else {
+			q.limit = n
+		}
+	}
+
+	if raw := params.get("cursor"); raw != "" {
+		cur, err := decodeCursor(raw)
+		switch {
+		case err != nil:
+			problems = append(problems, fieldError{Field: "cursor", Message: "is not a cursor returned by this API"})
+		case cur.Sort != q.sortSpec || cur.Currency != q.currency || len(cur.Values) != len(q.sort):
+			problems = append(problems, fieldError{Field: "cursor", Message: "was issued for a different sort or currency"})
+		default:
+			q.after = cur
+		}
+	}
+	return q, problems
+}
+
+// parseCurrency reads the currency parameter, which is empty if not given
+// and must be one rates can convert to.
+func parseCurrency(params queryParams, rates *exchangeRates) (string, *fieldError) {
+	currency := params.get("currency")
+	if currency != "" && !rates.has(currency) {
+		return "", &fieldError{Field: "currency", Message: "has no exchange rate"}
+	}
+	return currency, nil
+}
+
+// run filters and sorts the entries and returns one page, plus the cursor
+// for the next page if there is one.
+func (q albumQuery) run(entries []albumEntry) ([]album, *cursor) {
+	matched := make([]albumRow, 0, len(entries))
+	for _, e := range entries {
+		r := albumRow{albumEntry: e}
+		if price, ok := q.rates.convert(e.Price, q.currency); ok {
+			r.price, r.priced = price.Amount, true
+			if q.convert {
+				r.Price = price
+			}
+		}
+		if q.matches(r) {
+			matched = append(matched, r)
+		}
+	}
+	slices.SortStableFunc(matched, q.compare)
+
+	start := 0
+	if q.after != nil {
+		start, _ = slices.BinarySearchFunc(matched, *q.after, func(r albumRow, cur cursor) int {
+			return q.compare(r, q.cursorRow(cur))
+		})
+		// Skip the cursor's own album if it still exists.
+		if start < len(matched) && matched[start].seq == q.after.Seq {
+			start++
+		}
+	}
+
+	end := min(start+q.limit, len(matched))
+	page := make([]album, 0, end-start)
+	for _, r := range matched[start:end] {
+		page = append(page, r.album)
+	}
+	if end == len(matched) {
+		return page, nil
+	}
+	last := matched[end-1]
+	next := &cursor{Sort: q.sortSpec, Currency: q.currency, Seq: last.seq}
+	for _, k := range q.sort {
+		next.Values = append(next.Values, fieldValue(last, k.field))
+	}
+	return page, next
+}
+
+func (q albumQuery) matches(r albumRow) bool {
+	if q.artistID != "" && r.ArtistID != q.artistID {
+		return false
+	}
+	if q.artist != "" && !strings.EqualFold(r.Artist, q.artist) {
+		return false
+	}
+	if q.q != "" && !strings.Contains(strings.ToLower(r.Title), q.q) && !strings.Contains(strings.ToLower(r.Artist), q.q) {
+		return false
+	}
+	if (q.minPrice != nil || q.maxPrice != nil) && !r.priced {
+		return false
+	}
+	if q.minPrice != nil && r.price < *q.minPrice {
+		return false
+	}
+	if q.maxPrice != nil && r.price > *q.maxPrice {
+		return false
+	}
+	return true
+}
+
+// compare orders rows by the sort keys, then by position in the store, so
+// the order is total and the same on every request.
+func (q albumQuery) compare(x, y albumRow) int {
+	for _, k := range q.sort {
+		var c int
+		if k.field == "price" {
+			c = cmp.Or(compareBool(y.priced, x.priced), cmp.Compare(x.price, y.price))
+		} else {
+			c = strings.Compare(fieldValue(x, k.field).(string), fieldValue(y, k.field).(string))
+		}
+		if k.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(x.seq, y.seq)
+}
+
+// cursorRow rebuilds the sort fields of the row a cursor points at.
+func (q albumQuery) cursorRow(cur cursor) albumRow {
+	r := albumRow{albumEntry: albumEntry{seq: cur.Seq}}
+	for i, k := range q.sort {
+		switch v := cur.Values[i].(type) {
+		case float64:
+			if k.field == "price" {
+				r.price, r.priced = int64(v), true
+			}
+		case string:
+			switch k.field {
+			case "id":
+				r.ID = v
+			case "title":
+				r.Title = v
+			case "artist":
+				r.Artist = v
+			}
+		}
+	}
+	return r
+}
+
+// fieldValue is a row's value for a sort field, as stored in a cursor. An
+// unconvertible price is nil.
+func fieldValue(r albumRow, field string) any {
+	switch field {
+	case "id":
+		return r.ID
+	case "title":
+		return r.Title
+	case "artist":
+		return r.Artist
+	}
+	if !r.priced {
+		return nil
+	}
+	return r.price
+}
+
+// compareBool orders false before true.
+func compareBool(x, y bool) int {
+	switch {
+	case x == y:
+		return 0
+	case !x:
+		return -1
+	}
+	return 1
+}
+
+func (cur *cursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cur cursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+// nextLink is the Link header value pointing at the page after cur, with
+// every other query parameter kept.
+func nextLink(u *url.URL, cur *cursor) string {
+	query := u.Query()
+	query.Set("cursor", cur.encode())
+	return "<" + u.Path + "?" + query.Encode() + `>; rel="next"`
+}
@@ -0,0 +1,92 @@
+package albumsvc
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// linkPattern matches the Link header of a page with a next one.
+var linkPattern = regexp.MustCompile(`^<(/[^>]*)>; rel="next"$`)
+
+// nextPage returns the IDs of the albums on the page at path and the path
+// of the page after it, or "" if it is the last.
+func nextPage(t *testing.T, router http.Handler, path string) (ids []string, next string) {
+	t.Helper()
+	w := serve(t, router, "GET", path, "", http.StatusOK)
+	for _, a := range decode[[]album](t, w) {
+		ids = append(ids, a.ID)
+	}
+	if link := w.Header().Get("Link"); link != "" {
+		m := linkPattern.FindStringSubmatch(link)
+		if m == nil {
+			t.Fatalf("Link header %q is malformed", link)
+		}
+		next = m[1]
+	}
+	return ids, next
+}
+
+func TestAlbumPagesStayStableWhileAlbumsChange(t *testing.T) {
+	router := newTestRouter(t)
+	// Prices 5.00, 6.00, ... 14.00 under IDs 4 to 13, added to the seed
+	// albums, which all cost more.
+	for i := range 10 {
+		serve(t, router, "POST", "/albums", `{"title":"T`+strconv.Itoa(i)+`","artist":"A","price":`+strconv.Itoa(5+i)+`}`, http.StatusCreated)
+	}
+
+	var seen []string
+	ids, next := nextPage(t, router, "/albums?sort=price&limit=4")
+	seen = append(seen, ids...)
+	if want := []string{"4", "5", "6", "7"}; !slices.Equal(ids, want) {
+		t.Fatalf("first page = %v, want %v", ids, want)
+	}
+
+	// Before the second page: add an album that sorts onto the first page,
+	// delete the last album the client saw and one it hasn't seen yet.
+	serve(t, router, "POST", "/albums", `{"title":"Cheap","artist":"A","price":1}`, http.StatusCreated)
+	serve(t, router, "DELETE", "/albums/7", "", http.StatusNoContent)
+	serve(t, router, "DELETE", "/albums/9", "", http.StatusNoContent)
+	ids, next = nextPage(t, router, next)
+	seen = append(seen, ids...)
+	if want := []string{"8", "10", "11", "12"}; !slices.Equal(ids, want) {
+		t.Fatalf("second page = %v, want %v", ids, want)
+	}
+
+	// Before the rest: add one that sorts after the cursor; the client
+	// should see it.
+	serve(t, router, "POST", "/albums", `{"title":"Dear","artist":"A","price":99}`, http.StatusCreated)
+	for next != "" {
+		ids, next = nextPage(t, router, next)
+		seen = append(seen, ids...)
+	}
+	want := []string{"4", "5", "6", "7", "8", "10", "11", "12", "13", "2", "3", "1", "15"}
+	if !slices.Equal(seen, want) {
+		t.Errorf("pages = %v, want %v", seen, want)
+	}
+}
+
+func TestAlbumCursorChecks(t *testing.T) {
+	router := newTestRouter(t)
+	_, next := nextPage(t, router, "/albums?sort=price&limit=1")
+	if next == "" {
+		t.Fatal("no next page")
+	}
+	m := regexp.MustCompile(`cursor=([^&]+)`).FindStringSubmatch(next)
+	tests := []struct {
+		query, message string
+	}{
+		{"?sort=title&cursor=" + m[1], "was issued for a different sort or currency"},
+		{"?sort=price&currency=EUR&cursor=" + m[1], "has no exchange rate"},
+		{"?sort=price&cursor=not-a-cursor", "is not a cursor returned by this API"},
+	}
+	for _, tt := range tests {
+		w := serve(t, router, "GET", "/albums"+tt.query, "", http.StatusBadRequest)
+		got := decode[errorBody](t, w).Error.Details
+		if len(got) != 1 || got[0].Message != tt.message {
+			t.Errorf("%s: details %+v, want %q", tt.query, got, tt.message)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package albumsvc
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// errAmountTooLarge is returned for a price too large for a GraphQL Int.
+var errAmountTooLarge = errors.New("amount is too large for a GraphQL Int")
+
+// gqlRoot resolves the fields of Query and Mutation. The other resolvers
+// wrap the values the REST handlers use and give them the schema's field
+// names and types. Each carries the service it reads from.
+type gqlRoot struct{ svc *service }
+
+// albumsArgs are the arguments of the albums fields. Artist.albums has no
+// artist or artistId.
+type albumsArgs struct {
+	Artist   *string
+	ArtistID *graphql.ID
+	Q        *string
+	MinPrice *float64
+	MaxPrice *float64
+	Currency *string
+	Sort     *string
+	First    *int32
+	After    *string
+}
+
+// albumPageArgs maps the arguments of the albums fields to the GET /albums
+// query parameters they stand for.
+var albumPageArgs = map[string]string{
+	"artist":   "artist",
+	"q":        "q",
+	"minPrice": "min_price",
+	"maxPrice": "max_price",
+	"currency": "currency",
+	"sort":     "sort",
+	"first":    "limit",
+	"after":    "cursor",
+}
+
+func (r *gqlRoot) Albums(args albumsArgs) (*albumPageResolver, error) {
+	return r.svc.resolveAlbumPage(args, "")
+}
+
+// Album looks up an album, with its price converted if a currency is
+// given. An unknown album is null.
+func (r *gqlRoot) Album(args struct {
+	ID       graphql.ID
+	Currency *string
+}) (*albumResolver, error) {
+	currency, problem := parseCurrency(albumsArgs{Currency: args.Currency}.params(), r.svc.rates)
+	if problem != nil {
+		return nil, invalidArgs([]fieldError{*problem})
+	}
+	a, ok := r.svc.albums.Get(string(args.ID))
+	if !ok {
+		return nil, nil
+	}
+	if currency != "" {
+		price, ok := r.svc.rates.convert(a.Price, currency)
+		if !ok {
+			return nil, apiError{Code: codeNoRate, Message: "no exchange rate from " + a.Price.Currency + " to " + currency}
+		}
+		a.Price = price
+	}
+	return &albumResolver{r.svc, a}, nil
+}
+
+func (r *gqlRoot) Artists() []artistResolver {
+	var out []artistResolver
+	for _, ar := range r.svc.albums.Artists() {
+		out = append(out, artistResolver{r.svc, ar})
+	}
+	return out
+}
+
+func (r *gqlRoot) Artist(args struct{ ID graphql.ID }) *artistResolver {
+	if ar, ok := r.svc.albums.Artist(string(args.ID)); ok {
+		return &artistResolver{r.svc, ar}
+	}
+	return nil
+}
+
+func (r *gqlRoot) CreateAlbum(args struct{ Input albumInput }) (albumResolver, error) {
+	a := args.Input.album()
+	if err := binding.Validator.ValidateStruct(&a); err != nil {
+		return albumResolver{}, err
+	}
+	created, err := r.svc.albums.Create(a, r.svc.newAlbumID)
+	return albumResolver{r.svc, created}, err
+}
+
+func (r *gqlRoot) UpdateAlbum(args struct {
+	ID    graphql.ID
+	Input albumPatchInput
+}) (albumResolver, error) {
+	patch := args.Input.patch()
+	if err := binding.Validator.ValidateStruct(&patch); err != nil {
+		return albumResolver{}, err
+	}
+	a, err := r.svc.albums.Update(string(args.ID), patch.apply)
+	return albumResolver{r.svc, a}, err
+}
+
+// DeleteAlbum deletes an album and its cover, and returns its ID.
+func (r *gqlRoot) DeleteAlbum(args struct{ ID graphql.ID }) (graphql.ID, error) {
+	return args.ID, r.svc.removeAlbum(string(args.ID))
+}
+
+// resolveAlbumPage runs an albums field as GET /albums would run its query
+// parameters, limited to one artist's albums if artistID is set.
+func (svc *service) resolveAlbumPage(args albumsArgs, artistID string) (*albumPageResolver, error) {
+	query, problems := parseAlbumQuery(args.params(), svc.rates)
+	if len(problems) > 0 {
+		return nil, invalidArgs(problems)
+	}
+	if args.ArtistID != nil {
+		artistID = string(*args.ArtistID)
+	}
+	query.artistID = artistID
+
+	items, next := query.run(svc.albums.Entries())
+	page := &albumPageResolver{svc: svc, items: items}
+	if next != nil {
+		cur := next.encode()
+		page.nextCursor = &cur
+	}
+	return page, nil
+}
+
+// params presents the arguments as the query parameters they stand for.
+func (a albumsArgs) params() queryParams {
+	params := make(map[string]string)
+	setString := func(param string, v *string) {
+		if v != nil {
+			params[param] = *v
+		}
+	}
+	setString("artist", a.Artist)
+	setString("q", a.Q)
+	setString("currency", a.Currency)
+	setString("sort", a.Sort)
+	setString("cursor", a.After)
+	if a.MinPrice != nil {
+		params["min_price"] = strconv.FormatFloat(*a.MinPrice, 'f', -1, 64)
+	}
+	if a.MaxPrice != nil {
+		params["max_price"] = strconv.FormatFloat(*a.MaxPrice, 'f', -1, 64)
+	}
+	if a.First != nil {
+		params["limit"] = strconv.Itoa(int(*a.First))
+	}
+	return func(name string) (string, bool) {
+		v, ok := params[name]
+		return v, ok
+	}
+}
+
+// invalidArgs reports problems with query parameters by the names of the
+// arguments they came from.
+func invalidArgs(problems []fieldError) error {
+	for i, p := range problems {
+		for arg, param := range albumPageArgs {
+			if param == p.Field {
+				problems[i].Field = arg
+			}
+		}
+	}
+	return apiError{Code: codeValidation, Message: "arguments are invalid", Details: problems}
+}
+
+// --- Output types ---
+
+type albumPageResolver struct {
+	svc        *service
+	items      []album
+	nextCursor *string
+}
+
+func (p *albumPageResolver) Items() []albumResolver {
+	out := make([]albumResolver, len(p.items))
+	for i, a := range p.items {
+		out[i] = albumResolver{p.svc, a}
+	}
+	return out
+}
+
+func (p *albumPageResolver) NextCursor() *string { return p.nextCursor }
+
+type albumResolver struct {
+	svc *service
+	a   album
+}
+
+func (r albumResolver) ID() graphql.ID       { return graphql.ID(r.a.ID) }
+func (r albumResolver) Title() string        { return r.a.Title }
+func (r albumResolver) ArtistID() graphql.ID { return graphql.ID(r.a.ArtistID) }
+func (r albumResolver) Price() moneyResolver { return moneyResolver{r.a.Price} }
+func (r albumResolver) Stock() int32         { return int32(r.a.Stock) }
+func (r albumResolver) RuntimeSeconds() int32 {
+	return int32(r.a.Runtime)
+}
+
+func (r albumResolver) Artist() (artistResolver, error) {
+	ar, ok := r.svc.albums.Artist(r.a.ArtistID)
+	if !ok {
+		return artistResolver{}, errArtistNotFound
+	}
+	return artistResolver{r.svc, ar}, nil
+}
+
+func (r albumResolver) PriceHistory() []pricePointResolver {
+	out := make([]pricePointResolver, len(r.a.History))
+	for i, p := range r.a.History {
+		out[i] = pricePointResolver{p}
+	}
+	return out
+}
+
+func (r albumResolver) Tracks() []trackResolver {
+	out := make([]trackResolver, len(r.a.Tracks))
+	for i, t := range r.a.Tracks {
+		out[i] = trackResolver{t}
+	}
+	return out
+}
+
+type artistResolver struct {
+	svc *service
+	ar  artist
+}
+
+func (r artistResolver) ID() graphql.ID { return graphql.ID(r.ar.ID) }
+func (r artistResolver) Name() string   { return r.ar.Name }
+
+func (r artistResolver) Albums(args albumsArgs) (*albumPageResolver, error) {
+	return r.svc.resolveAlbumPage(args, r.ar.ID)
+}
+
+type trackResolver struct{ t track }
+
+func (r trackResolver) Number() int32          { return int32(r.t.Number) }
+func (r trackResolver) Title() string          { return r.t.Title }
+func (r trackResolver) DurationSeconds() int32 { return int32(r.t.Duration) }
+
+type moneyResolver struct{ m money }
+
+func (r moneyResolver) Currency() string { return r.m.Currency }
+
+func (r moneyResolver) Amount() (int32, error) {
+	if r.m.Amount > math.MaxInt32 {
+		return 0, errAmountTooLarge
+	}
+	return int32(r.m.Amount), nil
+}
+
+type pricePointResolver struct{ p pricePoint }
+
+func (r pricePointResolver) Price() moneyResolver { return moneyResolver{r.p.Price} }
+
+// At is when the price was set, in RFC 3339 format; null if before prices
+// were tracked.
+func (r pricePointResolver) At() *string {
+	if r.p.At.IsZero() {
+		return nil
+	}
+	at := r.p.At.Format(time.RFC3339Nano)
+	return &at
+}
+
+// --- Input types ---
+
+type albumInput struct {
+	ID       *graphql.ID
+	Title    string
+	ArtistID *graphql.ID
+	Artist   *string
+	Price    moneyInput
+	Stock    *int32
+	Tracks   *[]trackInput
+}
+
+// albumPatchInput is an AlbumPatch. Fields left out keep their current
+// value.
+type albumPatchInput struct {
+	Title    *string
+	ArtistID *graphql.ID
+	Artist   *string
+	Price    *moneyInput
+	Stock    *int32
+	Tracks   *[]trackInput
+}
+
+type moneyInput struct {
+	Amount   int32
+	Currency string
+}
+
+type trackInput struct {
+	Title           string
+	DurationSeconds int32
+}
+
+// album is the album the input describes, to be validated as a POST
+// /albums body would be.
+func (in albumInput) album() album {
+	a := album{Title: in.Title, Price: in.Price.money()}
+	if in.ID != nil {
+		a.ID = string(*in.ID)
+	}
+	if in.ArtistID != nil {
+		a.ArtistID = string(*in.ArtistID)
+	}
+	if in.Artist != nil {
+		a.Artist = *in.Artist
+	}
+	if in.Stock != nil {
+		a.Stock = int(*in.Stock)
+	}
+	if in.Tracks != nil {
+		a.Tracks = tracksOf(*in.Tracks)
+	}
+	return a
+}
+
+// patch is the PATCH /albums/:id body the input stands for.
+func (in albumPatchInput) patch() albumPatch {
+	p := albumPatch{Title: in.Title, Artist: in.Artist}
+	if in.ArtistID != nil {
+		id := string(*in.ArtistID)
+		p.ArtistID = &id
+	}
+	if in.Price != nil {
+		price := in.Price.money()
+		p.Price = &price
+	}
+	if in.Stock != nil {
+		stock := int(*in.Stock)
+		p.Stock = &stock
+	}
+	if in.Tracks != nil {
+		tracks := tracksOf(*in.Tracks)
+		p.Tracks = &tracks
+	}
+	return p
+}
+
+func (in moneyInput) money() money {
+	return money{Amount: int64(in.Amount), Currency: in.Currency}
+}
+
+func tracksOf(in []trackInput) []track {
+	tracks := make([]track, len(in))
+	for i, t := range in {
+		tracks[i] = track{Title: t.Title, Duration: int(t.DurationSeconds)}
+	}
+	return tracks
+}
@@ -0,0 +1,413 @@
+// Package albumsvc is the album store service: a catalog of record albums
+// with artists, tracks, covers and prices, carts and orders, served as JSON
+// over REST and GraphQL.
+package albumsvc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// album represents data about a record album. Clients may give the artist
+// by name, by ID or both; responses always carry both. Tracks are listed in
+// order and Runtime, their total length, is computed by the store, as is
+// the price History.
+type album struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title" binding:"required"`
+	ArtistID string  `json:"artist_id"`
+	Artist   string  `json:"artist" binding:"required_without=ArtistID"`
+	Price    money   `json:"price"`
+	Stock    int     `json:"stock" binding:"gte=0"` // copies left to sell
+	Tracks   []track `json:"tracks" binding:"dive"`
+	Runtime  int     `json:"runtime_seconds"`
+
+	History []pricePoint `json:"-"` // served by GET /albums/:id/prices
+}
+
+// albumPatch holds the fields a PATCH request may change. Fields left out
+// of the request body keep their current value.
+type albumPatch struct {
+	ID       *string  `json:"id"`
+	Title    *string  `json:"title" binding:"omitempty,min=1"`
+	ArtistID *string  `json:"artist_id" binding:"omitempty,min=1"`
+	Artist   *string  `json:"artist" binding:"omitempty,min=1"`
+	Price    *money   `json:"price"`
+	Stock    *int     `json:"stock" binding:"omitempty,gte=0"`
+	Tracks   *[]track `json:"tracks" binding:"omitempty,dive"`
+}
+
+// seedAlbums is the catalog a new store starts with.
+var seedAlbums = []album{
+	{ID: "1", Title: "Blue Train", Artist: "John Coltrane", Price: money{5699, "USD"}, Stock: 10, Tracks: []track{
+		{Title: "Blue Train", Duration: 643},
+		{Title: "Moment's Notice", Duration: 550},
+		{Title: "Locomotion", Duration: 434},
+		{Title: "I'm Old Fashioned", Duration: 478},
+		{Title: "Lazy Bird", Duration: 420},
+	}},
+	{ID: "2", Title: "Jeru", Artist: "Gerry Mulligan", Price: money{1799, "USD"}, Stock: 5},
+	{ID: "3", Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: money{3999, "USD"}, Stock: 3},
+}
+
+// service is the album store's state. Every handler is one of its methods,
+// so each router New returns has a catalog, carts and covers of its own.
+type service struct {
+	// albums is the catalog. Config.Store selects where it is kept:
+	// "memory" starts from seedAlbums on every run, while "bolt" keeps
+	// albums in the bbolt database named by Config.StorePath and seeds it
+	// only when the database is created.
+	albums albumRepository
+	// newAlbumID assigns IDs to albums created without one, by the scheme
+	// named in Config.IDScheme.
+	newAlbumID idGenerator
+	carts      *cartStore
+	// covers holds cover images and their thumbnails, in the directory
+	// named by Config.BlobDir (blobs by default).
+	covers blobStore
+	// coverMu keeps uploads from interleaving, so a cover's thumbnails
+	// always match its original.
+	coverMu sync.Mutex
+	// rates converts prices for ?currency=. It is loaded from the file
+	// named by Config.RatesFile (rates.json by default).
+	rates *exchangeRates
+	// graphql runs /graphql requests against the resolvers in
+	// resolvers.go.
+	graphql *graphql.Schema
+}
+
+// Config selects where the service keeps its data and how it logs
+// requests. Empty fields take the defaults given beside them.
+type Config struct {
+	Store     string // "memory" (the default) or "bolt"
+	StorePath string // the database of the "bolt" store; albums.db
+	IDScheme  string // see newIDGenerator; seq
+	BlobDir   string // where covers are kept; blobs
+	RatesFile string // exchange rates; rates.json, only if it exists
+	AccessLog string // "text" (the default), "json" or "none"
+}
+
+// New opens the stores cfg names and returns a router serving the album
+// API. Every router has its own catalog, carts and covers.
+func New(cfg Config) (*gin.Engine, error) {
+	var accessLog gin.HandlerFunc
+	switch cfg.AccessLog {
+	case "", "text":
+		accessLog = gin.Logger()
+	case "json":
+		accessLog = logRequestJSON(slog.New(slog.NewJSONHandler(gin.DefaultWriter, nil)))
+	case "none":
+	default:
+		return nil, fmt.Errorf("access log %q is not one of text, json, none", cfg.AccessLog)
+	}
+
+	svc := &service{rates: noRates()}
+	var err error
+	if svc.albums, err = openAlbumStore(cfg.Store, cfg.StorePath); err != nil {
+		return nil, err
+	}
+	if cfg.RatesFile != "" {
+		if svc.rates, err = loadRates(cfg.RatesFile); err != nil {
+			return nil, err
+		}
+	} else if r, err := loadRates("rates.json"); err == nil {
+		svc.rates = r
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	blobDir := cfg.BlobDir
+	if blobDir == "" {
+		blobDir = "blobs"
+	}
+	if svc.covers, err = newFSBlobStore(blobDir); err != nil {
+		return nil, err
+	}
+	if svc.newAlbumID, err = newIDGenerator(cfg.IDScheme, svc.albums.Entries()); err != nil {
+		return nil, err
+	}
+	svc.carts = newCartStore(svc.albums, svc.rates)
+	svc.graphql = graphql.MustParseSchema(catalogSchemaSDL, &gqlRoot{svc},
+		graphql.UseStringDescriptions(), graphql.DisableIntrospection())
+
+	// Report invalid fields by their JSON names.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			return name
+		})
+	}
+
+	router := gin.New()
+	if accessLog != nil {
+		router.Use(accessLog)
+	}
+	router.Use(gin.Recovery())
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "no route for "+c.Request.Method+" "+c.Request.URL.Path)
+	})
+	router.NoMethod(func(c *gin.Context) {
+		abortWithError(c, http.StatusMethodNotAllowed, codeMethodNotAllowed, c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+	})
+
+	router.GET("/albums", svc.getAlbums)
+	router.GET("/albums/:id", svc.getAlbumByID)
+	router.POST("/albums", svc.postAlbums)
+	router.PUT("/albums/:id", svc.putAlbum)
+	router.PATCH("/albums/:id", svc.patchAlbum)
+	router.DELETE("/albums/:id", svc.deleteAlbum)
+	router.PUT("/albums/:id/cover", svc.putCover)
+	router.GET("/albums/:id/cover", svc.getCover)
+	router.HEAD("/albums/:id/cover", svc.getCover)
+	router.DELETE("/albums/:id/cover", svc.deleteCover)
+	router.GET("/albums/:id/prices", svc.getPriceHistory)
+	router.GET("/albums/:id/tracks", svc.getTracks)
+	router.POST("/albums/:id/tracks", svc.postTrack)
+	router.GET("/albums/:id/tracks/:number", svc.getTrack)
+	router.PATCH("/albums/:id/tracks/:number", svc.patchTrack)
+	router.DELETE("/albums/:id/tracks/:number", svc.deleteTrack)
+
+	router.POST("/carts", svc.postCarts)
+	router.GET("/carts/:id", svc.getCart)
+	router.DELETE("/carts/:id", svc.deleteCart)
+	router.POST("/carts/:id/items", svc.postCartItem)
+	router.PUT("/carts/:id/items/:albumId", svc.putCartItem)
+	router.DELETE("/carts/:id/items/:albumId", svc.deleteCartItem)
+	router.POST("/carts/:id/checkout", svc.checkoutCart)
+	router.GET("/orders/:id", svc.getOrder)
+
+	router.GET("/graphql", svc.getGraphQL)
+	router.POST("/graphql", svc.postGraphQL)
+	router.GET("/graphql/schema", svc.getGraphQLSchema)
+
+	router.GET("/artists", svc.getArtists)
+	router.GET("/artists/:id", svc.getArtistByID)
+	router.POST("/artists", svc.postArtists)
+	router.GET("/artists/:id/albums", svc.getArtistAlbums)
+
+	return router, nil
+}
+
+// getAlbums responds with one page of albums as JSON, filtered by artist,
+// price range and a search term, and sorted by the sort parameter. When
+// there are more albums, a Link header points at the next page.
+func (svc *service) getAlbums(c *gin.Context) {
+	query, problems := parseAlbumQuery(c.GetQuery, svc.rates)
+	if len(problems) > 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "query parameters are invalid", problems...)
+		return
+	}
+	svc.respondWithPage(c, query)
+}
+
+// respondWithPage runs query and writes the page it selects.
+func (svc *service) respondWithPage(c *gin.Context, query albumQuery) {
+	page, next := query.run(svc.albums.Entries())
+	if next != nil {
+		c.Header("Link", nextLink(c.Request.URL, next))
+	}
+	c.IndentedJSON(http.StatusOK, page)
+}
+
+// postAlbums adds an album from JSON received in the request body. The
+// server assigns the ID unless the client sends one that isn't taken yet.
+func (svc *service) postAlbums(c *gin.Context) {
+	var newAlbum album
+
+	// Call ShouldBindJSON to bind the received JSON to newAlbum and check
+	// its binding tags, leaving the error response to us.
+	if err := c.ShouldBindJSON(&newAlbum); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	// Add the new album to the store, unless its ID is taken.
+	created, err := svc.albums.Create(newAlbum, svc.newAlbumID)
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", albumLocation(created.ID))
+	c.IndentedJSON(http.StatusCreated, created)
+}
+
+// getAlbumByID locates the album whose ID value matches the id
+// parameter sent by the client, then returns that album as a response,
+// with its price converted if a currency parameter is given.
+func (svc *service) getAlbumByID(c *gin.Context) {
+	currency, problem := parseCurrency(c.GetQuery, svc.rates)
+	if problem != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "query parameters are invalid", *problem)
+		return
+	}
+	a, ok := svc.albums.Get(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+	if currency != "" {
+		price, ok := svc.rates.convert(a.Price, currency)
+		if !ok {
+			abortWithError(c, http.StatusUnprocessableEntity, codeNoRate,
+				"no exchange rate from "+a.Price.Currency+" to "+currency)
+			return
+		}
+		a.Price = price
+	}
+	c.IndentedJSON(http.StatusOK, a)
+}
+
+// putAlbum stores an album under the ID in the path, replacing every field
+// of the album already there, tracks included, or creating it if there is
+// none.
+func (svc *service) putAlbum(c *gin.Context) {
+	id := c.Param("id")
+
+	var a album
+	if err := c.ShouldBindJSON(&a); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	// The ID comes from the path; a body ID, if any, must agree with it.
+	if a.ID != "" && a.ID != id {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "album is invalid",
+			fieldError{Field: "id", Message: "must match the id in the path"})
+		return
+	}
+	a.ID = id
+
+	stored, created, err := svc.albums.Put(a)
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	if created {
+		c.Header("Location", albumLocation(id))
+		c.IndentedJSON(http.StatusCreated, stored)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, stored)
+}
+
+// patchAlbum changes only the fields present in the request body.
+func (svc *service) patchAlbum(c *gin.Context) {
+	id := c.Param("id")
+
+	var patch albumPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	if patch.ID != nil && *patch.ID != id {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "album is invalid",
+			fieldError{Field: "id", Message: "cannot be changed"})
+		return
+	}
+
+	a, err := svc.albums.Update(id, patch.apply)
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, a)
+}
+
+// deleteAlbum removes an album and its cover.
+func (svc *service) deleteAlbum(c *gin.Context) {
+	if err := svc.removeAlbum(c.Param("id")); err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apply changes the fields of a that are set in p.
+func (p albumPatch) apply(a *album) error {
+	if p.Title != nil {
+		a.Title = *p.Title
+	}
+	// A new artist name or ID replaces both; the store fills in the other
+	// one.
+	if p.Artist != nil || p.ArtistID != nil {
+		a.Artist, a.ArtistID = "", ""
+	}
+	if p.Artist != nil {
+		a.Artist = *p.Artist
+	}
+	if p.ArtistID != nil {
+		a.ArtistID = *p.ArtistID
+	}
+	if p.Price != nil {
+		a.Price = *p.Price
+	}
+	if p.Stock != nil {
+		a.Stock = *p.Stock
+	}
+	if p.Tracks != nil {
+		a.Tracks = *p.Tracks
+	}
+	return nil
+}
+
+// removeAlbum deletes an album and then its cover. A cover that can't be
+// deleted is only logged, since the album is already gone.
+func (svc *service) removeAlbum(id string) error {
+	if err := svc.albums.Delete(id); err != nil {
+		return err
+	}
+	svc.coverMu.Lock()
+	defer svc.coverMu.Unlock()
+	if err := svc.covers.DeleteAll(coverPrefix(id)); err != nil {
+		log.Printf("deleting cover of album %s: %v", id, err)
+	}
+	return nil
+}
+
+// albumLocation is the URL of the album with the given ID.
+func albumLocation(id string) string {
+	return "/albums/" + url.PathEscape(id)
+}
+
+func openAlbumStore(kind, path string) (albumRepository, error) {
+	switch kind {
+	case "", "memory":
+		return NewAlbumStore(seedAlbums), nil
+	case "bolt":
+		if path == "" {
+			path = "albums.db"
+		}
+		return OpenBoltAlbumStore(path, seedAlbums)
+	}
+	return nil, fmt.Errorf("album store %q is not one of memory, bolt", kind)
+}
+
+// logRequestJSON returns middleware that logs each request to logger once
+// it has been served, for log collectors that parse JSON lines.
+func logRequestJSON(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		logger.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"bytes", c.Writer.Size(),
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
@@ -0,0 +1,184 @@
+package albumsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// send makes a request to router, with body as JSON if it isn't empty.
+// Unlike serve, it may be called from any goroutine.
+func send(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// serve makes a request to router and fails the test unless the response
+// has the given status.
+func serve(t *testing.T, router http.Handler, method, path, body string, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	w := send(router, method, path, body)
+	if w.Code != status {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, w.Code, status, w.Body)
+	}
+	return w
+}
+
+// decode unmarshals a JSON response body into a T.
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	return v
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	router := newTestRouter(t)
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		status       int
+		want         apiError
+	}{
+		{"malformed JSON", "POST", "/albums", `{"title":`, http.StatusBadRequest,
+			apiError{Code: codeInvalidJSON}},
+		{"wrong JSON type", "POST", "/albums", `{"title":1,"artist":"X"}`, http.StatusBadRequest,
+			apiError{Code: codeInvalidJSON}},
+		{"every invalid field", "POST", "/albums", `{"price":{"amount":-1,"currency":"usd"},"stock":-2}`, http.StatusBadRequest,
+			apiError{Code: codeValidation, Message: "album is invalid", Details: []fieldError{
+				{Field: "title", Message: "is required"},
+				{Field: "artist", Message: "is required unless artist_id is given"},
+				{Field: "price.amount", Message: "must be at least 0"},
+				{Field: "price.currency", Message: "must be an ISO 4217 currency code"},
+				{Field: "stock", Message: "must be at least 0"},
+			}}},
+		{"patch names the type without Patch", "PATCH", "/albums/1", `{"title":""}`, http.StatusBadRequest,
+			apiError{Code: codeValidation, Message: "album is invalid", Details: []fieldError{
+				{Field: "title", Message: "must not be empty"},
+			}}},
+		{"unknown album", "GET", "/albums/404", "", http.StatusNotFound,
+			apiError{Code: codeNotFound, Message: "album not found"}},
+		{"taken ID", "POST", "/albums", `{"id":"1","title":"T","artist":"A","price":9.99}`, http.StatusConflict,
+			apiError{Code: codeConflict, Message: "album with this id already exists"}},
+		{"unknown artist ID", "POST", "/albums", `{"title":"T","artist_id":"nobody","price":9.99}`, http.StatusBadRequest,
+			apiError{Code: codeValidation, Message: "album is invalid", Details: []fieldError{
+				{Field: "artist_id", Message: "is not the id of an artist"},
+			}}},
+		{"bad query parameters", "GET", "/albums?limit=0&sort=colour&min_price=x", "", http.StatusBadRequest,
+			apiError{Code: codeValidation, Message: "query parameters are invalid", Details: []fieldError{
+				{Field: "min_price", Message: "must be a non-negative amount in USD"},
+				{Field: "sort", Message: "must be a comma-separated list of id, title, artist, price, each optionally prefixed with -"},
+				{Field: "limit", Message: "must be between 1 and 1000"},
+			}}},
+		{"no route", "GET", "/nowhere", "", http.StatusNotFound,
+			apiError{Code: codeNotFound, Message: "no route for GET /nowhere"}},
+		{"wrong method", "PATCH", "/carts/x", `{}`, http.StatusMethodNotAllowed,
+			apiError{Code: codeMethodNotAllowed, Message: "PATCH is not allowed on /carts/x"}},
+		{"unknown cart", "POST", "/carts/x/checkout", "", http.StatusNotFound,
+			apiError{Code: codeNotFound, Message: "cart not found"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, router, tt.method, tt.path, tt.body, tt.status)
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", ct)
+			}
+			got := decode[errorBody](t, w).Error
+			if got.Code != tt.want.Code {
+				t.Errorf("code = %q, want %q", got.Code, tt.want.Code)
+			}
+			// Messages about malformed JSON come from encoding/json; only
+			// check that there is one.
+			if got.Message == "" || tt.want.Message != "" && got.Message != tt.want.Message {
+				t.Errorf("message = %q, want %q", got.Message, tt.want.Message)
+			}
+			if !slices.Equal(got.Details, tt.want.Details) {
+				t.Errorf("details = %+v, want %+v", got.Details, tt.want.Details)
+			}
+		})
+	}
+}
+
+func TestLocationHeaders(t *testing.T) {
+	router := newTestRouter(t)
+	tests := []struct {
+		method, path, body string
+		status             int
+		location           string // "" to take the ID from the body
+	}{
+		{"POST", "/albums", `{"title":"Giant Steps","artist":"John Coltrane","price":9.99}`, http.StatusCreated, "/albums/4"},
+		{"PUT", "/albums/a%20b", `{"title":"Kind of Blue","artist":"Miles Davis","price":9.99}`, http.StatusCreated, "/albums/a%20b"},
+		{"POST", "/albums/1/tracks", `{"title":"Bonus","duration_seconds":60}`, http.StatusCreated, "/albums/1/tracks/6"},
+		{"POST", "/artists", `{"name":"Bill Evans"}`, http.StatusCreated, "/artists/bill-evans"},
+		{"POST", "/carts", "", http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		w := serve(t, router, tt.method, tt.path, tt.body, tt.status)
+		want := tt.location
+		if want == "" {
+			want = cartLocation(decode[cartView](t, w).ID)
+		}
+		if got := w.Header().Get("Location"); got != want {
+			t.Errorf("%s %s: Location = %q, want %q", tt.method, tt.path, got, want)
+			continue
+		}
+		serve(t, router, "GET", want, "", http.StatusOK)
+	}
+
+	// Replacing an album has no Location: the client already has the URL.
+	w := serve(t, router, "PUT", "/albums/1", `{"title":"Blue Train","artist":"John Coltrane","price":9.99}`, http.StatusOK)
+	if got := w.Header().Get("Location"); got != "" {
+		t.Errorf("PUT replacing an album: Location = %q, want none", got)
+	}
+}
+
+func TestAlbumIDSchemes(t *testing.T) {
+	tests := []struct {
+		scheme string
+		id     *regexp.Regexp
+	}{
+		{"", regexp.MustCompile(`^4$`)},
+		{"seq", regexp.MustCompile(`^4$`)},
+		{"uuid", regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"ulid", regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)},
+	}
+	for _, tt := range tests {
+		router, err := New(Config{IDScheme: tt.scheme, BlobDir: t.TempDir(), AccessLog: "none"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for range 2 {
+			w := serve(t, router, "POST", "/albums", `{"title":"T","artist":"A","price":9.99}`, http.StatusCreated)
+			a := decode[album](t, w)
+			if !tt.id.MatchString(a.ID) && len(ids) == 0 {
+				t.Errorf("scheme %q: first ID %q doesn't match %v", tt.scheme, a.ID, tt.id)
+			}
+			if w.Header().Get("Location") != albumLocation(a.ID) {
+				t.Errorf("scheme %q: Location = %q for album %q", tt.scheme, w.Header().Get("Location"), a.ID)
+			}
+			ids = append(ids, a.ID)
+		}
+		if ids[0] == ids[1] {
+			t.Errorf("scheme %q: two albums got ID %q", tt.scheme, ids[0])
+		}
+		// A client may still choose the ID.
+		serve(t, router, "POST", "/albums", `{"id":"mine","title":"T","artist":"A","price":9.99}`, http.StatusCreated)
+	}
+
+	if _, err := New(Config{IDScheme: "random", BlobDir: t.TempDir(), AccessLog: "none"}); err == nil {
+		t.Error("New accepted ID scheme random")
+	}
+}
@@ -0,0 +1,496 @@
+package albumsvc
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// errDuplicateID is returned when an album with the same ID already exists.
+	errDuplicateID = errors.New("album ID already exists")
+	// errNotFound is returned when no album has the requested ID.
+	errNotFound = errors.New("album not found")
+	// errArtistNotFound is returned when no artist has the requested ID.
+	errArtistNotFound = errors.New("artist not found")
+	// errArtistExists is returned when an artist with the same ID or name
+	// already exists.
+	errArtistExists = errors.New("artist already exists")
+	// errUnknownArtist is returned when an album names an artist ID that no
+	// artist has.
+	errUnknownArtist = errors.New("album refers to an unknown artist")
+	// errArtistMismatch is returned when an album's artist name and artist
+	// ID refer to different artists.
+	errArtistMismatch = errors.New("album artist does not match its artist ID")
+)
+
+// albumRepository is where the handlers keep albums. AlbumStore keeps them
+// in memory; BoltAlbumStore also writes them to disk.
+type albumRepository interface {
+	Entries() []albumEntry
+	Get(id string) (album, bool)
+	Create(a album, newID idGenerator) (album, error)
+	Put(a album) (stored album, created bool, err error)
+	Update(id string, change func(*album) error) (album, error)
+	Delete(id string) error
+
+	Artists() []artist
+	Artist(id string) (artist, bool)
+	CreateArtist(ar artist) (artist, error)
+
+	PlaceOrder(c cart, rates *exchangeRates, newID idGenerator) (o order, created bool, err error)
+	Order(id string) (order, bool)
+}
+
+// AlbumStore is a thread-safe album catalog. Albums are indexed by ID and
+// listed in the order they were added.
+//
+// Every album belongs to an artist. An album written with only an artist
+// name is filed under the artist with that name, ignoring case, and the
+// artist is created if there is none yet.
+type AlbumStore struct {
+	mu      sync.RWMutex
+	byID    map[string]album
+	order   []string
+	seq     map[string]uint64 // position in the order, never reused
+	nextSeq uint64
+
+	artists      map[string]artist
+	artistOrder  []string
+	artistByName map[string]string // lower-cased name to ID
+
+	orders      map[string]order
+	orderOrder  []string
+	orderByCart map[string]string // cart ID to order ID
+}
+
+// albumEntry is an album with its position in the store's order.
+type albumEntry struct {
+	album
+	seq uint64
+}
+
+// NewAlbumStore returns a store holding the seed albums.
+func NewAlbumStore(seed []album) *AlbumStore {
+	s := &AlbumStore{
+		byID:         make(map[string]album, len(seed)),
+		seq:          make(map[string]uint64, len(seed)),
+		nextSeq:      1,
+		artists:      make(map[string]artist),
+		artistByName: make(map[string]string),
+		orders:       make(map[string]order),
+		orderByCart:  make(map[string]string),
+	}
+	for _, a := range seed {
+		s.Add(a)
+	}
+	return s
+}
+
+// List returns a copy of every album.
+func (s *AlbumStore) List() []album {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]album, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, s.byID[id])
+	}
+	return out
+}
+
+// Entries returns a copy of every album with its position, in order.
+func (s *AlbumStore) Entries() []albumEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]albumEntry, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, albumEntry{album: s.byID[id], seq: s.seq[id]})
+	}
+	return out
+}
+
+// Get returns the album with the given ID.
+func (s *AlbumStore) Get(id string) (album, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.byID[id]
+	return a, ok
+}
+
+// entry returns the album with the given ID and its position.
+func (s *AlbumStore) entry(id string) (albumEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.byID[id]
+	return albumEntry{album: a, seq: s.seq[id]}, ok
+}
+
+// position returns the position of the album with the given ID, or the one
+// it would take if it were added now.
+func (s *AlbumStore) position(id string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if seq, ok := s.seq[id]; ok {
+		return seq
+	}
+	return s.nextSeq
+}
+
+// Add stores a new album, or returns errDuplicateID if its ID is taken.
+func (s *AlbumStore) Add(a album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.byID[a.ID]; exists {
+		return errDuplicateID
+	}
+	if err := s.prepare(&a); err != nil {
+		return err
+	}
+	notePrice(&a, nil, time.Now())
+	s.insert(a)
+	return nil
+}
+
+// Create stores a new album. An album without an ID gets the first one from
+// newID that isn't taken; one with an ID keeps it unless it is taken, in
+// which case errDuplicateID is returned.
+func (s *AlbumStore) Create(a album, newID idGenerator) (album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.ID == "" {
+		for a.ID = newID(); s.exists(a.ID); a.ID = newID() {
+		}
+	} else if s.exists(a.ID) {
+		return album{}, errDuplicateID
+	}
+	if err := s.prepare(&a); err != nil {
+		return album{}, err
+	}
+	notePrice(&a, nil, time.Now())
+	s.insert(a)
+	return a, nil
+}
+
+// Put stores a under its ID, replacing the album there if there is one,
+// and returns the album as stored, with its artist and runtime filled in.
+// It also reports whether the album was created.
+func (s *AlbumStore) Put(a album) (stored album, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.prepare(&a); err != nil {
+		return album{}, false, err
+	}
+	if old, exists := s.byID[a.ID]; exists {
+		notePrice(&a, &old, time.Now())
+		s.byID[a.ID] = a
+		return a, false, nil
+	}
+	notePrice(&a, nil, time.Now())
+	s.insert(a)
+	return a, true, nil
+}
+
+// restore stores a at a known position, as when loading albums from disk.
+func (s *AlbumStore) restore(a album, seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.exists(a.ID) {
+		s.order = append(s.order, a.ID)
+	}
+	s.byID[a.ID] = a
+	s.seq[a.ID] = seq
+	s.nextSeq = max(s.nextSeq, seq+1)
+}
+
+// Update applies change to a copy of the album with the given ID, stores
+// the result and returns it. If change returns an error, the album is left
+// as it was. change runs under the store's lock, so it must not call back
+// into the store.
+func (s *AlbumStore) Update(id string, change func(*album) error) (album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.byID[id]
+	if !exists {
+		return album{}, errNotFound
+	}
+	a := old
+	// Readers may hold the stored slice, so change must get its own.
+	a.Tracks = slices.Clone(a.Tracks)
+	if err := change(&a); err != nil {
+		return album{}, err
+	}
+	a.ID = id
+	if err := s.prepare(&a); err != nil {
+		return album{}, err
+	}
+	notePrice(&a, &old, time.Now())
+	s.byID[id] = a
+	return a, nil
+}
+
+// Delete removes the album with the given ID.
+func (s *AlbumStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.byID[id]; !exists {
+		return errNotFound
+	}
+	delete(s.byID, id)
+	delete(s.seq, id)
+	s.order = slices.DeleteFunc(s.order, func(other string) bool { return other == id })
+	return nil
+}
+
+// Artists returns a copy of every artist, in the order they were added.
+func (s *AlbumStore) Artists() []artist {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]artist, 0, len(s.artistOrder))
+	for _, id := range s.artistOrder {
+		out = append(out, s.artists[id])
+	}
+	return out
+}
+
+// Artist returns the artist with the given ID.
+func (s *AlbumStore) Artist(id string) (artist, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ar, ok := s.artists[id]
+	return ar, ok
+}
+
+// CreateArtist stores a new artist. An artist without an ID gets one made
+// from its name. errArtistExists is returned if the ID or the name is taken.
+func (s *AlbumStore) CreateArtist(ar artist) (artist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ar, err := s.newArtist(ar)
+	if err != nil {
+		return artist{}, err
+	}
+	s.addArtist(ar)
+	return ar, nil
+}
+
+// restoreArtist stores an artist loaded from disk.
+func (s *AlbumStore) restoreArtist(ar artist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.artists[ar.ID]; !exists {
+		s.addArtist(ar)
+	}
+}
+
+// planArtist does what CreateArtist does to ar without storing it.
+func (s *AlbumStore) planArtist(ar artist) (artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.newArtist(ar)
+}
+
+// PlaceOrder turns a cart into an order: it prices every item at the
+// album's current price in the cart's currency, converting with rates,
+// takes the quantities out of stock and records the order, all under one
+// lock, so two checkouts can never sell the same copy. A cart becomes at
+// most one order; placing it again returns that order with created false.
+func (s *AlbumStore) PlaceOrder(c cart, rates *exchangeRates, newID idGenerator) (o order, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.orderByCart[c.ID]; ok {
+		return s.orders[id], false, nil
+	}
+	if o, err = s.newOrder(c, rates, newID); err != nil {
+		return order{}, false, err
+	}
+	s.applyOrder(o, true)
+	return o, true, nil
+}
+
+// Order returns the order with the given ID.
+func (s *AlbumStore) Order(id string) (order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[id]
+	return o, ok
+}
+
+// Orders returns a copy of every order, in the order they were placed.
+func (s *AlbumStore) Orders() []order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]order, 0, len(s.orderOrder))
+	for _, id := range s.orderOrder {
+		out = append(out, s.orders[id])
+	}
+	return out
+}
+
+// planOrder does what PlaceOrder does without storing anything. It returns
+// the order the cart already became, if any, with placed true.
+func (s *AlbumStore) planOrder(c cart, rates *exchangeRates, newID idGenerator) (o order, placed bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id, ok := s.orderByCart[c.ID]; ok {
+		return s.orders[id], true, nil
+	}
+	o, err = s.newOrder(c, rates, newID)
+	return o, false, err
+}
+
+// commitOrder stores an order, taking its items out of stock if sell is
+// set. Orders loaded from a snapshot were already taken out.
+func (s *AlbumStore) commitOrder(o order, sell bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.orders[o.ID]; !exists {
+		s.applyOrder(o, sell)
+	}
+}
+
+// plan does what Create, Put and Update do to an album before storing it,
+// without storing anything: it returns the artist that storing a would
+// create, if any.
+func (s *AlbumStore) plan(a *album) (*artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a.numberTracks()
+	return s.resolveArtist(a)
+}
+
+func (s *AlbumStore) exists(id string) bool {
+	_, ok := s.byID[id]
+	return ok
+}
+
+// insert appends a new album. The caller holds the write lock.
+func (s *AlbumStore) insert(a album) {
+	s.byID[a.ID] = a
+	s.order = append(s.order, a.ID)
+	s.seq[a.ID] = s.nextSeq
+	s.nextSeq++
+}
+
+// prepare fills in a's artist, creating it if needed, and its track numbers
+// and runtime. The caller holds the write lock.
+func (s *AlbumStore) prepare(a *album) error {
+	a.numberTracks()
+	ar, err := s.resolveArtist(a)
+	if err != nil {
+		return err
+	}
+	if ar != nil {
+		s.addArtist(*ar)
+	}
+	return nil
+}
+
+// resolveArtist sets a's artist ID and name from whichever of the two it
+// has. If a names an artist that doesn't exist yet, the artist to create is
+// returned. The caller holds the lock.
+func (s *AlbumStore) resolveArtist(a *album) (*artist, error) {
+	if a.ArtistID != "" {
+		ar, ok := s.artists[a.ArtistID]
+		if !ok {
+			return nil, errUnknownArtist
+		}
+		if a.Artist != "" && !strings.EqualFold(a.Artist, ar.Name) {
+			return nil, errArtistMismatch
+		}
+		a.Artist = ar.Name
+		return nil, nil
+	}
+	if id, ok := s.artistByName[strings.ToLower(a.Artist)]; ok {
+		a.ArtistID, a.Artist = id, s.artists[id].Name
+		return nil, nil
+	}
+	ar, err := s.newArtist(artist{Name: a.Artist})
+	if err != nil {
+		return nil, err
+	}
+	a.ArtistID = ar.ID
+	return &ar, nil
+}
+
+// newArtist checks that ar can be added, giving it an ID if it has none.
+// The caller holds the lock.
+func (s *AlbumStore) newArtist(ar artist) (artist, error) {
+	if _, taken := s.artistByName[strings.ToLower(ar.Name)]; taken {
+		return artist{}, errArtistExists
+	}
+	if ar.ID == "" {
+		base := slugify(ar.Name)
+		ar.ID = base
+		for n := 2; s.artistIDTaken(ar.ID); n++ {
+			ar.ID = base + "-" + strconv.Itoa(n)
+		}
+	} else if s.artistIDTaken(ar.ID) {
+		return artist{}, errArtistExists
+	}
+	return ar, nil
+}
+
+func (s *AlbumStore) artistIDTaken(id string) bool {
+	_, ok := s.artists[id]
+	return ok
+}
+
+// addArtist stores a new artist. The caller holds the write lock.
+func (s *AlbumStore) addArtist(ar artist) {
+	s.artists[ar.ID] = ar
+	s.artistOrder = append(s.artistOrder, ar.ID)
+	s.artistByName[strings.ToLower(ar.Name)] = ar.ID
+}
+
+// newOrder prices c as an order. The caller holds the lock.
+func (s *AlbumStore) newOrder(c cart, rates *exchangeRates, newID idGenerator) (order, error) {
+	id := newID()
+	for s.orders[id].ID != "" {
+		id = newID()
+	}
+	return buildOrder(c, id, time.Now(), rates, func(id string) (album, bool) {
+		a, ok := s.byID[id]
+		return a, ok
+	})
+}
+
+// applyOrder records o and, if sell is set, takes its items out of stock.
+// The caller holds the write lock.
+func (s *AlbumStore) applyOrder(o order, sell bool) {
+	if sell {
+		for _, line := range o.Lines {
+			if a, ok := s.byID[line.AlbumID]; ok {
+				a.Stock -= line.Quantity
+				s.byID[line.AlbumID] = a
+			}
+		}
+	}
+	s.orders[o.ID] = o
+	s.orderOrder = append(s.orderOrder, o.ID)
+	s.orderByCart[o.CartID] = o.ID
+}
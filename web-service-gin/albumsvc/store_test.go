@@ -0,0 +1,173 @@
+package albumsvc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func testAlbum(id string) album {
+	return album{ID: id, Title: "Album " + id, Artist: "Artist " + id, Price: money{999, "USD"}}
+}
+
+func TestAlbumStoreConcurrentAddGetList(t *testing.T) {
+	const writers, perWriter = 50, 20
+	s := NewAlbumStore(seedAlbums)
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				id := fmt.Sprintf("w%d-%d", w, i)
+				if err := s.Add(testAlbum(id)); err != nil {
+					t.Errorf("Add(%s): %v", id, err)
+					return
+				}
+				if a, ok := s.Get(id); !ok || a.Title != "Album "+id {
+					t.Errorf("Get(%s) = %+v, %v right after adding it", id, a, ok)
+					return
+				}
+			}
+		}()
+	}
+	// Readers list the store while it grows; no listing may hold an album
+	// twice.
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWriter {
+				seen := make(map[string]bool)
+				for _, a := range s.List() {
+					if seen[a.ID] {
+						t.Errorf("List returned %s twice", a.ID)
+						return
+					}
+					seen[a.ID] = true
+				}
+				s.Entries()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := len(s.List()), len(seedAlbums)+writers*perWriter; got != want {
+		t.Errorf("List has %d albums, want %d", got, want)
+	}
+}
+
+func TestAlbumStoreConcurrentAddSameID(t *testing.T) {
+	s := NewAlbumStore(nil)
+
+	var added, duplicates atomic.Int32
+	var wg sync.WaitGroup
+	for range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := s.Add(testAlbum("x")); {
+			case err == nil:
+				added.Add(1)
+			case errors.Is(err, errDuplicateID):
+				duplicates.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added.Load() != 1 || duplicates.Load() != 199 {
+		t.Errorf("added %d, duplicates %d; want 1 and 199", added.Load(), duplicates.Load())
+	}
+	if n := len(s.List()); n != 1 {
+		t.Errorf("List has %d albums, want 1", n)
+	}
+}
+
+func TestAlbumStoreConcurrentCreateAssignsUniqueIDs(t *testing.T) {
+	s := NewAlbumStore(seedAlbums)
+	newID, err := newIDGenerator("seq", s.Entries())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(chan string, 300)
+	var wg sync.WaitGroup
+	for range cap(ids) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a, err := s.Create(album{Title: "t", Artist: "a", Price: money{100, "USD"}}, newID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids <- a.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("ID %s was assigned twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestAlbumStoreConcurrentUpdateDelete(t *testing.T) {
+	s := NewAlbumStore(nil)
+	for i := range 100 {
+		if err := s.Add(testAlbum(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		id := strconv.Itoa(i)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := s.Update(id, func(a *album) error {
+				a.Stock++
+				return nil
+			})
+			if err != nil && !errors.Is(err, errNotFound) {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				if err := s.Delete(id); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.Get(id)
+			s.List()
+		}()
+	}
+	wg.Wait()
+
+	for i := range 100 {
+		_, ok := s.Get(strconv.Itoa(i))
+		if ok != (i%2 == 1) {
+			t.Errorf("album %d present = %v after deleting the even ones", i, ok)
+		}
+	}
+	if n := len(s.List()); n != 50 {
+		t.Errorf("List has %d albums, want 50", n)
+	}
+}
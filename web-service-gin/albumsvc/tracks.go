@@ -0,0 +1,172 @@
+package albumsvc
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errTrackNotFound is returned when an album has no track with the
+	// requested number.
+	errTrackNotFound = errors.New("track not found")
+	// errTrackNumber is returned when a track is to be placed past the end
+	// of its album.
+	errTrackNumber = errors.New("track number is past the end of the album")
+)
+
+// track is one song on an album. Number is its position, counting from 1;
+// the store keeps the numbers in step with the order of the tracks.
+type track struct {
+	Number   int    `json:"number" binding:"gte=0"`
+	Title    string `json:"title" binding:"required"`
+	Duration int    `json:"duration_seconds" binding:"required,gte=1"`
+}
+
+// trackPatch holds the fields a PATCH request may change. Setting Number
+// moves the track, shifting the ones in between.
+type trackPatch struct {
+	Number   *int    `json:"number" binding:"omitempty,gte=1"`
+	Title    *string `json:"title" binding:"omitempty,min=1"`
+	Duration *int    `json:"duration_seconds" binding:"omitempty,gte=1"`
+}
+
+// numberTracks renumbers a's tracks by position and totals their durations.
+func (a *album) numberTracks() {
+	if a.Tracks == nil {
+		a.Tracks = []track{}
+	}
+	a.Runtime = 0
+	for i := range a.Tracks {
+		a.Tracks[i].Number = i + 1
+		a.Runtime += a.Tracks[i].Duration
+	}
+}
+
+// getTracks responds with an album's tracks in order.
+func (svc *service) getTracks(c *gin.Context) {
+	a, ok := svc.albums.Get(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, a.Tracks)
+}
+
+// getTrack responds with one track of an album.
+func (svc *service) getTrack(c *gin.Context) {
+	a, ok := svc.albums.Get(c.Param("id"))
+	if !ok {
+		abortWithStoreError(c, errNotFound)
+		return
+	}
+	i, ok := trackIndex(c, a)
+	if !ok {
+		abortWithStoreError(c, errTrackNotFound)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, a.Tracks[i])
+}
+
+// postTrack adds a track to an album: at the position given by its number,
+// or after the last track if it has none.
+func (svc *service) postTrack(c *gin.Context) {
+	var t track
+	if err := c.ShouldBindJSON(&t); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	a, err := svc.albums.Update(c.Param("id"), func(a *album) error {
+		i := len(a.Tracks)
+		if t.Number > 0 {
+			if t.Number > len(a.Tracks)+1 {
+				return errTrackNumber
+			}
+			i = t.Number - 1
+		}
+		a.Tracks = slices.Insert(a.Tracks, i, t)
+		t.Number = i + 1
+		return nil
+	})
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", trackLocation(a.ID, t.Number))
+	c.IndentedJSON(http.StatusCreated, a.Tracks[t.Number-1])
+}
+
+// patchTrack changes only the fields present in the request body, moving
+// the track if its number is one of them.
+func (svc *service) patchTrack(c *gin.Context) {
+	var patch trackPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	var at int
+	a, err := svc.albums.Update(c.Param("id"), func(a *album) error {
+		i, ok := trackIndex(c, *a)
+		if !ok {
+			return errTrackNotFound
+		}
+		t := a.Tracks[i]
+		if patch.Title != nil {
+			t.Title = *patch.Title
+		}
+		if patch.Duration != nil {
+			t.Duration = *patch.Duration
+		}
+		a.Tracks[i] = t
+		at = i
+		if patch.Number != nil {
+			if *patch.Number > len(a.Tracks) {
+				return errTrackNumber
+			}
+			at = *patch.Number - 1
+			a.Tracks = slices.Insert(slices.Delete(a.Tracks, i, i+1), at, t)
+		}
+		return nil
+	})
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, a.Tracks[at])
+}
+
+// deleteTrack removes a track, moving the ones after it up by one.
+func (svc *service) deleteTrack(c *gin.Context) {
+	_, err := svc.albums.Update(c.Param("id"), func(a *album) error {
+		i, ok := trackIndex(c, *a)
+		if !ok {
+			return errTrackNotFound
+		}
+		a.Tracks = slices.Delete(a.Tracks, i, i+1)
+		return nil
+	})
+	if err != nil {
+		abortWithStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// trackIndex finds the track named by the number parameter.
+func trackIndex(c *gin.Context, a album) (int, bool) {
+	n, err := strconv.Atoi(c.Param("number"))
+	if err != nil || n < 1 || n > len(a.Tracks) {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// trackLocation is the URL of an album's track.
+func trackLocation(albumID string, number int) string {
+	return albumLocation(albumID) + "/tracks/" + strconv.Itoa(number)
+}
@@ -0,0 +1,120 @@
+// Command web-service-gin serves the album store API. A deployment profile
+// picks where it listens, how it logs and where it keeps its data:
+//
+//	local      127.0.0.1:8080, gin debug mode, text logs, albums in memory
+//	ec2        0.0.0.0:8080, release mode, text logs, albums in albums.db
+//	container  0.0.0.0:8080, release mode, JSON logs, albums in memory
+//	           and covers under the temporary directory
+//
+// The profile is named by -profile or ALBUM_PROFILE and is local if
+// neither is set. ALBUM_STORE, ALBUM_STORE_PATH, ALBUM_ID_SCHEME, BLOB_DIR,
+// RATES_FILE and GIN_MODE override what the profile picks, and so does
+// -addr for the listen address.
+//
+// The local profile is only reachable from the machine it runs on. On an
+// EC2 instance, such as the one hw1's load tests call, use the ec2
+// profile, which listens on every interface:
+//
+//	go run . -profile ec2
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"example.com/web-service-gin/albumsvc"
+	"github.com/gin-gonic/gin"
+)
+
+// profile is how the service runs in one kind of deployment.
+type profile struct {
+	addr     string
+	ginMode  string
+	jsonLogs bool // log through slog as JSON instead of plain text
+	config   albumsvc.Config
+}
+
+var profiles = map[string]profile{
+	"local": {
+		addr:    "127.0.0.1:8080",
+		ginMode: gin.DebugMode,
+		config:  albumsvc.Config{Store: "memory", AccessLog: "text"},
+	},
+	// An EC2 instance keeps its disk across restarts, so the catalog is
+	// kept in a file.
+	"ec2": {
+		addr:    "0.0.0.0:8080",
+		ginMode: gin.ReleaseMode,
+		config:  albumsvc.Config{Store: "bolt", StorePath: "albums.db", AccessLog: "text"},
+	},
+	// A container's filesystem goes away with it, and the release image
+	// runs as a user who can only write to the temporary directory.
+	"container": {
+		addr:     "0.0.0.0:8080",
+		ginMode:  gin.ReleaseMode,
+		jsonLogs: true,
+		config: albumsvc.Config{
+			Store:     "memory",
+			BlobDir:   filepath.Join(os.TempDir(), "blobs"),
+			AccessLog: "json",
+		},
+	},
+}
+
+func main() {
+	name := flag.String("profile", envOr("ALBUM_PROFILE", "local"), "deployment profile: "+strings.Join(profileNames(), ", "))
+	addr := flag.String("addr", "", "address to listen on (default: the profile's)")
+	flag.Parse()
+
+	p, ok := profiles[*name]
+	if !ok {
+		log.Fatalf("profile %q is not one of %s", *name, strings.Join(profileNames(), ", "))
+	}
+	if *addr != "" {
+		p.addr = *addr
+	}
+	override(&p.ginMode, "GIN_MODE")
+	override(&p.config.Store, "ALBUM_STORE")
+	override(&p.config.StorePath, "ALBUM_STORE_PATH")
+	override(&p.config.IDScheme, "ALBUM_ID_SCHEME")
+	override(&p.config.BlobDir, "BLOB_DIR")
+	override(&p.config.RatesFile, "RATES_FILE")
+
+	if p.jsonLogs {
+		// The standard logger writes through slog once it has a handler.
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+	gin.SetMode(p.ginMode)
+
+	router, err := albumsvc.New(p.config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("serving profile %s on %s", *name, p.addr)
+	log.Fatal(router.Run(p.addr))
+}
+
+// override replaces *v with the value of the environment variable env, if
+// it is set and not empty.
+func override(v *string, env string) {
+	if s := os.Getenv(env); s != "" {
+		*v = s
+	}
+}
+
+func envOr(env, def string) string {
+	if s := os.Getenv(env); s != "" {
+		return s
+	}
+	return def
+}
+
+func profileNames() []string {
+	return slices.Sorted(maps.Keys(profiles))
+}